@@ -17,48 +17,29 @@ import (
 	"github.com/bububa/osssync/internal/config"
 	"github.com/bububa/osssync/internal/service"
 	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/keyring"
 )
 
 var configWindowOpened = pkg.NewMap[string, struct{}]()
 
 func updateConfig(a fyne.App, setting config.Setting) error {
-	var exists bool
-	cfg := *service.Config()
-	for idx, s := range cfg.Settings {
-		if s.Key() == setting.Key() {
-			cfg.Settings[idx] = setting
-			exists = true
-			break
-		}
-	}
-	if !exists {
+	if err := service.UpdateSetting(setting.Key(), setting); errors.Is(err, service.ErrSettingNotExist) {
 		return errors.New(lang.L("error.settingNotExist"))
+	} else {
+		return err
 	}
-	return service.SaveConfig(&cfg)
 }
 
 func createConfig(a fyne.App, setting config.Setting) error {
-	cfg := *service.Config()
-	for _, s := range cfg.Settings {
-		if s.Key() == setting.Key() {
-			return errors.New(lang.L("error.duplicateSetting"))
-		}
+	if err := service.AddSetting(setting); errors.Is(err, service.ErrDuplicateSetting) {
+		return errors.New(lang.L("error.duplicateSetting"))
+	} else {
+		return err
 	}
-	cfg.Settings = append(cfg.Settings, setting)
-	return service.SaveConfig(&cfg)
 }
 
 func deleteConfig(setting config.Setting) error {
-	cfg := *service.Config()
-	settings := make([]config.Setting, 0, len(cfg.Settings))
-	for _, s := range cfg.Settings {
-		if s.Key() == setting.Key() {
-			continue
-		}
-		settings = append(settings, s)
-	}
-	cfg.Settings = settings
-	return service.SaveConfig(&cfg)
+	return service.RemoveSetting(setting.Key())
 }
 
 type editCallbackFunc func(a fyne.App, setting config.Setting) error
@@ -122,25 +103,29 @@ func EditSetting(a fyne.App, cfg config.Setting, isNew bool) {
 	endpointData := binding.BindString(endpointPointer)
 	endpointField := widget.NewEntryWithData(endpointData)
 	endpointField.Validator = func(str string) error {
-		if str == "" {
+		if str == "" && cfg.Connection == "" {
 			return fmt.Errorf("%s%s", lang.L("config.endpoint"), lang.L("isRequired"))
 		}
 		return nil
 	}
+	// edit the secret references rather than the secrets they resolved to, saving keeps them as references
+	cfg.AccessKeyID, cfg.AccessKeySecret = cfg.RawAccessKeyID(), cfg.RawAccessKeySecret()
 	accessKeyIDPointer := &cfg.AccessKeyID
 	accessKeyIDData := binding.BindString(accessKeyIDPointer)
 	accessKeyIDField := widget.NewEntryWithData(accessKeyIDData)
 	accessKeyIDField.Validator = func(str string) error {
-		if str == "" {
+		if str == "" && cfg.Connection == "" {
 			return fmt.Errorf("%s%s", lang.L("config.accessKeyID"), lang.L("isRequired"))
 		}
 		return nil
 	}
 	accessKeySecretPointer := &cfg.AccessKeySecret
 	accessKeySecretData := binding.BindString(accessKeySecretPointer)
-	accessKeySecretField := widget.NewEntryWithData(accessKeySecretData)
+	// masked, the secret of a connection or a literal one must not show up on screen
+	accessKeySecretField := widget.NewPasswordEntry()
+	accessKeySecretField.Bind(accessKeySecretData)
 	accessKeySecretField.Validator = func(str string) error {
-		if str == "" {
+		if str == "" && cfg.Connection == "" {
 			return fmt.Errorf("%s%s", lang.L("config.accessKeySecret"), lang.L("isRequired"))
 		}
 		return nil
@@ -175,6 +160,51 @@ func EditSetting(a fyne.App, cfg config.Setting, isNew bool) {
 	deletePointer := &cfg.Delete
 	deleteData := binding.BindBool(deletePointer)
 	deleteField := widget.NewCheckWithData("", deleteData)
+	keyringField := widget.NewCheck("", nil)
+	// saving fails if the keyring can't be reached, e.g. a desktop without a Secret Service
+	keyringField.SetChecked(keyring.Available())
+	// a setting using a connection gets its endpoint and credentials from there, they are shown but not edited here
+	noConnection := lang.L("config.noConnection")
+	connectionOptions := []string{noConnection}
+	for _, conn := range service.Config().Connections {
+		connectionOptions = append(connectionOptions, conn.Name)
+	}
+	connectionField := widget.NewSelect(connectionOptions, func(name string) {
+		if name == noConnection {
+			name = ""
+		}
+		cfg.Connection = name
+		if name == "" {
+			endpointField.Enable()
+			accessKeyIDField.Enable()
+			accessKeySecretField.Enable()
+			keyringField.Enable()
+			return
+		}
+		bucket := cfg.Bucket
+		if err := service.Config().ApplyConnection(&cfg); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		if isUpdate {
+			// the bucket is part of the key of an existing setting
+			cfg.Bucket = bucket
+		}
+		cfg.AccessKeyID, cfg.AccessKeySecret = cfg.RawAccessKeyID(), cfg.RawAccessKeySecret()
+		endpointData.Reload()
+		accessKeyIDData.Reload()
+		accessKeySecretData.Reload()
+		bucketData.Reload()
+		endpointField.Disable()
+		accessKeyIDField.Disable()
+		accessKeySecretField.Disable()
+		keyringField.Disable()
+	})
+	if cfg.Connection != "" {
+		connectionField.SetSelected(cfg.Connection)
+	} else {
+		connectionField.SetSelected(noConnection)
+	}
 	if isUpdate {
 		folderBtn.Disable()
 		localField.Disable()
@@ -185,9 +215,11 @@ func EditSetting(a fyne.App, cfg config.Setting, isNew bool) {
 		Items: []*widget.FormItem{ // we can specify items in the constructor
 			{Text: lang.L("config.name"), Widget: nameField},
 			{Text: lang.L("config.local"), Widget: localContainer},
+			{Text: lang.L("config.connection"), Widget: connectionField},
 			{Text: lang.L("config.endpoint"), Widget: endpointField},
 			{Text: lang.L("config.accessKeyID"), Widget: accessKeyIDField},
 			{Text: lang.L("config.accessKeySecret"), Widget: accessKeySecretField},
+			{Text: lang.L("config.keyring"), Widget: keyringField},
 			{Text: lang.L("config.bucket"), Widget: bucketField},
 			{Text: lang.L("config.prefix"), Widget: prefixField},
 			{Text: lang.L("config.ignoreHiddenFiles"), Widget: ignoreHiddenField},
@@ -195,6 +227,12 @@ func EditSetting(a fyne.App, cfg config.Setting, isNew bool) {
 		},
 		SubmitText: lang.L("Save"),
 		OnSubmit: func() { // optional, handle form submission
+			if keyringField.Checked {
+				if err := service.StoreSecretInKeyring(&cfg); err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+			}
 			if err := callback(a, cfg); err != nil {
 				dialog.ShowError(err, w)
 				return
@@ -27,7 +27,10 @@ func Launch(ctx context.Context) {
 		log.Fatalln(err)
 	}
 	service.Init(cfg)
-	service.Start(ctx)
+	if err := service.Start(ctx); err != nil {
+		// another osssync-cli sync or tray app owns the config, see osssync-cli pause, resume and status
+		log.Fatalln(err)
+	}
 	defer service.Close()
 	lang.AddTranslationsFS(i18n, "lang")
 	setSystemBar(a)
@@ -22,6 +22,7 @@ func setSystemBar(a fyne.App) {
 	desk.SetSystemTrayMenu(menu)
 	syncing := atomic.NewBool(false)
 	syncingMap := pkg.NewMap[string, bool]()
+	var dropped uint64
 	go func() {
 		for {
 			select {
@@ -29,6 +30,13 @@ func setSystemBar(a fyne.App) {
 				menu.Items = menuItems(a)
 				menu.Refresh()
 			case ev := <-service.Syncer().Events():
+				// the events ring drops the oldest events when the tray falls behind,
+				// a missed SyncStart or SyncComplete would leave a stale state so rebuild it from Status
+				if n := service.Syncer().DroppedSyncEvents(); n != dropped {
+					dropped = n
+					resyncSystemBar(desk, menu, syncing, syncingMap)
+					continue
+				}
 				var (
 					statusChanged       bool
 					updateSyncingStatus bool
@@ -60,23 +68,11 @@ func setSystemBar(a fyne.App) {
 					updateSyncingStatus = true
 				}
 				if statusChanged {
-					var imgName fyne.ThemedResource
-					if syncing.Load() {
-						imgName = resource.IconSyncing
-					} else {
-						imgName = resource.IconSyncComplete
-					}
-					desk.SetSystemTrayIcon(imgName)
+					setSystemBarIcon(desk, syncing.Load())
 				}
 				if updateSyncingStatus {
-					for _, m := range menu.Items {
-						if subM := m.ChildMenu; subM != nil && subM.Label == cfgKey {
-							isSyncing, _ := syncingMap.Load(cfgKey)
-							for _, subItem := range subM.Items {
-								subItem.Disabled = isSyncing
-							}
-						}
-					}
+					isSyncing, _ := syncingMap.Load(cfgKey)
+					disableSettingMenu(menu, cfgKey, isSyncing)
 					menu.Refresh()
 				}
 			}
@@ -84,6 +80,37 @@ func setSystemBar(a fyne.App) {
 	}()
 }
 
+// resyncSystemBar rebuilds the syncing state of the tray from the status of the running settings.
+func resyncSystemBar(desk desktop.App, menu *fyne.Menu, syncing *atomic.Bool, syncingMap *pkg.Map[string, bool]) {
+	var anySyncing bool
+	for _, st := range service.Syncer().Status() {
+		syncingMap.Store(st.Key, st.Syncing)
+		disableSettingMenu(menu, st.Key, st.Syncing)
+		anySyncing = anySyncing || st.Syncing
+	}
+	syncing.Store(anySyncing)
+	setSystemBarIcon(desk, anySyncing)
+	menu.Refresh()
+}
+
+func setSystemBarIcon(desk desktop.App, syncing bool) {
+	if syncing {
+		desk.SetSystemTrayIcon(resource.IconSyncing)
+		return
+	}
+	desk.SetSystemTrayIcon(resource.IconSyncComplete)
+}
+
+func disableSettingMenu(menu *fyne.Menu, cfgKey string, disabled bool) {
+	for _, m := range menu.Items {
+		if subM := m.ChildMenu; subM != nil && subM.Label == cfgKey {
+			for _, subItem := range subM.Items {
+				subItem.Disabled = disabled
+			}
+		}
+	}
+}
+
 func menuItems(a fyne.App) []*fyne.MenuItem {
 	addItem := fyne.NewMenuItem(lang.L("systembar.addSetting"), func() { EditSetting(a, config.EmptySetting, true) })
 	items := make([]*fyne.MenuItem, 0, len(service.Config().Settings)+4)
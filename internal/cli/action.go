@@ -10,7 +10,10 @@ import (
 func beforeAction(c *cli.Context) error {
 	var cfg config.Config
 	if err := loadConfig(c, &cfg); err != nil {
-		return err
+		if c.Args().First() != "doctor" {
+			return err
+		}
+		configErr = err
 	}
 	service.Init(&cfg)
 	return nil
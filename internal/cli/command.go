@@ -1,19 +1,168 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg/scheduler"
 )
 
 func Sync(c *cli.Context) error {
+	events := c.String("events")
+	if events != "" && events != "json" {
+		return fmt.Errorf("unsupported events format: %s", events)
+	}
 	ctx := c.Context
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
-	service.Start(ctx)
+	defer stop()
+	if c.Bool("once") {
+		c.Context = ctx
+		return syncOnce(c)
+	}
+	if listen := c.String("http"); listen != "" {
+		service.SetHTTPListen(listen)
+	}
+	if c.IsSet("drain-timeout") {
+		// kept out of the config, a reload would lose it
+		if err := service.Syncer().SetDrainTimeout(c.Duration("drain-timeout")); err != nil {
+			return err
+		}
+	}
+	if events != "" {
+		sub := service.Syncer().Subscribe()
+		defer service.Syncer().Unsubscribe(sub)
+		go func() {
+			for ev := range sub.C() {
+				printNDJSON(c.App.Writer, ev)
+			}
+		}()
+	}
+	if err := service.Start(ctx); err != nil {
+		if errors.Is(err, service.ErrAlreadyRunning) {
+			return handover(c, ctx, err)
+		}
+		return err
+	}
 	<-ctx.Done()
-	stop()
 	return nil
 }
+
+// handover drives the daemon already running with the same config instead of starting a competing one:
+// it triggers a sync there and, with --events, follows its events.
+func handover(c *cli.Context, ctx context.Context, running error) error {
+	fmt.Fprintf(c.App.ErrWriter, "%v (pid %d), triggering a sync there\n", running, service.RunningPID())
+	clt := service.Client()
+	if err := clt.Sync(ctx); err != nil {
+		return err
+	}
+	if c.String("events") == "" {
+		return nil
+	}
+	return clt.Events(ctx, func(ev sync.Event) error {
+		return printNDJSON(c.App.Writer, ev)
+	})
+}
+
+// syncOnce reconciles the named settings, or all of them, and fails if any transfer failed or a remote file
+// conflicts with its local one. It holds the instance lock so it never runs alongside the daemon of the config.
+func syncOnce(c *cli.Context) error {
+	if err := service.LockInstance(); err != nil {
+		if errors.Is(err, service.ErrAlreadyRunning) {
+			return fmt.Errorf("%w (pid %d), use trigger to make it sync", err, service.RunningPID())
+		}
+		return err
+	}
+	defer service.UnlockInstance()
+	cfg := service.Config()
+	settings, err := cfg.SelectSettings(c.Args().Slice())
+	if err != nil {
+		return err
+	}
+	var (
+		fn func(sync.Event)
+		// the summary goes to stderr when stdout carries the event stream
+		w io.Writer = c.App.Writer
+	)
+	if c.String("events") != "" {
+		fn = func(ev sync.Event) {
+			printNDJSON(c.App.Writer, ev)
+		}
+		w = c.App.ErrWriter
+	}
+	sched := scheduler.New(cfg.Concurrency)
+	defer sched.Close()
+	summaries := sync.Reconcile(c.Context, sched, settings, fn)
+	var failed, conflicts int
+	for _, s := range summaries {
+		failed += len(s.Failures)
+		conflicts += len(s.Conflicts)
+	}
+	if c.Bool("json") {
+		if err := printJSON(w, summaries); err != nil {
+			return err
+		}
+	} else {
+		tw := newTabWriter(w)
+		fmt.Fprintln(tw, "NAME\tUPLOADED\tBYTES\tDELETED\tCONFLICTS\tFAILED\tDURATION")
+		for _, s := range summaries {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\t%d\t%s\n", s.Setting, s.Uploaded, formatSize(s.Bytes, true), s.Deleted, len(s.Conflicts), len(s.Failures), s.Duration.Round(time.Millisecond))
+		}
+		tw.Flush()
+		for _, s := range summaries {
+			for _, path := range s.Conflicts {
+				fmt.Fprintf(c.App.ErrWriter, "%s: conflict %s: the remote file isn't older than the local one\n", s.Setting, path)
+			}
+			for _, f := range s.Failures {
+				fmt.Fprintf(c.App.ErrWriter, "%s: %s %s: %s\n", s.Setting, f.Op, f.Path, f.Error)
+			}
+		}
+	}
+	if failed > 0 || conflicts > 0 {
+		return fmt.Errorf("%d transfers failed, %d conflicts", failed, conflicts)
+	}
+	if err := c.Context.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WatchEvents streams the events of the running daemon as json lines, optionally only those of the named settings.
+func WatchEvents(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(c.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	names := make(map[string]struct{}, c.NArg())
+	for _, name := range c.Args().Slice() {
+		names[name] = struct{}{}
+	}
+	types := make(map[sync.EventType]struct{})
+	for _, typ := range c.StringSlice("type") {
+		types[sync.EventType(typ)] = struct{}{}
+	}
+	fn := func(ev sync.Event) error {
+		if _, ok := names[ev.Setting]; len(names) > 0 && !ok {
+			return nil
+		}
+		if _, ok := types[ev.Type]; len(types) > 0 && !ok {
+			return nil
+		}
+		return printNDJSON(c.App.Writer, ev)
+	}
+	err := service.Client().Events(ctx, fn)
+	if errors.Is(err, sync.ErrNotRunning) {
+		if service.RunningPID() == 0 {
+			return err
+		}
+		// a daemon without control socket still writes its event log
+		return sync.TailEvents(ctx, service.Instance(), fn)
+	}
+	return err
+}
@@ -1,16 +1,304 @@
 package cli
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/urfave/cli/v2"
 
 	"github.com/bububa/osssync/internal/config"
 	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/internal/service/sync"
+	ossFS "github.com/bububa/osssync/pkg/fs/oss"
 )
 
+var keyringFlag = &cli.BoolFlag{
+	Name:  "keyring",
+	Usage: "store AccessKeySecret in the OS keyring and write only a keyring reference into the config",
+}
+
 func loadConfig(c *cli.Context, cfg *config.Config) error {
-	configPath := c.String("config")
-	if configPath != "" {
-		service.ConfigLoader(cfg, configPath)
+	if configPath := c.String("config"); configPath != "" {
+		return service.ConfigLoader(cfg, configPath)
 	}
 	return service.LoadConfig(cfg)
 }
+
+func findSetting(name string) (config.Setting, error) {
+	if name == "" {
+		return config.EmptySetting, errors.New("setting name is required")
+	}
+	setting, ok := service.Config().FindSetting(name)
+	if !ok {
+		return config.EmptySetting, fmt.Errorf("setting %s not found", name)
+	}
+	return setting, nil
+}
+
+func ConfigList(c *cli.Context) error {
+	cfg := service.Config()
+	if c.Bool("json") {
+		settings := make([]config.Setting, 0, len(cfg.Settings))
+		for _, s := range cfg.Settings {
+			settings = append(settings, s.Masked())
+		}
+		return printJSON(c.App.Writer, settings)
+	}
+	w := newTabWriter(c.App.Writer)
+	fmt.Fprintln(w, "NAME\tLOCAL\tBUCKET\tPREFIX\tENDPOINT")
+	for _, s := range cfg.Settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Local, s.Bucket, s.Prefix, s.Endpoint)
+	}
+	return w.Flush()
+}
+
+func ConfigShow(c *cli.Context) error {
+	setting, err := findSetting(c.Args().First())
+	if err != nil {
+		return err
+	}
+	setting = setting.Masked()
+	if c.Bool("json") {
+		return printJSON(c.App.Writer, setting)
+	}
+	w := newTabWriter(c.App.Writer)
+	for _, f := range [][2]any{
+		{"Name", setting.Name},
+		{"Local", setting.Local},
+		{"Connection", setting.Connection},
+		{"Endpoint", setting.Endpoint},
+		{"Bucket", setting.Bucket},
+		{"Prefix", setting.Prefix},
+		{"AccessKeyID", setting.AccessKeyID},
+		{"AccessKeySecret", setting.AccessKeySecret},
+		{"Provider", setting.CredentialProvider()},
+		{"Profile", setting.Profile},
+		{"ECSRole", setting.ECSRole},
+		{"RoleArn", setting.RoleArn},
+		{"RoleSessionName", setting.RoleSessionName},
+		{"RoleDuration", setting.RoleDuration},
+		{"STSEndpoint", setting.STSEndpoint},
+		{"MultipartThreshold", setting.MultipartThreshold},
+		{"PartSize", setting.PartSize},
+		{"Routines", setting.Routines},
+		{"Weight", setting.Weight},
+		{"IgnoreHiddenFiles", setting.IgnoreHiddenFiles},
+		{"Delete", setting.Delete},
+	} {
+		fmt.Fprintf(w, "%s\t%v\n", f[0], f[1])
+	}
+	return w.Flush()
+}
+
+// accessFlags are the flags of the endpoint and credentials shared by config add and config connection add.
+func accessFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "endpoint"},
+		&cli.StringFlag{Name: "access-key-id"},
+		&cli.StringFlag{Name: "access-key-secret"},
+		&cli.StringFlag{Name: "provider", Usage: "where credentials come from: chain, static, env, profile or ecs_role"},
+		&cli.StringFlag{Name: "profile", Usage: "Aliyun CLI `PROFILE` of the profile provider"},
+		&cli.StringFlag{Name: "role-arn", Usage: "assume the RAM role `ARN` through STS, renewing its credentials before they expire"},
+	}
+}
+
+// accessFromFlags reads the endpoint and credentials, prompting for AccessKeySecret when only AccessKeyID is given.
+func accessFromFlags(c *cli.Context) (config.Access, error) {
+	access := config.Access{
+		Endpoint:        c.String("endpoint"),
+		AccessKeyID:     c.String("access-key-id"),
+		AccessKeySecret: c.String("access-key-secret"),
+		Provider:        c.String("provider"),
+		Profile:         c.String("profile"),
+		RoleArn:         c.String("role-arn"),
+	}
+	if access.AccessKeyID != "" && access.AccessKeySecret == "" {
+		secret, err := readSecret(c, "AccessKeySecret")
+		if err != nil {
+			return access, err
+		}
+		access.AccessKeySecret = secret
+	}
+	return access, nil
+}
+
+// readSecret prompts for a secret on the app reader so it doesn't end up in the shell history.
+func readSecret(c *cli.Context, name string) (string, error) {
+	fmt.Fprintf(c.App.ErrWriter, "%s: ", name)
+	line, err := bufio.NewReader(c.App.Reader).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func ConfigAdd(c *cli.Context) error {
+	setting := config.Setting{
+		Name:  c.String("name"),
+		Local: c.String("local"),
+		Credential: config.Credential{
+			Connection: c.String("connection"),
+			Bucket:     c.String("bucket"),
+			Prefix:     c.String("prefix"),
+		},
+		Weight:            c.Int("weight"),
+		IgnoreHiddenFiles: c.Bool("ignore-hidden-files"),
+		Delete:            c.Bool("delete"),
+	}
+	if setting.Connection != "" {
+		for _, f := range accessFlags() {
+			if name := f.Names()[0]; c.IsSet(name) {
+				return fmt.Errorf("--%s can't be used with --connection, the connection provides it", name)
+			}
+		}
+		if err := service.Config().ApplyConnection(&setting); err != nil {
+			return err
+		}
+	} else {
+		access, err := accessFromFlags(c)
+		if err != nil {
+			return err
+		}
+		setting.Access = access
+	}
+	if err := setting.Validate(); err != nil {
+		return err
+	}
+	if c.Bool("keyring") {
+		if err := service.StoreSecretInKeyring(&setting); err != nil {
+			return err
+		}
+	}
+	if err := service.AddSetting(setting); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.ErrWriter, "added setting %s\n", setting.Name)
+	return nil
+}
+
+// ConfigSet assigns field=value pairs of a setting, or of the global config when no setting is given.
+func ConfigSet(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) == 0 {
+		return errors.New("usage: config set [setting] <field=value>...")
+	}
+	if !strings.Contains(args[0], "=") {
+		return configSetSetting(c, args[0], args[1:])
+	}
+	cfg := *service.Config()
+	for _, arg := range args {
+		field, value, _ := strings.Cut(arg, "=")
+		if err := cfg.Set(field, value); err != nil {
+			return err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return service.SaveConfig(&cfg)
+}
+
+func configSetSetting(c *cli.Context, name string, args []string) error {
+	setting, err := findSetting(name)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 && !c.Bool("keyring") {
+		return errors.New("at least one field=value is required")
+	}
+	key := setting.Key()
+	for _, arg := range args {
+		field, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s, expected field=value", arg)
+		}
+		if value == "-" {
+			// read from stdin, e.g. for AccessKeySecret
+			if value, err = readSecret(c, field); err != nil {
+				return err
+			}
+		}
+		if err := setting.Set(field, value); err != nil {
+			return err
+		}
+	}
+	if err := service.Config().ApplyConnection(&setting); err != nil {
+		return err
+	}
+	if err := setting.Validate(); err != nil {
+		return err
+	}
+	if c.Bool("keyring") {
+		if err := service.StoreSecretInKeyring(&setting); err != nil {
+			return err
+		}
+	}
+	return service.UpdateSetting(key, setting)
+}
+
+func ConfigRemove(c *cli.Context) error {
+	setting, err := findSetting(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if !confirm(c, "remove setting %s?", setting.DisplayName()) {
+		return nil
+	}
+	return service.RemoveSetting(setting.Key())
+}
+
+// ConfigValidate checks the config and, unless --offline, probes the credentials of every setting against its bucket.
+func ConfigValidate(c *cli.Context) error {
+	cfg := service.Config()
+	settings, err := cfg.SelectSettings(c.Args().Slice())
+	if err != nil {
+		return err
+	}
+	var failed bool
+	if err := cfg.Validate(); err != nil {
+		failed = true
+		fmt.Fprintf(c.App.Writer, "FAIL\tconfig\n%s\n", indent(err.Error()))
+	} else {
+		fmt.Fprintln(c.App.Writer, "OK\tconfig")
+	}
+	if c.Bool("offline") {
+		if failed {
+			return errors.New("config is invalid")
+		}
+		return nil
+	}
+	for _, setting := range settings {
+		for _, res := range probeSetting(c.Context, &setting) {
+			status := "OK"
+			if res.Err != nil {
+				status = "FAIL"
+				failed = true
+			}
+			fmt.Fprintf(c.App.Writer, "%s\t%s\t%s", status, setting.DisplayName(), res.Step)
+			if res.Err != nil {
+				fmt.Fprintf(c.App.Writer, "\t%v", res.Err)
+			}
+			fmt.Fprintln(c.App.Writer)
+		}
+	}
+	if failed {
+		return errors.New("validation failed")
+	}
+	return nil
+}
+
+func probeSetting(ctx context.Context, setting *config.Setting) []ossFS.ProbeResult {
+	fs, err := sync.NewFS(setting)
+	if err != nil {
+		return []ossFS.ProbeResult{{Step: "client", Err: err}}
+	}
+	defer fs.Close()
+	return fs.Probe(ctx)
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
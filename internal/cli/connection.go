@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service"
+)
+
+func findConnection(name string) (config.Connection, error) {
+	if name == "" {
+		return config.Connection{}, errors.New("connection name is required")
+	}
+	conn, ok := service.Config().FindConnection(name)
+	if !ok {
+		return config.Connection{}, fmt.Errorf("connection %s not found", name)
+	}
+	return conn, nil
+}
+
+func ConnectionList(c *cli.Context) error {
+	cfg := service.Config()
+	if c.Bool("json") {
+		conns := make([]config.Connection, 0, len(cfg.Connections))
+		for _, conn := range cfg.Connections {
+			conns = append(conns, conn.Masked())
+		}
+		return printJSON(c.App.Writer, conns)
+	}
+	w := newTabWriter(c.App.Writer)
+	fmt.Fprintln(w, "NAME\tENDPOINT\tBUCKET\tPROVIDER\tSETTINGS")
+	for _, conn := range cfg.Connections {
+		var settings []string
+		for _, s := range cfg.Settings {
+			if s.Connection == conn.Name {
+				settings = append(settings, s.Name)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", conn.Name, conn.Endpoint, conn.Bucket, conn.CredentialProvider(), strings.Join(settings, ","))
+	}
+	return w.Flush()
+}
+
+func ConnectionAdd(c *cli.Context) error {
+	access, err := accessFromFlags(c)
+	if err != nil {
+		return err
+	}
+	conn := config.Connection{
+		Name:   c.String("name"),
+		Access: access,
+		Bucket: c.String("bucket"),
+	}
+	if err := conn.Validate(); err != nil {
+		return err
+	}
+	if c.Bool("keyring") {
+		if err := service.StoreConnectionSecretInKeyring(&conn); err != nil {
+			return err
+		}
+	}
+	if err := service.AddConnection(conn); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.ErrWriter, "added connection %s\n", conn.Name)
+	return nil
+}
+
+// ConnectionSet assigns field=value pairs of a connection, the settings using it pick the change up on reload.
+func ConnectionSet(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) == 0 {
+		return errors.New("usage: config connection set <connection> <field=value>...")
+	}
+	conn, err := findConnection(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 && !c.Bool("keyring") {
+		return errors.New("at least one field=value is required")
+	}
+	for _, arg := range args[1:] {
+		field, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s, expected field=value", arg)
+		}
+		if value == "-" {
+			if value, err = readSecret(c, field); err != nil {
+				return err
+			}
+		}
+		if err := conn.Set(field, value); err != nil {
+			return err
+		}
+	}
+	if err := conn.Validate(); err != nil {
+		return err
+	}
+	if c.Bool("keyring") {
+		if err := service.StoreConnectionSecretInKeyring(&conn); err != nil {
+			return err
+		}
+	}
+	return service.UpdateConnection(args[0], conn)
+}
+
+func ConnectionRemove(c *cli.Context) error {
+	conn, err := findConnection(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if !confirm(c, "remove connection %s?", conn.Name) {
+		return nil
+	}
+	return service.RemoveConnection(conn.Name)
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/service"
+)
+
+// Trigger makes the running daemon upload every file of the named settings, or of all settings.
+func Trigger(c *cli.Context) error {
+	return service.Client().Sync(c.Context, c.Args().Slice()...)
+}
+
+func Pause(c *cli.Context) error {
+	return service.Client().Pause(c.Context, c.Args().Slice()...)
+}
+
+func Resume(c *cli.Context) error {
+	return service.Client().Resume(c.Context, c.Args().Slice()...)
+}
+
+// Reload makes the running daemon read its config file again, restarting only the settings which changed.
+func Reload(c *cli.Context) error {
+	ret, err := service.Client().Reload(c.Context)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		if err := printJSON(c.App.Writer, ret); err != nil {
+			return err
+		}
+		return ret.Err()
+	}
+	w := newTabWriter(c.App.Writer)
+	fmt.Fprintln(w, "NAME\tCHANGE")
+	for _, list := range []struct {
+		change string
+		names  []string
+	}{{"added", ret.Added}, {"removed", ret.Removed}, {"restarted", ret.Restarted}, {"unchanged", ret.Unchanged}} {
+		for _, name := range list.names {
+			fmt.Fprintf(w, "%s\t%s\n", name, list.change)
+		}
+	}
+	for _, f := range ret.Failed {
+		fmt.Fprintf(w, "%s\tfailed: %s\n", f.Setting, f.Error)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return ret.Err()
+}
+
+func Transfers(c *cli.Context) error {
+	transfers, err := service.Client().Transfers(c.Context)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(c.App.Writer, transfers)
+	}
+	w := newTabWriter(c.App.Writer)
+	fmt.Fprintln(w, "NAME\tOP\tSRC\tDIST\tPROGRESS")
+	for _, t := range transfers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s/%s (%.1f%%)\n", t.Setting, t.Op, t.Src, t.Dist, formatSize(t.ConsumedBytes, true), formatSize(t.TotalBytes, true), t.Progress())
+	}
+	return w.Flush()
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/internal/service/sync"
+)
+
+type diffSummary struct {
+	OnlyLocal  int `json:"only_local"`
+	OnlyRemote int `json:"only_remote"`
+	Different  int `json:"different"`
+}
+
+type diffReport struct {
+	Setting string      `json:"setting"`
+	Summary diffSummary `json:"summary"`
+	Diffs   []sync.Diff `json:"diffs"`
+}
+
+func Diff(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return errors.New("setting name is required")
+	}
+	kinds := make(map[sync.DiffKind]struct{})
+	for _, kind := range c.StringSlice("only") {
+		switch k := sync.DiffKind(kind); k {
+		case sync.DiffOnlyLocal, sync.DiffOnlyRemote, sync.DiffDifferent:
+			kinds[k] = struct{}{}
+		default:
+			return fmt.Errorf("unknown diff kind %s", kind)
+		}
+	}
+	setting, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	diffs, err := sync.Compare(c.Context, setting, fs, sync.WithHash(c.Bool("hash")))
+	if err != nil {
+		return err
+	}
+	report := diffReport{
+		Setting: setting.DisplayName(),
+		Diffs:   make([]sync.Diff, 0, len(diffs)),
+	}
+	for _, diff := range diffs {
+		switch diff.Kind {
+		case sync.DiffOnlyLocal:
+			report.Summary.OnlyLocal++
+		case sync.DiffOnlyRemote:
+			report.Summary.OnlyRemote++
+		case sync.DiffDifferent:
+			report.Summary.Different++
+		}
+		if _, ok := kinds[diff.Kind]; len(kinds) == 0 || ok {
+			report.Diffs = append(report.Diffs, diff)
+		}
+	}
+	if c.Bool("json") {
+		return printJSON(c.App.Writer, report)
+	}
+	human := c.Bool("human-readable")
+	w := newTabWriter(c.App.Writer)
+	for _, diff := range report.Diffs {
+		var local, remote string
+		if diff.Local != nil {
+			local = formatSize(diff.Local.Size, human)
+		}
+		if diff.Remote != nil {
+			remote = formatSize(diff.Remote.Size, human)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", diff.Kind, diff.Reason, local, remote, diff.Path)
+	}
+	w.Flush()
+	fmt.Fprintf(c.App.Writer, "%d only local, %d only remote, %d different\n", report.Summary.OnlyLocal, report.Summary.OnlyRemote, report.Summary.Different)
+	return nil
+}
@@ -0,0 +1,7 @@
+package cli
+
+import "errors"
+
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("not supported on windows")
+}
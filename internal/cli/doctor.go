@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg"
+)
+
+const (
+	// MaxClockSkew is the skew from which oss rejects requests with RequestTimeTooSkewed
+	MaxClockSkew = 15 * time.Minute
+	// WarnClockSkew is the skew reported as a warning
+	WarnClockSkew = time.Minute
+	// MinFreeDisk is the free space below which temp and checkpoint dirs fail the check
+	MinFreeDisk = 100 << 20
+	// WarnFreeDisk is the free space below which temp and checkpoint dirs are reported as a warning
+	WarnFreeDisk = 1 << 30
+)
+
+// legacyCheckpointDirs are the folders older versions kept multipart checkpoints in, inside the synced tree.
+var legacyCheckpointDirs = []string{".osssync-upload", ".osssync-download"}
+
+// configErr keeps the config load error for doctor, which reports it instead of failing.
+var configErr error
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+type check struct {
+	Name   string      `json:"name"`
+	Status checkStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+type checklist []check
+
+func (l *checklist) add(name string, status checkStatus, format string, args ...any) {
+	*l = append(*l, check{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (l *checklist) addErr(name string, err error, format string, args ...any) {
+	if err != nil {
+		l.add(name, checkFail, "%v", err)
+		return
+	}
+	l.add(name, checkPass, format, args...)
+}
+
+func Doctor(c *cli.Context) error {
+	var list checklist
+	path, _ := service.ConfigPath()
+	if configErr != nil {
+		list.add("config", checkFail, "%s: %v", path, configErr)
+	} else {
+		cfg := service.Config()
+		if err := cfg.Validate(); err != nil {
+			list.add("config", checkFail, "%s: %s", path, strings.ReplaceAll(err.Error(), "\n", "; "))
+		} else {
+			list.add("config", checkPass, "%s, %d settings", path, len(cfg.Settings))
+		}
+		checkConfigPerm(&list, path)
+		checkSettings(c.Context, &list, cfg.Settings)
+	}
+	if pid := service.RunningPID(); pid > 0 {
+		list.add("daemon", checkPass, "running, pid %d", pid)
+	} else {
+		list.add("daemon", checkWarn, "not running, start it with osssync sync")
+	}
+	checkFUSE(&list)
+	checkDisk(&list, "temp dir", filepath.Join(os.TempDir(), pkg.AppIdentity))
+	checkDisk(&list, "state dir", sync.StateDir())
+	if c.Bool("json") {
+		if err := printJSON(c.App.Writer, list); err != nil {
+			return err
+		}
+	} else {
+		for _, v := range list {
+			fmt.Fprintf(c.App.Writer, "[%s] %s: %s\n", strings.ToUpper(string(v.Status)), v.Name, v.Detail)
+		}
+	}
+	var failed int
+	for _, v := range list {
+		if v.Status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+func checkConfigPerm(list *checklist, path string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		list.add("config permissions", checkFail, "%v", err)
+		return
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		list.add("config permissions", checkWarn, "%s is %s, secrets are readable by other users, chmod 600 it", path, fi.Mode().Perm())
+		return
+	}
+	list.add("config permissions", checkPass, "%s", fi.Mode().Perm())
+}
+
+func checkSettings(ctx context.Context, list *checklist, settings []config.Setting) {
+	var dirs int
+	endpoints := make(map[string]struct{})
+	for _, setting := range settings {
+		name := setting.DisplayName()
+		n, leftovers, err := walkLocal(&setting)
+		dirs += n
+		list.addErr(name+": local", err, "%s readable, %d directories", setting.Local, n)
+		if len(leftovers) > 0 {
+			list.add(name+": leftovers", checkWarn, "checkpoint folders of an older version, safe to delete: %s", strings.Join(leftovers, ", "))
+		}
+		host := bucketHost(&setting)
+		if _, ok := endpoints[host]; !ok {
+			endpoints[host] = struct{}{}
+			checkEndpoint(ctx, list, name, &setting)
+		}
+		for _, res := range probeSetting(ctx, &setting) {
+			list.addErr(fmt.Sprintf("%s: credentials %s", name, res.Step), res.Err, "ok")
+		}
+	}
+	checkInotify(list, dirs)
+}
+
+// walkLocal counts the directories watched for setting and finds legacy checkpoint folders.
+func walkLocal(setting *config.Setting) (int, []string, error) {
+	fd, err := os.Open(setting.Local)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, err = fd.Readdirnames(1)
+	fd.Close()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, err
+	}
+	var (
+		dirs      int
+		leftovers []string
+	)
+	err = filepath.Walk(setting.Local, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		for _, name := range legacyCheckpointDirs {
+			if fi.Name() == name {
+				leftovers = append(leftovers, path)
+				return filepath.SkipDir
+			}
+		}
+		if path != setting.Local && setting.IgnoreHiddenFiles && strings.HasPrefix(fi.Name(), ".") {
+			return filepath.SkipDir
+		}
+		dirs++
+		return nil
+	})
+	return dirs, leftovers, err
+}
+
+func checkInotify(list *checklist, dirs int) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	bs, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		list.add("inotify watches", checkWarn, "%v", err)
+		return
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(bs)))
+	if err != nil {
+		list.add("inotify watches", checkWarn, "%v", err)
+		return
+	}
+	switch {
+	case dirs > limit:
+		list.add("inotify watches", checkFail, "%d directories exceed fs.inotify.max_user_watches=%d, raise it with sysctl", dirs, limit)
+	case dirs > limit*8/10:
+		list.add("inotify watches", checkWarn, "%d directories use most of fs.inotify.max_user_watches=%d, shared with other programs", dirs, limit)
+	default:
+		list.add("inotify watches", checkPass, "%d directories, fs.inotify.max_user_watches=%d", dirs, limit)
+	}
+}
+
+func checkFUSE(list *checklist) {
+	switch runtime.GOOS {
+	case "linux":
+		if _, err := os.Stat("/dev/fuse"); err != nil {
+			list.add("fuse", checkWarn, "/dev/fuse not found, mount is unavailable")
+			return
+		}
+		for _, cmd := range []string{"fusermount3", "fusermount"} {
+			if path, err := exec.LookPath(cmd); err == nil {
+				list.add("fuse", checkPass, "/dev/fuse, %s", path)
+				return
+			}
+		}
+		list.add("fuse", checkWarn, "fusermount not found, mount needs root")
+	case "darwin":
+		if _, err := os.Stat("/Library/Filesystems/macfuse.fs"); err != nil {
+			list.add("fuse", checkWarn, "macFUSE is not installed, mount is unavailable")
+			return
+		}
+		list.add("fuse", checkPass, "macFUSE")
+	default:
+		list.add("fuse", checkWarn, "mount is not supported on %s", runtime.GOOS)
+	}
+}
+
+func checkDisk(list *checklist, name string, dir string) {
+	// the dir may not exist yet, check the closest existing parent
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, err := diskFree(dir)
+	switch {
+	case err != nil:
+		list.add(name, checkWarn, "%s: %v", dir, err)
+	case free < MinFreeDisk:
+		list.add(name, checkFail, "%s: %s free", dir, formatSize(int64(free), true))
+	case free < WarnFreeDisk:
+		list.add(name, checkWarn, "%s: %s free", dir, formatSize(int64(free), true))
+	default:
+		list.add(name, checkPass, "%s: %s free", dir, formatSize(int64(free), true))
+	}
+}
+
+func bucketHost(setting *config.Setting) string {
+	endpoint := setting.Endpoint
+	if _, rest, ok := strings.Cut(endpoint, "://"); ok {
+		endpoint = rest
+	}
+	return setting.Bucket + "." + strings.TrimSuffix(endpoint, "/")
+}
+
+// checkEndpoint resolves the bucket host, does a TLS request and compares the server Date with the local clock.
+func checkEndpoint(ctx context.Context, list *checklist, name string, setting *config.Setting) {
+	host := bucketHost(setting)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		list.add(name+": dns", checkFail, "%v", err)
+		return
+	}
+	list.add(name+": dns", checkPass, "%s -> %s", host, strings.Join(addrs, ", "))
+	scheme := "https"
+	if strings.HasPrefix(setting.Endpoint, "http://") {
+		scheme = "http"
+		list.add(name+": tls", checkWarn, "endpoint %s doesn't use https", setting.Endpoint)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, scheme+"://"+host+"/", nil)
+	if err != nil {
+		list.add(name+": tls", checkFail, "%v", err)
+		return
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		list.add(name+": "+scheme, checkFail, "%v", err)
+		return
+	}
+	resp.Body.Close()
+	if scheme == "https" {
+		list.add(name+": tls", checkPass, "%s, %s", host, tls.VersionName(resp.TLS.Version))
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		list.add(name+": clock", checkWarn, "no Date header in server response")
+		return
+	}
+	// the server time was taken somewhere during the request
+	skew := time.Until(date) + time.Since(start)/2
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew > MaxClockSkew:
+		list.add(name+": clock", checkFail, "local clock is %s off the server, requests are rejected", skew.Round(time.Second))
+	case skew > WarnClockSkew:
+		list.add(name+": clock", checkWarn, "local clock is %s off the server", skew.Round(time.Second))
+	default:
+		list.add(name+": clock", checkPass, "skew %s", skew.Round(time.Second))
+	}
+}
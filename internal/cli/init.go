@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -30,10 +31,319 @@ func NewApp(app *cli.App) {
 		After:  afterAction,
 		Commands: []*cli.Command{
 			{
-				Name:     "sync",
-				Usage:    "Start syncing",
-				Category: "Sync",
-				Action:   Sync,
+				Name:      "sync",
+				Usage:     "Start syncing, or reconcile once with --once",
+				Category:  "Sync",
+				ArgsUsage: "[--once [setting...]]",
+				Action:    Sync,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "once", Usage: "reconcile the local folders with their remote prefixes in full, wait for the transfers and exit, non-zero if any failed or conflicted"},
+					&cli.DurationFlag{Name: "drain-timeout", Usage: "on SIGTERM wait up to `DURATION` (at least 1s) for transfers in progress, overrides DrainTimeout of the config and its reloads"},
+					&cli.StringFlag{Name: "http", Usage: "serve the REST API and web dashboard on `ADDRESS`, a bare port binds to localhost only"},
+					&cli.StringFlag{Name: "events", Usage: "stream watcher, sync, progress, error and conflict events to stdout in `FORMAT`: json"},
+					jsonFlag,
+				},
+			},
+			{
+				Name:      "watch-events",
+				Usage:     "Stream the events of the running sync as json lines",
+				Category:  "Sync",
+				ArgsUsage: "[setting...]",
+				Action:    WatchEvents,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{Name: "type", Usage: "only print events of `TYPE`: watch, sync_start, sync_complete, progress, error or conflict"},
+				},
+			},
+			{
+				Name:     "install-service",
+				Usage:    "Install a systemd user service running sync with this config",
+				Category: "Daemon",
+				Action:   InstallService,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "name", Value: "osssync", Usage: "unit `NAME`"},
+					&cli.BoolFlag{Name: "socket", Usage: "also install a socket unit starting the service when the control socket is used"},
+					&cli.DurationFlag{Name: "watchdog", Value: time.Minute, Usage: "restart the service if it stops responding for `DURATION`"},
+					&cli.DurationFlag{Name: "stop-timeout", Value: 90 * time.Second, Usage: "give the service `DURATION` to finish transfers when stopping"},
+					&cli.BoolFlag{Name: "force", Usage: "overwrite existing unit files"},
+					&cli.BoolFlag{Name: "print", Usage: "print the units instead of writing them"},
+				},
+			},
+			{
+				Name:      "trigger",
+				Usage:     "Make the running sync upload every file of the settings now",
+				Category:  "Daemon",
+				ArgsUsage: "[setting...]",
+				Action:    Trigger,
+			},
+			{
+				Name:      "pause",
+				Usage:     "Pause the running sync, file changes keep being queued",
+				Category:  "Daemon",
+				ArgsUsage: "[setting...]",
+				Action:    Pause,
+			},
+			{
+				Name:      "resume",
+				Usage:     "Resume the paused sync",
+				Category:  "Daemon",
+				ArgsUsage: "[setting...]",
+				Action:    Resume,
+			},
+			{
+				Name:     "reload",
+				Usage:    "Make the running sync read its config file again, restarting only the settings which changed",
+				Category: "Daemon",
+				Action:   Reload,
+				Flags:    []cli.Flag{jsonFlag},
+			},
+			{
+				Name:     "transfers",
+				Usage:    "List the transfers of the running sync",
+				Category: "Daemon",
+				Action:   Transfers,
+				Flags:    []cli.Flag{jsonFlag},
+			},
+			{
+				Name:      "status",
+				Usage:     "Show watcher health, queued events, transfers, last sync and errors per setting",
+				Category:  "Sync",
+				ArgsUsage: "[setting...]",
+				Action:    Status,
+				Flags:     []cli.Flag{jsonFlag},
+			},
+			{
+				Name:      "diff",
+				Usage:     "List files only local, only remote or different between the local folder and the remote prefix",
+				Category:  "Sync",
+				ArgsUsage: "<setting>",
+				Action:    Diff,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "hash", Usage: "compare crc64 of files with the same size instead of modification times"},
+					&cli.StringSliceFlag{Name: "only", Usage: "only print `KIND`: only-local, only-remote or different"},
+					&cli.BoolFlag{Name: "human-readable", Aliases: []string{"H"}, Usage: "print sizes like 1.2MiB"},
+					jsonFlag,
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Compare hashes of local files with the remote metadata, an interrupted run continues where it stopped",
+				Category:  "Sync",
+				ArgsUsage: "<setting>",
+				Action:    Verify,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "algo", Value: "crc64", Usage: "hash `ALGORITHM`: crc64 or md5"},
+					&cli.BoolFlag{Name: "repair", Usage: "upload missing and mismatching files again"},
+					&cli.Float64Flag{Name: "rate", Usage: "verify at most `N` files per second, 0 is unlimited"},
+					&cli.Int64Flag{Name: "bwlimit", Usage: "hash at most `N` MiB per second, 0 is unlimited"},
+					&cli.IntFlag{Name: "parallel", Aliases: []string{"p"}, Value: 8, Usage: "verify up to `N` files at the same time"},
+					&cli.BoolFlag{Name: "restart", Usage: "start over instead of resuming an interrupted run"},
+					&cli.BoolFlag{Name: "verbose", Aliases: []string{"v"}, Usage: "print matching files too"},
+					&cli.BoolFlag{Name: "json", Usage: "print one json result per line"},
+				},
+			},
+			{
+				Name:     "doctor",
+				Usage:    "Check config, local folders, inotify limits, fuse, clock skew, endpoints, credentials and free disk",
+				Category: "Config",
+				Action:   Doctor,
+				Flags:    []cli.Flag{jsonFlag},
+			},
+			{
+				Name:     "config",
+				Usage:    "Inspect and edit settings",
+				Category: "Config",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List settings",
+						Action: ConfigList,
+						Flags:  []cli.Flag{jsonFlag},
+					},
+					{
+						Name:      "show",
+						Usage:     "Show a setting, secrets are masked",
+						ArgsUsage: "<setting>",
+						Action:    ConfigShow,
+						Flags:     []cli.Flag{jsonFlag},
+					},
+					{
+						Name:   "add",
+						Usage:  "Add a setting, AccessKeySecret is read from stdin unless given, without keys the credential chain is used",
+						Action: ConfigAdd,
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{Name: "name", Required: true},
+							&cli.StringFlag{Name: "local", Required: true, Usage: "absolute path of the local `FOLDER`"},
+							&cli.StringFlag{Name: "connection", Usage: "use the endpoint, credentials and default bucket of the `CONNECTION`"},
+							&cli.StringFlag{Name: "bucket", Usage: "required unless the connection has one"},
+							&cli.StringFlag{Name: "prefix", Required: true},
+							&cli.IntFlag{Name: "weight"},
+							&cli.BoolFlag{Name: "ignore-hidden-files"},
+							&cli.BoolFlag{Name: "delete", Usage: "delete remote files when local files are deleted"},
+							keyringFlag,
+						}, accessFlags()...),
+					},
+					{
+						Name:      "set",
+						Usage:     "Set fields of a setting, or global fields like Concurrency without a setting, value - reads stdin",
+						ArgsUsage: "[setting] <field=value>...",
+						Action:    ConfigSet,
+						Flags:     []cli.Flag{keyringFlag},
+					},
+					{
+						Name:      "remove",
+						Usage:     "Remove a setting",
+						ArgsUsage: "<setting>",
+						Action:    ConfigRemove,
+						Flags:     []cli.Flag{yesFlag},
+					},
+					{
+						Name:  "connection",
+						Usage: "Manage connections, endpoints and credentials shared by settings",
+						Subcommands: []*cli.Command{
+							{
+								Name:   "list",
+								Usage:  "List connections and the settings using them",
+								Action: ConnectionList,
+								Flags:  []cli.Flag{jsonFlag},
+							},
+							{
+								Name:   "add",
+								Usage:  "Add a connection, AccessKeySecret is read from stdin unless given, without keys the credential chain is used",
+								Action: ConnectionAdd,
+								Flags: append([]cli.Flag{
+									&cli.StringFlag{Name: "name", Required: true},
+									&cli.StringFlag{Name: "bucket", Usage: "default bucket of the settings using the connection"},
+									keyringFlag,
+								}, accessFlags()...),
+							},
+							{
+								Name:      "set",
+								Usage:     "Set fields of a connection, e.g. rotate its keys for every setting using it, value - reads stdin",
+								ArgsUsage: "<connection> <field=value>...",
+								Action:    ConnectionSet,
+								Flags:     []cli.Flag{keyringFlag},
+							},
+							{
+								Name:      "remove",
+								Usage:     "Remove a connection no setting uses",
+								ArgsUsage: "<connection>",
+								Action:    ConnectionRemove,
+								Flags:     []cli.Flag{yesFlag},
+							},
+						},
+					},
+					{
+						Name:      "validate",
+						Usage:     "Check the config and test credentials: bucket info, list prefix, put and delete a probe object",
+						ArgsUsage: "[setting...]",
+						Action:    ConfigValidate,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "offline", Usage: "don't test credentials"},
+						},
+					},
+				},
+			},
+			{
+				Name:      "mount",
+				Usage:     "Mount the remote prefix of a setting in the foreground, unmounted on SIGINT or SIGTERM",
+				Category:  "Mount",
+				ArgsUsage: "<setting> <mountpoint>",
+				Action:    Mount,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "read-only", Aliases: []string{"ro"}, Usage: "mount read only"},
+					&cli.BoolFlag{Name: "allow-other", Usage: "allow other users to access the mount, needs user_allow_other in /etc/fuse.conf"},
+					&cli.StringFlag{Name: "cache-dir", Usage: "buffer files being written in `DIR`"},
+					&cli.BoolFlag{Name: "debug", Usage: "log every fuse request"},
+				},
+			},
+			{
+				Name:      "umount",
+				Usage:     "Unmount a mountpoint",
+				Category:  "Mount",
+				ArgsUsage: "<mountpoint>",
+				Action:    Umount,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "lazy", Aliases: []string{"z"}, Usage: "detach even if files are in use"},
+				},
+			},
+			{
+				Name:      "ls",
+				Usage:     "List remote files of a setting",
+				Category:  "Remote",
+				ArgsUsage: "<setting> [path]",
+				Action:    Ls,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "long", Aliases: []string{"l"}, Usage: "show size, modification time and etag"},
+					&cli.BoolFlag{Name: "recursive", Aliases: []string{"R"}, Usage: "list sub directories recursively"},
+					&cli.BoolFlag{Name: "human-readable", Aliases: []string{"H"}, Usage: "print sizes like 1.2MiB"},
+					&cli.StringFlag{Name: "sort", Value: "name", Usage: "sort by `KEY`: name, size or time"},
+					&cli.BoolFlag{Name: "reverse", Aliases: []string{"r"}, Usage: "reverse sort order"},
+					jsonFlag,
+				},
+			},
+			{
+				Name:      "stat",
+				Usage:     "Show size, etag, modification time and metadata of a remote file",
+				Category:  "Remote",
+				ArgsUsage: "<setting> <path>",
+				Action:    Stat,
+				Flags:     []cli.Flag{jsonFlag},
+			},
+			{
+				Name:      "cat",
+				Usage:     "Write a remote file to stdout",
+				Category:  "Remote",
+				ArgsUsage: "<setting> <path>",
+				Action:    Cat,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "range", Usage: "byte `RANGE` to read, e.g. 0-1023, 1024- or -512"},
+					jsonFlag,
+				},
+			},
+			{
+				Name:      "du",
+				Usage:     "Summarize object count and bytes per remote directory",
+				Category:  "Remote",
+				ArgsUsage: "<setting> [path]",
+				Action:    Du,
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "depth", Aliases: []string{"d"}, Value: 1, Usage: "summarize directories up to `N` levels deep, 0 prints the total only"},
+					&cli.BoolFlag{Name: "human-readable", Aliases: []string{"H"}, Usage: "print sizes like 1.2MiB"},
+					jsonFlag,
+				},
+			},
+			{
+				Name:      "cp",
+				Usage:     "Copy files between the local disk and the remote, remote paths are written oss:path",
+				Category:  "Remote",
+				ArgsUsage: "<setting> <src> <dst>",
+				Action:    Cp,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "recursive", Aliases: []string{"r"}, Usage: "copy the contents of a directory"},
+					&cli.IntFlag{Name: "parallel", Aliases: []string{"p"}, Value: 4, Usage: "transfer up to `N` files at the same time"},
+					&cli.BoolFlag{Name: "quiet", Aliases: []string{"q"}, Usage: "don't print progress"},
+					&cli.BoolFlag{Name: "verbose", Aliases: []string{"v"}, Usage: "print every progress event"},
+					yesFlag,
+				},
+			},
+			{
+				Name:      "mv",
+				Usage:     "Move a remote file or directory",
+				Category:  "Remote",
+				ArgsUsage: "<setting> <src> <dst>",
+				Action:    Mv,
+				Flags:     []cli.Flag{yesFlag},
+			},
+			{
+				Name:      "rm",
+				Usage:     "Delete remote files",
+				Category:  "Remote",
+				ArgsUsage: "<setting> <path>...",
+				Action:    Rm,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "recursive", Aliases: []string{"r"}, Usage: "delete directories and their contents"},
+					yesFlag,
+				},
 			},
 		},
 	}
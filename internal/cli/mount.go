@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg/fs/mount"
+)
+
+// Mount serves a setting at a mountpoint in the foreground until SIGINT or SIGTERM.
+func Mount(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" || c.Args().Get(1) == "" {
+		return errors.New("usage: mount <setting> <mountpoint>")
+	}
+	setting, ok := service.Config().FindSetting(name)
+	if !ok {
+		return fmt.Errorf("setting %s not found", name)
+	}
+	mountpoint, err := filepath.Abs(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	mounter, err := sync.MountAt(c.Context, &setting, mountpoint,
+		mount.WithReadOnly(c.Bool("read-only")),
+		mount.WithAllowOther(c.Bool("allow-other")),
+		mount.WithCacheDir(c.String("cache-dir")),
+		mount.WithDebug(c.Bool("debug")),
+	)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.ErrWriter, "mounted %s at %s, press Ctrl+C to unmount\n", setting.DisplayName(), mountpoint)
+	for {
+		select {
+		case <-mounter.Done():
+			return nil
+		case <-sigCh:
+			if err := mounter.Unmount(); err != nil {
+				fmt.Fprintf(c.App.ErrWriter, "unmount %s: %v, close the files in use and try again\n", mountpoint, err)
+				continue
+			}
+			return nil
+		}
+	}
+}
+
+func Umount(c *cli.Context) error {
+	mountpoint := c.Args().First()
+	if mountpoint == "" {
+		return errors.New("mountpoint is required")
+	}
+	return mount.Unmount(mountpoint, c.Bool("lazy"))
+}
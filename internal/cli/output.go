@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+)
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+func formatSize(size int64, human bool) string {
+	if !human {
+		return fmt.Sprintf("%d", size)
+	}
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// confirm asks a yes/no question on the app reader, --yes answers it up front.
+func confirm(c *cli.Context, format string, args ...any) bool {
+	if c.Bool("yes") {
+		return true
+	}
+	fmt.Fprintf(c.App.ErrWriter, format+" [y/N] ", args...)
+	answer, _ := bufio.NewReader(c.App.Reader).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// printNDJSON writes v as a single json line.
+func printNDJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
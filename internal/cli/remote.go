@@ -0,0 +1,384 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/service"
+	ossFS "github.com/bububa/osssync/pkg/fs/oss"
+)
+
+var jsonFlag = &cli.BoolFlag{
+	Name:  "json",
+	Usage: "print machine readable json",
+}
+
+type remoteEntry struct {
+	Path    string     `json:"path"`
+	Name    string     `json:"name"`
+	IsDir   bool       `json:"is_dir"`
+	Size    int64      `json:"size"`
+	ModTime *time.Time `json:"mod_time,omitempty"`
+	ETag    string     `json:"etag,omitempty"`
+}
+
+func newRemoteEntry(entry iofs.DirEntry) remoteEntry {
+	ret := remoteEntry{
+		Name:  entry.Name(),
+		IsDir: entry.IsDir(),
+	}
+	if v, ok := entry.(*ossFS.DirEntry); ok {
+		ret.Path = v.Path()
+		ret.ETag = strings.Trim(v.ETag(), `"`)
+	}
+	if info, err := entry.Info(); err == nil && !ret.IsDir {
+		modTime := info.ModTime()
+		ret.Size = info.Size()
+		ret.ModTime = &modTime
+	}
+	return ret
+}
+
+// remoteArgs returns the setting name and the path relative to the setting prefix.
+func remoteArgs(c *cli.Context, pathRequired bool) (string, string, error) {
+	name := c.Args().Get(0)
+	if name == "" {
+		return "", "", errors.New("setting name is required")
+	}
+	path := c.Args().Get(1)
+	if pathRequired && path == "" {
+		return "", "", errors.New("path is required")
+	}
+	return name, strings.TrimPrefix(filepath.ToSlash(path), "/"), nil
+}
+
+func Ls(c *cli.Context) error {
+	name, dir, err := remoteArgs(c, false)
+	if err != nil {
+		return err
+	}
+	_, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	entries, err := listRemote(c.Context, ossFS.NewReadDirFS(fs), dir, c.Bool("recursive"))
+	if err != nil {
+		return err
+	}
+	sortEntries(entries, c.String("sort"), c.Bool("reverse"))
+	w := c.App.Writer
+	if c.Bool("json") {
+		return printJSON(w, entries)
+	}
+	if !c.Bool("long") {
+		for _, entry := range entries {
+			fmt.Fprintln(w, displayPath(entry, c.Bool("recursive")))
+		}
+		return nil
+	}
+	tw := newTabWriter(w)
+	for _, entry := range entries {
+		size, modTime := "-", "-"
+		if !entry.IsDir {
+			size = formatSize(entry.Size, c.Bool("human-readable"))
+			modTime = entry.ModTime.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", size, modTime, entry.ETag, displayPath(entry, c.Bool("recursive")))
+	}
+	return tw.Flush()
+}
+
+func displayPath(entry remoteEntry, recursive bool) string {
+	name := entry.Name
+	if recursive {
+		name = entry.Path
+	}
+	if entry.IsDir {
+		name += "/"
+	}
+	return name
+}
+
+func listRemote(ctx context.Context, fs *ossFS.ReadDirFS, dir string, recursive bool) ([]remoteEntry, error) {
+	list, err := fs.ReadDir(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]remoteEntry, 0, len(list))
+	for _, v := range list {
+		entry := newRemoteEntry(v)
+		entries = append(entries, entry)
+		if recursive && entry.IsDir {
+			children, err := listRemote(ctx, fs, entry.Path, recursive)
+			if err != nil {
+				return entries, err
+			}
+			entries = append(entries, children...)
+		}
+	}
+	return entries, nil
+}
+
+func sortEntries(entries []remoteEntry, by string, reverse bool) {
+	less := func(a, b remoteEntry) bool {
+		switch by {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "time":
+			if a.ModTime != nil && b.ModTime != nil && !a.ModTime.Equal(*b.ModTime) {
+				return a.ModTime.Before(*b.ModTime)
+			}
+		}
+		return a.Path < b.Path
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if reverse {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+}
+
+type remoteStat struct {
+	Path         string            `json:"path"`
+	IsDir        bool              `json:"is_dir"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag,omitempty"`
+	ModTime      *time.Time        `json:"mod_time,omitempty"`
+	ContentType  string            `json:"content_type,omitempty"`
+	StorageClass string            `json:"storage_class,omitempty"`
+	CRC64        string            `json:"crc64,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+func Stat(c *cli.Context) error {
+	name, path, err := remoteArgs(c, true)
+	if err != nil {
+		return err
+	}
+	_, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	ret := remoteStat{Path: path}
+	header, err := fs.Meta(c.Context, path)
+	if errors.Is(err, iofs.ErrNotExist) {
+		entries, err := ossFS.NewReadDirFS(fs).ReadDir(c.Context, path)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("%s: %w", path, iofs.ErrNotExist)
+		}
+		ret.IsDir = true
+	} else if err != nil {
+		return err
+	} else {
+		info := ossFS.NewFileInfoWithHeader(path, header)
+		modTime := info.ModTime()
+		ret.Size = info.Size()
+		ret.ModTime = &modTime
+		ret.ETag = strings.Trim(info.ETag(), `"`)
+		ret.ContentType = header.Get(oss.HTTPHeaderContentType)
+		ret.StorageClass = header.Get(oss.HTTPHeaderOssStorageClass)
+		ret.CRC64 = header.Get(oss.HTTPHeaderOssCRC64)
+		for k := range header {
+			if strings.HasPrefix(strings.ToLower(k), strings.ToLower(oss.HTTPHeaderOssMetaPrefix)) {
+				if ret.Metadata == nil {
+					ret.Metadata = make(map[string]string)
+				}
+				ret.Metadata[k[len(oss.HTTPHeaderOssMetaPrefix):]] = header.Get(k)
+			}
+		}
+	}
+	w := c.App.Writer
+	if c.Bool("json") {
+		return printJSON(w, ret)
+	}
+	tw := newTabWriter(w)
+	fmt.Fprintf(tw, "Path:\t%s\n", ret.Path)
+	if ret.IsDir {
+		fmt.Fprintf(tw, "Type:\tdirectory\n")
+		return tw.Flush()
+	}
+	fmt.Fprintf(tw, "Type:\tfile\n")
+	fmt.Fprintf(tw, "Size:\t%d\n", ret.Size)
+	fmt.Fprintf(tw, "ETag:\t%s\n", ret.ETag)
+	fmt.Fprintf(tw, "Modified:\t%s\n", ret.ModTime.Local().Format(time.RFC3339))
+	fmt.Fprintf(tw, "Content-Type:\t%s\n", ret.ContentType)
+	fmt.Fprintf(tw, "Storage-Class:\t%s\n", ret.StorageClass)
+	fmt.Fprintf(tw, "CRC64:\t%s\n", ret.CRC64)
+	keys := make([]string, 0, len(ret.Metadata))
+	for k := range ret.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "Meta-%s:\t%s\n", k, ret.Metadata[k])
+	}
+	return tw.Flush()
+}
+
+// parseRange parses "start-end", "start-" or "-suffix" byte ranges, end is inclusive.
+func parseRange(str string, size int64) (int64, int64, error) {
+	if str == "" {
+		return 0, 0, nil
+	}
+	start, end, ok := strings.Cut(str, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %s", str)
+	}
+	if start == "" {
+		suffix, err := strconv.ParseInt(end, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, fmt.Errorf("invalid range %s", str)
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, nil
+	}
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("invalid range %s", str)
+	}
+	if end == "" {
+		return offset, 0, nil
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil || last < offset {
+		return 0, 0, fmt.Errorf("invalid range %s", str)
+	}
+	return offset, last - offset + 1, nil
+}
+
+func Cat(c *cli.Context) error {
+	name, path, err := remoteArgs(c, true)
+	if err != nil {
+		return err
+	}
+	_, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	var size int64
+	if strings.HasPrefix(c.String("range"), "-") {
+		info, err := fs.Stat(c.Context, path)
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+	}
+	offset, length, err := parseRange(c.String("range"), size)
+	if err != nil {
+		return err
+	}
+	body, err := fs.OpenRange(c.Context, path, offset, length)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	w := c.App.Writer
+	if !c.Bool("json") {
+		_, err := io.Copy(w, body)
+		return err
+	}
+	bs, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return printJSON(w, map[string]any{
+		"path":   path,
+		"offset": offset,
+		"length": len(bs),
+		"data":   base64.StdEncoding.EncodeToString(bs),
+	})
+}
+
+type duEntry struct {
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+func Du(c *cli.Context) error {
+	name, dir, err := remoteArgs(c, false)
+	if err != nil {
+		return err
+	}
+	_, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	depth := c.Int("depth")
+	root := strings.Trim(dir, "/")
+	mp := make(map[string]*duEntry)
+	total := duEntry{Path: "."}
+	if root != "" {
+		total.Path = root
+	}
+	if err := fs.Walk(c.Context, dir, func(info *ossFS.FileInfo) error {
+		total.Count++
+		total.Bytes += info.Size()
+		if depth <= 0 {
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(info.Path(), root), "/")
+		parts := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+		if parts[0] == "." {
+			return nil
+		}
+		if len(parts) > depth {
+			parts = parts[:depth]
+		}
+		key := filepath.ToSlash(filepath.Join(root, strings.Join(parts, "/")))
+		entry, ok := mp[key]
+		if !ok {
+			entry = &duEntry{Path: key}
+			mp[key] = entry
+		}
+		entry.Count++
+		entry.Bytes += info.Size()
+		return nil
+	}); err != nil {
+		return err
+	}
+	dirs := make([]duEntry, 0, len(mp))
+	for _, v := range mp {
+		dirs = append(dirs, *v)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Path < dirs[j].Path
+	})
+	w := c.App.Writer
+	if c.Bool("json") {
+		return printJSON(w, map[string]any{
+			"dirs":  dirs,
+			"total": total,
+		})
+	}
+	human := c.Bool("human-readable")
+	tw := newTabWriter(w)
+	for _, v := range append(dirs, total) {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", v.Count, formatSize(v.Bytes, human), v.Path)
+	}
+	return tw.Flush()
+}
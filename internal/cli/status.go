@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg/watcher"
+)
+
+type statusReport struct {
+	// Daemon is false when no daemon is running and the status comes from a one-off comparison
+	Daemon   bool            `json:"daemon"`
+	PID      int             `json:"pid,omitempty"`
+	Settings []settingStatus `json:"settings"`
+}
+
+type settingStatus struct {
+	sync.Status
+	Pending            *pendingSummary `json:"pending,omitempty"`
+	InterruptedUploads int             `json:"interrupted_uploads,omitempty"`
+	CompareError       string          `json:"compare_error,omitempty"`
+	// DeadLetterItems are read from the dead-letter file, the daemon only reports their count
+	DeadLetterItems []sync.DeadLetter `json:"dead_letter_items,omitempty"`
+}
+
+type pendingSummary struct {
+	OnlyLocal  int `json:"only_local"`
+	OnlyRemote int `json:"only_remote"`
+	Different  int `json:"different"`
+}
+
+func (p *pendingSummary) InSync() bool {
+	return p.OnlyLocal == 0 && p.OnlyRemote == 0 && p.Different == 0
+}
+
+func Status(c *cli.Context) error {
+	settings, err := service.Config().SelectSettings(c.Args().Slice())
+	if err != nil {
+		return err
+	}
+	report, err := daemonStatus(c.Context, settings)
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		report = compareStatus(c, settings)
+	}
+	if c.Bool("json") {
+		return printJSON(c.App.Writer, report)
+	}
+	if report.Daemon {
+		printDaemonStatus(c, report)
+	} else {
+		printCompareStatus(c, report)
+	}
+	return nil
+}
+
+func daemonStatus(ctx context.Context, settings []config.Setting) (*statusReport, error) {
+	pid := service.RunningPID()
+	if pid == 0 {
+		return nil, nil
+	}
+	report, err := sync.ReadStatusReport(service.Instance())
+	if err != nil {
+		return nil, err
+	}
+	// the report is a few seconds old, prefer asking the daemon
+	if statuses, err := service.Client().Status(ctx); err == nil {
+		report = &sync.StatusReport{Settings: statuses}
+	} else if report == nil {
+		// the daemon is starting and has written no report yet
+		report = new(sync.StatusReport)
+	}
+	keys := make(map[string]*config.Setting, len(settings))
+	for idx := range settings {
+		keys[settings[idx].Key()] = &settings[idx]
+	}
+	ret := &statusReport{Daemon: true, PID: pid}
+	for _, status := range report.Settings {
+		if setting, ok := keys[status.Key]; ok {
+			items, _ := sync.ReadDeadLetters(setting)
+			ret.Settings = append(ret.Settings, settingStatus{Status: status, DeadLetterItems: items})
+		}
+	}
+	return ret, nil
+}
+
+func compareStatus(c *cli.Context, settings []config.Setting) *statusReport {
+	ret := &statusReport{Settings: make([]settingStatus, 0, len(settings))}
+	for _, setting := range settings {
+		status := settingStatus{
+			Status: sync.Status{
+				Name:    setting.DisplayName(),
+				Key:     setting.Key(),
+				Watcher: sync.WatcherStopped,
+				Queued:  watcher.NewQueue(watcher.DefaultQueueSize, sync.QueuePath(&setting)).Len(),
+			},
+		}
+		status.DeadLetterItems, _ = sync.ReadDeadLetters(&setting)
+		status.DeadLetters = len(status.DeadLetterItems)
+		fs, err := sync.NewFS(&setting)
+		if err != nil {
+			status.CompareError = err.Error()
+			ret.Settings = append(ret.Settings, status)
+			continue
+		}
+		if cps, err := fs.UploadCheckpoints(); err == nil {
+			status.InterruptedUploads = len(cps)
+		}
+		if diffs, err := sync.Compare(c.Context, &setting, fs); err != nil {
+			status.CompareError = err.Error()
+		} else {
+			status.Pending = new(pendingSummary)
+			for _, diff := range diffs {
+				switch diff.Kind {
+				case sync.DiffOnlyLocal:
+					status.Pending.OnlyLocal++
+				case sync.DiffOnlyRemote:
+					status.Pending.OnlyRemote++
+				case sync.DiffDifferent:
+					status.Pending.Different++
+				}
+			}
+		}
+		fs.Close()
+		ret.Settings = append(ret.Settings, status)
+	}
+	return ret
+}
+
+func printDaemonStatus(c *cli.Context, report *statusReport) {
+	fmt.Fprintf(c.App.Writer, "daemon running, pid %d", report.PID)
+	// dropped events are counted for the whole daemon
+	if len(report.Settings) > 0 && report.Settings[0].DroppedEvents > 0 {
+		fmt.Fprintf(c.App.Writer, ", %d events dropped for slow consumers", report.Settings[0].DroppedEvents)
+	}
+	fmt.Fprint(c.App.Writer, "\n\n")
+	w := newTabWriter(c.App.Writer)
+	fmt.Fprintln(w, "NAME\tWATCHER\tSTATE\tQUEUED\tSPILLED\tTRANSFERS\tLAST SYNC\tERRORS\tDEAD\tDROPPED PROGRESS")
+	for _, s := range report.Settings {
+		state := "idle"
+		if s.Paused {
+			state = "paused"
+		} else if s.Syncing {
+			state = "syncing"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%d\t%d\t%d\n", s.Name, s.Watcher, state, s.Queued, s.Spilled, len(s.Transfers), formatTime(s.LastSync), s.Errors, s.DeadLetters, s.DroppedProgress)
+	}
+	w.Flush()
+	for _, s := range report.Settings {
+		printStatusDetails(c, s)
+	}
+}
+
+func printCompareStatus(c *cli.Context, report *statusReport) {
+	fmt.Fprintln(c.App.Writer, "no running daemon, compared local and remote files")
+	fmt.Fprintln(c.App.Writer)
+	w := newTabWriter(c.App.Writer)
+	fmt.Fprintln(w, "NAME\tSTATE\tONLY LOCAL\tONLY REMOTE\tDIFFERENT\tQUEUED\tINTERRUPTED\tDEAD")
+	for _, s := range report.Settings {
+		if s.Pending == nil {
+			fmt.Fprintf(w, "%s\terror\t-\t-\t-\t%d\t%d\t%d\n", s.Name, s.Queued, s.InterruptedUploads, s.DeadLetters)
+			continue
+		}
+		state := "in sync"
+		if !s.Pending.InSync() {
+			state = "out of sync"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n", s.Name, state, s.Pending.OnlyLocal, s.Pending.OnlyRemote, s.Pending.Different, s.Queued, s.InterruptedUploads, s.DeadLetters)
+	}
+	w.Flush()
+	for _, s := range report.Settings {
+		printStatusDetails(c, s)
+	}
+}
+
+func printStatusDetails(c *cli.Context, s settingStatus) {
+	var lines []string
+	if s.WatchError != "" {
+		lines = append(lines, "watcher: "+s.WatchError)
+	}
+	if s.LastError != "" {
+		lines = append(lines, "last error: "+s.LastError)
+	}
+	if s.CompareError != "" {
+		lines = append(lines, "compare: "+s.CompareError)
+	}
+	for _, t := range s.Transfers {
+		lines = append(lines, fmt.Sprintf("%s %s -> %s %s/%s (%.1f%%)", t.Op, t.Src, t.Dist, formatSize(t.ConsumedBytes, true), formatSize(t.TotalBytes, true), t.Progress()))
+	}
+	for _, d := range s.DeadLetterItems {
+		lines = append(lines, fmt.Sprintf("dead: %s %s after %d attempts: %s", d.Op, d.Path, d.Attempts, d.Error))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(c.App.Writer, "\n%s:\n  %s\n", s.Name, strings.Join(lines, "\n  "))
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(time.DateTime)
+}
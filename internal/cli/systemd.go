@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/config/template"
+	"github.com/bububa/osssync/internal/service"
+)
+
+type unitData struct {
+	Name        string
+	Exec        string
+	Config      string
+	Socket      bool
+	SocketPath  string
+	SocketName  string
+	Watchdog    int
+	TimeoutStop int
+}
+
+// InstallService writes a systemd user unit running sync with the config in use, and optionally a socket unit for the control socket.
+func InstallService(c *cli.Context) error {
+	if runtime.GOOS != "linux" {
+		return errors.New("systemd services are only supported on linux")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	configPath, err := service.ConfigPath()
+	if err != nil {
+		return err
+	}
+	if configPath, err = filepath.Abs(configPath); err != nil {
+		return err
+	}
+	data := unitData{
+		Name:        c.String("name"),
+		Exec:        exe,
+		Config:      configPath,
+		Socket:      c.Bool("socket"),
+		SocketPath:  service.SocketPath(),
+		SocketName:  service.ControlSocketName,
+		Watchdog:    int(c.Duration("watchdog") / time.Second),
+		TimeoutStop: int(c.Duration("stop-timeout") / time.Second),
+	}
+	units := map[string]string{data.Name + ".service": "systemd.service.tpl"}
+	if data.Socket {
+		units[data.Name+".socket"] = "systemd.socket.tpl"
+	}
+	dir := filepath.Join(xdg.ConfigHome, "systemd", "user")
+	for _, unit := range []string{data.Name + ".service", data.Name + ".socket"} {
+		tpl, ok := units[unit]
+		if !ok {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := template.Template().ExecuteTemplate(&buf, tpl, data); err != nil {
+			return err
+		}
+		if c.Bool("print") {
+			fmt.Fprintf(c.App.Writer, "# %s\n%s\n", unit, buf.String())
+			continue
+		}
+		path := filepath.Join(dir, unit)
+		if _, err := os.Stat(path); err == nil && !c.Bool("force") {
+			return fmt.Errorf("%s exists, use --force to overwrite it", path)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.App.Writer, "wrote %s\n", path)
+	}
+	if c.Bool("print") {
+		return nil
+	}
+	fmt.Fprintf(c.App.Writer, "\nenable it with:\n  systemctl --user daemon-reload\n  systemctl --user enable --now %s.service\n", data.Name)
+	return nil
+}
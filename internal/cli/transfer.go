@@ -0,0 +1,358 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/atomic"
+
+	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/pkg/fs/local"
+	ossFS "github.com/bububa/osssync/pkg/fs/oss"
+	"github.com/bububa/osssync/pkg/scheduler"
+)
+
+// RemotePrefix marks a cp argument as a path inside the setting prefix.
+const RemotePrefix = "oss:"
+
+var yesFlag = &cli.BoolFlag{
+	Name:    "yes",
+	Aliases: []string{"y"},
+	Usage:   "don't ask for confirmation before overwriting or deleting",
+}
+
+func parseLocation(arg string) (string, bool) {
+	if strings.HasPrefix(arg, RemotePrefix) {
+		return cleanRemoteArg(strings.TrimPrefix(arg, RemotePrefix)), true
+	}
+	return arg, false
+}
+
+func cleanRemoteArg(path string) string {
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+// remoteIsDir reports whether path is a directory, i.e. not an object itself but a prefix of other objects.
+func remoteIsDir(ctx context.Context, fs *ossFS.FS, path string) (bool, error) {
+	if _, err := fs.Meta(ctx, path); err == nil {
+		return false, nil
+	} else if !errors.Is(err, iofs.ErrNotExist) {
+		return false, err
+	}
+	entries, err := ossFS.NewReadDirFS(fs).ReadDir(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	if len(entries) == 0 {
+		return false, fmt.Errorf("%s%s: %w", RemotePrefix, path, iofs.ErrNotExist)
+	}
+	return true, nil
+}
+
+type transfer struct {
+	src  string
+	dist string
+	size int64
+	run  func(ctx context.Context) error
+}
+
+func Cp(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" || c.NArg() != 3 {
+		return errors.New("usage: cp <setting> <src> <dst>")
+	}
+	src, srcRemote := parseLocation(c.Args().Get(1))
+	dist, distRemote := parseLocation(c.Args().Get(2))
+	if srcRemote == distRemote {
+		return fmt.Errorf("exactly one of src and dst must be a remote %spath", RemotePrefix)
+	}
+	_, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	var transfers []transfer
+	if distRemote {
+		transfers, err = uploadTransfers(c, fs, src, dist)
+	} else {
+		transfers, err = downloadTransfers(c, fs, src, dist)
+	}
+	if err != nil {
+		fs.Close()
+		return err
+	}
+	return runTransfers(c, fs, transfers)
+}
+
+func uploadTransfers(c *cli.Context, fs *ossFS.FS, src string, dist string) ([]transfer, error) {
+	ctx := c.Context
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	upload := func(path string, fi os.FileInfo, target string) transfer {
+		info := local.NewFileInfo(fi, local.WithPath(path))
+		return transfer{
+			src:  path,
+			dist: RemotePrefix + target,
+			size: fi.Size(),
+			run: func(ctx context.Context) error {
+				return fs.UploadFileTo(ctx, info, target)
+			},
+		}
+	}
+	if !fi.IsDir() {
+		target := dist
+		if dist == "." || strings.HasSuffix(dist, "/") {
+			target = filepath.ToSlash(filepath.Join(dist, fi.Name()))
+		} else if isDir, err := remoteIsDir(ctx, fs, dist); err == nil && isDir {
+			target = filepath.ToSlash(filepath.Join(dist, fi.Name()))
+		}
+		if _, err := fs.Meta(ctx, target); err == nil && !confirm(c, "overwrite %s%s?", RemotePrefix, target) {
+			return nil, nil
+		}
+		return []transfer{upload(src, fi, target)}, nil
+	}
+	if !c.Bool("recursive") {
+		return nil, fmt.Errorf("%s is a directory, use -r to copy it", src)
+	}
+	if isDir, err := remoteIsDir(ctx, fs, dist); err == nil && isDir && !confirm(c, "%s%s exists, overwrite files inside it?", RemotePrefix, dist) {
+		return nil, nil
+	}
+	var transfers []transfer
+	err = filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		transfers = append(transfers, upload(path, fi, filepath.ToSlash(filepath.Join(dist, rel))))
+		return nil
+	})
+	return transfers, err
+}
+
+func downloadTransfers(c *cli.Context, fs *ossFS.FS, src string, dist string) ([]transfer, error) {
+	ctx := c.Context
+	isDir, err := remoteIsDir(ctx, fs, src)
+	if err != nil {
+		return nil, err
+	}
+	download := func(remote string, size int64, target string) transfer {
+		return transfer{
+			src:  RemotePrefix + remote,
+			dist: target,
+			size: size,
+			run: func(ctx context.Context) error {
+				return fs.DownloadTo(ctx, remote, target)
+			},
+		}
+	}
+	if !isDir {
+		target := dist
+		if fi, err := os.Stat(dist); (err == nil && fi.IsDir()) || strings.HasSuffix(dist, string(filepath.Separator)) {
+			target = filepath.Join(dist, filepath.Base(src))
+		}
+		if _, err := os.Stat(target); err == nil && !confirm(c, "overwrite %s?", target) {
+			return nil, nil
+		}
+		info, err := fs.Stat(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		return []transfer{download(src, info.Size(), target)}, nil
+	}
+	if !c.Bool("recursive") {
+		return nil, fmt.Errorf("%s%s is a directory, use -r to copy it", RemotePrefix, src)
+	}
+	if entries, err := os.ReadDir(dist); err == nil && len(entries) > 0 && !confirm(c, "%s is not empty, overwrite files inside it?", dist) {
+		return nil, nil
+	}
+	root := strings.Trim(src, "/")
+	if root == "." {
+		root = ""
+	}
+	var transfers []transfer
+	err = fs.Walk(ctx, src, func(info *ossFS.FileInfo) error {
+		rel := strings.TrimPrefix(strings.TrimPrefix(info.Path(), root), "/")
+		transfers = append(transfers, download(info.Path(), info.Size(), filepath.Join(dist, filepath.FromSlash(rel))))
+		return nil
+	})
+	return transfers, err
+}
+
+// runTransfers runs transfers in parallel, printing progress to the error writer, and closes fs.
+func runTransfers(c *cli.Context, fs *ossFS.FS, transfers []transfer) error {
+	var (
+		wg    sync.WaitGroup
+		quiet = c.Bool("quiet")
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ev := range fs.Events() {
+			if quiet || (ev.EventType == oss.TransferDataEvent && !c.Bool("verbose")) {
+				continue
+			}
+			fmt.Fprintln(c.App.ErrWriter, ev.String())
+		}
+	}()
+	sched := scheduler.New(c.Int("parallel"))
+	batch := sched.NewBatch(c.Context)
+	var (
+		copied = atomic.NewInt64(0)
+		bytes  = atomic.NewInt64(0)
+		mu     sync.Mutex
+		errs   []error
+	)
+	for _, t := range transfers {
+		batch.Submit(scheduler.Task{
+			Size: t.size,
+			Run: func(ctx context.Context) error {
+				if err := t.run(ctx); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s -> %s: %w", t.src, t.dist, err))
+					mu.Unlock()
+					return err
+				}
+				copied.Inc()
+				bytes.Add(t.size)
+				return nil
+			},
+		})
+	}
+	batch.Wait()
+	sched.Close()
+	fs.Close()
+	wg.Wait()
+	if !quiet {
+		fmt.Fprintf(c.App.ErrWriter, "copied %d/%d files, %s\n", copied.Load(), len(transfers), formatSize(bytes.Load(), true))
+	}
+	return errors.Join(errs...)
+}
+
+func Mv(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" || c.NArg() != 3 {
+		return errors.New("usage: mv <setting> <src> <dst>")
+	}
+	src, _ := parseLocation(c.Args().Get(1))
+	dist, _ := parseLocation(c.Args().Get(2))
+	src, dist = cleanRemoteArg(src), cleanRemoteArg(dist)
+	_, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	ctx := c.Context
+	isDir, err := remoteIsDir(ctx, fs, src)
+	if err != nil {
+		return err
+	}
+	if isDir {
+		if exists, _ := remoteIsDir(ctx, fs, dist); exists && !confirm(c, "%s%s exists, merge %s%s into it?", RemotePrefix, dist, RemotePrefix, src) {
+			return nil
+		}
+		return fs.RenameDir(ctx, src, dist)
+	}
+	if strings.HasSuffix(c.Args().Get(2), "/") {
+		dist = filepath.ToSlash(filepath.Join(dist, filepath.Base(src)))
+	}
+	if _, err := fs.Meta(ctx, dist); err == nil && !confirm(c, "overwrite %s%s?", RemotePrefix, dist) {
+		return nil
+	}
+	return fs.Rename(ctx, src, dist)
+}
+
+func Rm(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" || c.NArg() < 2 {
+		return errors.New("usage: rm <setting> <path>...")
+	}
+	_, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	ctx := c.Context
+	var (
+		files []string
+		dirs  []string
+		count int
+	)
+	for _, arg := range c.Args().Slice()[1:] {
+		path, _ := parseLocation(arg)
+		path = cleanRemoteArg(path)
+		isDir, err := remoteIsDir(ctx, fs, path)
+		if err != nil {
+			return err
+		}
+		if !isDir {
+			files = append(files, path)
+			count++
+			continue
+		}
+		if !c.Bool("recursive") {
+			return fmt.Errorf("%s%s is a directory, use -r to remove it", RemotePrefix, path)
+		}
+		if err := fs.Walk(ctx, path, func(fi *ossFS.FileInfo) error {
+			files = append(files, fi.Path())
+			count++
+			return nil
+		}); err != nil {
+			return err
+		}
+		dirs = append(dirs, path)
+	}
+	if !confirm(c, "delete %d remote objects, they can't be restored?", count) {
+		return nil
+	}
+	removed := make(map[string]struct{}, count)
+	for keys := range slices.Chunk(files, ossFS.MaxDeleteKeys) {
+		list, err := fs.Remove(ctx, keys...)
+		if err != nil {
+			return err
+		}
+		for _, key := range list {
+			removed[key] = struct{}{}
+		}
+	}
+	// the objects of the directories are removed by now, what is left are directory markers
+	for _, dir := range dirs {
+		list, err := fs.RemoveAll(ctx, dir)
+		for _, key := range list {
+			removed[key] = struct{}{}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var failed []string
+	for _, key := range files {
+		if _, ok := removed[fs.PathAddPrefix(key)]; !ok {
+			failed = append(failed, RemotePrefix+key)
+		}
+	}
+	fmt.Fprintf(c.App.ErrWriter, "removed %d objects\n", len(removed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d objects not deleted: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
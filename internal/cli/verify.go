@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bububa/osssync/internal/service"
+	"github.com/bububa/osssync/internal/service/sync"
+)
+
+func Verify(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return errors.New("setting name is required")
+	}
+	setting, fs, err := service.SettingFS(name)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	var (
+		counts  = make(map[sync.VerifyStatus]int)
+		failed  int
+		jsonOut = c.Bool("json")
+		verbose = c.Bool("verbose")
+	)
+	err = sync.Verify(c.Context, setting, fs, sync.VerifyOptions{
+		Algorithm: sync.VerifyAlgorithm(c.String("algo")),
+		Repair:    c.Bool("repair"),
+		Rate:      c.Float64("rate"),
+		Bandwidth: c.Int64("bwlimit") << 20,
+		Routines:  c.Int("parallel"),
+		Restart:   c.Bool("restart"),
+	}, func(res sync.VerifyResult) {
+		counts[res.Status]++
+		if res.Failed() {
+			failed++
+		}
+		if jsonOut {
+			printNDJSON(c.App.Writer, res)
+			return
+		}
+		if res.Status == sync.VerifyOK && !verbose {
+			return
+		}
+		line := fmt.Sprintf("%s\t%s", res.Status, res.Path)
+		if res.Error != "" {
+			line += "\t" + res.Error
+		} else if res.Status == sync.VerifyMismatch {
+			line += fmt.Sprintf("\tlocal:%s, remote:%s", res.Local, res.Remote)
+		}
+		fmt.Fprintln(c.App.Writer, line)
+	})
+	if !jsonOut {
+		fmt.Fprintf(c.App.ErrWriter, "%d ok, %d mismatch, %d missing, %d unverifiable, %d repaired, %d failed\n",
+			counts[sync.VerifyOK], counts[sync.VerifyMismatch], counts[sync.VerifyMissing], counts[sync.VerifyUnverifiable], counts[sync.VerifyRepaired], counts[sync.VerifyFailed])
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files don't match the remote", failed)
+	}
+	return nil
+}
@@ -4,18 +4,99 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"net"
+	"strings"
+	"time"
 )
 
 var EmptySetting Setting
 
+// DefaultDrainTimeout is how long stopping waits for transfers in progress unless the config says otherwise.
+const DefaultDrainTimeout = 30 * time.Second
+
 type Config struct {
-	Settings []Setting
+	// Concurrency is the maximum number of transfers running at the same time across all settings
+	Concurrency int
+	// DrainTimeout is how many seconds stopping waits for transfers in progress, defaults to DefaultDrainTimeout
+	DrainTimeout int
+	// HTTP configures the optional REST API and web dashboard
+	HTTP HTTP
+	// Connections are endpoints and credentials shared by the settings naming them
+	Connections []Connection
+	Settings    []Setting
+}
+
+// HTTP serves the REST API and web dashboard of the daemon, it is disabled unless Listen is set.
+type HTTP struct {
+	// Listen is the address to serve on, a missing host binds to localhost only
+	Listen string
+	// Token is required by every API request, one is generated and kept in the state dir if empty
+	Token    string
+	tokenRef secretRef
+}
+
+// Address is Listen with the host defaulting to 127.0.0.1, a bare port is accepted too.
+func (h HTTP) Address() (string, error) {
+	listen := h.Listen
+	if !strings.Contains(listen, ":") {
+		listen = ":" + listen
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Drain is how long stopping waits for transfers in progress before interrupting them.
+func (c *Config) Drain() time.Duration {
+	if c.DrainTimeout <= 0 {
+		return DefaultDrainTimeout
+	}
+	return time.Duration(c.DrainTimeout) * time.Second
+}
+
+// FindSetting looks a setting up by name, falling back to its key.
+func (c *Config) FindSetting(name string) (Setting, bool) {
+	for _, s := range c.Settings {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	for _, s := range c.Settings {
+		if s.Key() == name {
+			return s, true
+		}
+	}
+	return EmptySetting, false
+}
+
+// SelectSettings returns the settings named by names, or every setting if names is empty.
+func (c *Config) SelectSettings(names []string) ([]Setting, error) {
+	if len(names) == 0 {
+		return c.Settings, nil
+	}
+	ret := make([]Setting, 0, len(names))
+	for _, name := range names {
+		setting, ok := c.FindSetting(name)
+		if !ok {
+			return nil, fmt.Errorf("setting %s not found", name)
+		}
+		ret = append(ret, setting)
+	}
+	return ret, nil
 }
 
 type Setting struct {
 	Name  string `required:"true"`
 	Local string `required:"true"`
 	Credential
+	Multipart
+	// Weight is the share of transfer slots of this setting relative to the others, defaults to 1
+	Weight            int
 	IgnoreHiddenFiles bool
 	Delete            bool
 }
@@ -24,6 +105,30 @@ func (s Setting) Key() string {
 	return fmt.Sprintf("%s | %s", s.Local, s.BucketKey())
 }
 
+// MaskSecret keeps the last 4 characters of a secret so settings can be told apart.
+func MaskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", len(secret)-4) + secret[len(secret)-4:]
+}
+
+// Masked is a copy of the setting safe to display, with the secret masked or shown as the reference it came from.
+func (s Setting) Masked() Setting {
+	s.Access = s.Access.masked()
+	return s
+}
+
+func (a Access) masked() Access {
+	a.AccessKeyID = a.RawAccessKeyID()
+	if raw := a.RawAccessKeySecret(); raw != a.AccessKeySecret {
+		a.AccessKeySecret = raw
+	} else {
+		a.AccessKeySecret = MaskSecret(a.AccessKeySecret)
+	}
+	return a
+}
+
 func (s Setting) Mountpoint() string {
 	enc := md5.New()
 	enc.Write([]byte(s.Key()))
@@ -42,9 +147,45 @@ func (s Setting) DisplayName() string {
 }
 
 type Credential struct {
-	Endpoint        string `required:"true"`
-	AccessKeyID     string `required:"true"`
-	AccessKeySecret string `required:"true"`
-	Bucket          string `required:"true"`
-	Prefix          string `required:"true"`
+	// Connection names the [[Connections]] entry the endpoint, credentials and default bucket come from
+	Connection string
+	Access
+	Bucket string
+	Prefix string `required:"true"`
+	// connectionBucket is the bucket filled in from the connection, it isn't written back
+	connectionBucket string
+}
+
+// Access is an endpoint and the credentials to use it, given by a setting itself or by its connection.
+type Access struct {
+	Endpoint string
+	// AccessKeyID and AccessKeySecret are static keys, leave them empty to use the credential chain
+	AccessKeyID     string
+	AccessKeySecret string
+	// Provider is where credentials come from: chain, static, env, profile or ecs_role, see CredentialProvider
+	Provider string
+	// Profile is the Aliyun CLI profile used by the profile provider and the chain, defaults to the current one
+	Profile string
+	// ECSRole is the RAM role of the ECS instance used by the ecs_role provider and the chain, looked up if empty
+	ECSRole string
+	// RoleArn is a RAM role assumed through STS with the credentials of Provider, renewed before they expire
+	RoleArn         string
+	RoleSessionName string
+	// RoleDuration is how many seconds assumed role credentials are valid, defaults to an hour
+	RoleDuration int
+	// STSEndpoint is the STS endpoint for RoleArn, defaults to sts.aliyuncs.com
+	STSEndpoint string
+	// the secret references AccessKeyID and AccessKeySecret were resolved from
+	accessKeyIDRef     secretRef
+	accessKeySecretRef secretRef
+}
+
+// Multipart tunes resumable multipart uploads, zero values fall back to the defaults.
+type Multipart struct {
+	// MultipartThreshold is the file size in bytes from which multipart upload is used
+	MultipartThreshold int64
+	// PartSize is the size in bytes of each part
+	PartSize int64
+	// Routines is the number of parts uploaded concurrently
+	Routines int
 }
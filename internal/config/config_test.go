@@ -0,0 +1,46 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTTPAddress(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   string
+		err    bool
+	}{
+		{listen: "8080", want: "127.0.0.1:8080"},
+		{listen: ":8080", want: "127.0.0.1:8080"},
+		{listen: "0.0.0.0:8080", want: "0.0.0.0:8080"},
+		{listen: "localhost:9000", want: "localhost:9000"},
+		{listen: "[::1]:8080", want: "[::1]:8080"},
+		{listen: "[::]:8080", want: "[::]:8080"},
+		{listen: "::1:8080", err: true},
+	}
+	for _, tt := range tests {
+		got, err := HTTP{Listen: tt.listen}.Address()
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", tt.listen, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %s %v, want %s", tt.listen, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidatePartSize(t *testing.T) {
+	setting := Setting{Name: "docs", Local: t.TempDir(), Credential: Credential{Bucket: "bucket", Prefix: "docs", Access: Access{Endpoint: "oss-cn-hangzhou.aliyuncs.com"}}}
+	setting.PartSize = 1024
+	if err := setting.Validate(); err == nil || !strings.Contains(err.Error(), "PartSize") {
+		t.Fatalf("expected a part size below the OSS minimum to fail, got %v", err)
+	}
+	setting.PartSize = 100 << 10
+	if err := setting.Validate(); err != nil && strings.Contains(err.Error(), "PartSize") {
+		t.Fatalf("expected the OSS minimum to pass, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Connection is an endpoint and credentials shared by the settings naming it in their Connection field,
+// so rotating a key is a single edit. Settings using it get its Access and, unless they set one, its Bucket.
+type Connection struct {
+	Name string `required:"true"`
+	Access
+	// Bucket is the default bucket of the settings using the connection
+	Bucket string
+}
+
+// Masked is a copy of the connection safe to display, see Setting.Masked.
+func (c Connection) Masked() Connection {
+	c.Access = c.Access.masked()
+	return c
+}
+
+// FindConnection looks a connection up by name.
+func (c *Config) FindConnection(name string) (Connection, bool) {
+	for _, conn := range c.Connections {
+		if conn.Name == name {
+			return conn, true
+		}
+	}
+	return Connection{}, false
+}
+
+// ApplyConnection copies the endpoint, credentials and default bucket of the connection of s into it.
+// It is a no-op for settings without a connection.
+func (c *Config) ApplyConnection(s *Setting) error {
+	if s.Connection == "" {
+		return nil
+	}
+	conn, ok := c.FindConnection(s.Connection)
+	if !ok {
+		return fmt.Errorf("connection %s not found", s.Connection)
+	}
+	s.Access = conn.Access
+	if s.Bucket == "" || s.Bucket == s.connectionBucket {
+		s.Bucket = conn.Bucket
+		s.connectionBucket = conn.Bucket
+	}
+	return nil
+}
+
+// ApplyConnections applies the connections of all settings, after ResolveSecrets so they get the resolved secrets.
+func (c *Config) ApplyConnections() error {
+	var errs []error
+	for idx := range c.Settings {
+		if err := c.ApplyConnection(&c.Settings[idx]); err != nil {
+			errs = append(errs, fmt.Errorf("setting %s: %w", c.Settings[idx].DisplayName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Resolve prepares a loaded config for use: secret references are resolved and connections applied.
+func (c *Config) Resolve() error {
+	if err := c.ResolveSecrets(); err != nil {
+		return err
+	}
+	return c.ApplyConnections()
+}
+
+// RawBucket is Bucket as written in the config file, empty if it comes from the connection.
+func (c Credential) RawBucket() string {
+	if c.Connection != "" && c.Bucket == c.connectionBucket {
+		return ""
+	}
+	return c.Bucket
+}
+
+// Set assigns a connection field by its case insensitive name from its string form.
+func (c *Connection) Set(field string, value string) error {
+	switch strings.ToLower(field) {
+	case "name":
+		c.Name = value
+		return nil
+	case "bucket":
+		c.Bucket = value
+		return nil
+	}
+	if !isAccessField(field) {
+		return fmt.Errorf("unknown connection field %s", field)
+	}
+	return c.Access.set(field, value)
+}
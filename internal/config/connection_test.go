@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/configor"
+
+	"github.com/bububa/osssync/internal/config/template"
+)
+
+func testConnectionConfig() *Config {
+	return &Config{
+		Connections: []Connection{{
+			Name:   "work",
+			Access: Access{Endpoint: "oss-cn-hangzhou.aliyuncs.com", AccessKeyID: "work-id", AccessKeySecret: "work-secret"},
+			Bucket: "shared",
+		}},
+		Settings: []Setting{
+			{Name: "inherits", Local: "/home/a", Credential: Credential{Connection: "work", Prefix: "a"}},
+			{Name: "own", Local: "/home/b", Credential: Credential{Connection: "work", Bucket: "own", Prefix: "b"}},
+			{Name: "direct", Local: "/home/c", Credential: Credential{
+				Access: Access{Endpoint: "oss-cn-beijing.aliyuncs.com", AccessKeyID: "c-id", AccessKeySecret: "c-secret"},
+				Bucket: "direct", Prefix: "c",
+			}},
+		},
+	}
+}
+
+func TestApplyConnections(t *testing.T) {
+	cfg := testConnectionConfig()
+	if err := cfg.ApplyConnections(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		bucket string
+		raw    string
+		keyID  string
+	}{
+		{bucket: "shared", raw: "", keyID: "work-id"},
+		{bucket: "own", raw: "own", keyID: "work-id"},
+		{bucket: "direct", raw: "direct", keyID: "c-id"},
+	}
+	for idx, tt := range tests {
+		s := cfg.Settings[idx]
+		if s.Bucket != tt.bucket || s.RawBucket() != tt.raw || s.AccessKeyID != tt.keyID {
+			t.Errorf("%s: bucket %s raw %q key %s, want %s %q %s", s.Name, s.Bucket, s.RawBucket(), s.AccessKeyID, tt.bucket, tt.raw, tt.keyID)
+		}
+	}
+	// a rotated key and a new default bucket reach the settings using the connection on the next apply
+	cfg.Connections[0].AccessKeyID = "rotated-id"
+	cfg.Connections[0].Bucket = "moved"
+	if err := cfg.ApplyConnections(); err != nil {
+		t.Fatal(err)
+	}
+	if s := cfg.Settings[0]; s.Bucket != "moved" || s.RawBucket() != "" || s.AccessKeyID != "rotated-id" {
+		t.Errorf("inherits: got bucket %s key %s", s.Bucket, s.AccessKeyID)
+	}
+	if s := cfg.Settings[1]; s.Bucket != "own" || s.AccessKeyID != "rotated-id" {
+		t.Errorf("own: got bucket %s key %s", s.Bucket, s.AccessKeyID)
+	}
+
+	cfg.Settings[2].Connection = "missing"
+	if err := cfg.ApplyConnections(); err == nil || !strings.Contains(err.Error(), "setting direct: connection missing not found") {
+		t.Fatalf("expected a missing connection error, got %v", err)
+	}
+}
+
+func TestConnectionRoundTrip(t *testing.T) {
+	cfg := testConnectionConfig()
+	if err := cfg.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := template.Template().ExecuteTemplate(&buf, "config.tpl", cfg); err != nil {
+		t.Fatal(err)
+	}
+	// the bucket inherited from the connection isn't written into the setting
+	if strings.Count(buf.String(), `Bucket = "shared"`) != 1 {
+		t.Fatalf("expected the shared bucket only in the connection:\n%s", buf.String())
+	}
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var loaded Config
+	if err := configor.New(&configor.Config{ErrorOnUnmatchedKeys: true}).Load(&loaded, path); err != nil {
+		t.Fatalf("%v:\n%s", err, buf.String())
+	}
+	if err := loaded.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Settings) != len(cfg.Settings) {
+		t.Fatalf("got %d settings, want %d", len(loaded.Settings), len(cfg.Settings))
+	}
+	for idx, want := range cfg.Settings {
+		got := loaded.Settings[idx]
+		if got.Connection != want.Connection || got.Bucket != want.Bucket || got.RawBucket() != want.RawBucket() || got.Access != want.Access {
+			t.Errorf("%s: got %+v, want %+v", want.Name, got.Credential, want.Credential)
+		}
+	}
+}
+
+func TestConfigTemplateEscapes(t *testing.T) {
+	cfg := testConnectionConfig()
+	// Go quoting would write \x01, \a and \x7f which aren't valid TOML escapes
+	cfg.Settings[0].Local = "quote\"back\\slash"
+	cfg.Settings[1].Local = "ctrl\x01\a\x7f tab\tline\n"
+	cfg.Settings[2].Local = "文档 ☃ invalid\xff"
+	var buf bytes.Buffer
+	if err := template.Template().ExecuteTemplate(&buf, "config.tpl", cfg); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var loaded Config
+	if err := configor.New(&configor.Config{ErrorOnUnmatchedKeys: true}).Load(&loaded, path); err != nil {
+		t.Fatalf("%v:\n%s", err, buf.String())
+	}
+	expected := []string{"quote\"back\\slash", "ctrl\x01\a\x7f tab\tline\n", "文档 ☃ invalid\uFFFD"}
+	if len(loaded.Settings) != len(expected) {
+		t.Fatalf("got %d settings, want %d", len(loaded.Settings), len(expected))
+	}
+	for idx, want := range expected {
+		if got := loaded.Settings[idx].Local; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bububa/osssync/pkg/credentials"
+)
+
+// the values of Access.Provider
+const (
+	// CredentialChain tries static keys, environment variables, the Aliyun CLI profile and the ECS RAM role in turn
+	CredentialChain = "chain"
+	// CredentialStatic uses AccessKeyID and AccessKeySecret
+	CredentialStatic = "static"
+	// CredentialEnv uses ALIBABA_CLOUD_ACCESS_KEY_ID and ALIBABA_CLOUD_ACCESS_KEY_SECRET, or OSS_ACCESS_KEY_ID and OSS_ACCESS_KEY_SECRET
+	CredentialEnv = "env"
+	// CredentialProfile uses a profile of the Aliyun CLI config
+	CredentialProfile = "profile"
+	// CredentialECSRole uses the RAM role attached to the ECS instance
+	CredentialECSRole = "ecs_role"
+)
+
+// SecretTTL is how long keys resolved from a secret reference are used before the reference is
+// resolved again, so a key rotated in a file, command or keyring is picked up without a reload.
+const SecretTTL = 10 * time.Minute
+
+// MetadataEndpointEnv overrides the ECS metadata service, e.g. to test against a stand-in.
+const MetadataEndpointEnv = "OSSSYNC_METADATA_ENDPOINT"
+
+var credentialProviders = []string{CredentialChain, CredentialStatic, CredentialEnv, CredentialProfile, CredentialECSRole}
+
+// CredentialProvider is Provider, defaulting to static when AccessKeyID is set and to the chain otherwise.
+func (c Access) CredentialProvider() string {
+	if c.Provider != "" {
+		return c.Provider
+	}
+	if c.AccessKeyID != "" {
+		return CredentialStatic
+	}
+	return CredentialChain
+}
+
+// Credentials builds the provider of the credentials of the OSS client, wrap it in a credentials.Cache
+// so temporary credentials are reused until they are about to expire.
+func (c Access) Credentials() (credentials.Provider, error) {
+	static := credentials.Static(c.AccessKeyID, c.AccessKeySecret, "")
+	if c.accessKeyIDRef.ref != "" || c.accessKeySecretRef.ref != "" {
+		static = credentials.Resolved(c.resolveKeys, SecretTTL)
+	}
+	env := credentials.Env()
+	profile := credentials.Profile("", c.Profile)
+	ecsRole := credentials.ECSRole(c.ECSRole, os.Getenv(MetadataEndpointEnv))
+	var provider credentials.Provider
+	switch c.CredentialProvider() {
+	case CredentialChain:
+		provider = credentials.Chain(static, env, profile, ecsRole)
+	case CredentialStatic:
+		provider = static
+	case CredentialEnv:
+		provider = env
+	case CredentialProfile:
+		provider = profile
+	case CredentialECSRole:
+		provider = ecsRole
+	default:
+		return nil, fmt.Errorf("unknown credential provider %s", c.Provider)
+	}
+	if c.RoleArn != "" {
+		provider = credentials.AssumeRole(provider, c.RoleArn,
+			credentials.WithSessionName(c.RoleSessionName),
+			credentials.WithDuration(time.Duration(c.RoleDuration)*time.Second),
+			credentials.WithSTSEndpoint(c.STSEndpoint),
+		)
+	}
+	return provider, nil
+}
+
+// resolveKeys resolves the secret references of AccessKeyID and AccessKeySecret again.
+func (c Access) resolveKeys() (string, string, error) {
+	id, err := c.accessKeyIDRef.current(c.AccessKeyID)
+	if err != nil {
+		return "", "", fmt.Errorf("AccessKeyID: %w", err)
+	}
+	secret, err := c.accessKeySecretRef.current(c.AccessKeySecret)
+	if err != nil {
+		return "", "", fmt.Errorf("AccessKeySecret: %w", err)
+	}
+	return id, secret, nil
+}
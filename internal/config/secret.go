@@ -0,0 +1,202 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bububa/osssync/pkg/keyring"
+)
+
+// Secret references let AccessKeyID, AccessKeySecret and HTTP.Token come from outside the config file,
+// so it can be committed. They are resolved when the config is loaded:
+//
+//	${NAME}      the environment variable NAME, also inside a longer value
+//	env:NAME     the environment variable NAME
+//	file:PATH    the content of the file, e.g. a docker or systemd credential
+//	cmd:COMMAND  the output of COMMAND run by the shell, e.g. cmd:pass show oss/ak
+//	keyring:NAME the secret NAME of KeyringService in the OS keyring
+//
+// Trailing newlines of file: and cmd: values are trimmed. Saving the config writes the reference back
+// rather than the secret, unless the value was changed since.
+const (
+	envRefPrefix     = "env:"
+	fileRefPrefix    = "file:"
+	cmdRefPrefix     = "cmd:"
+	keyringRefPrefix = "keyring:"
+)
+
+// KeyringService is the service the secrets of keyring: references are stored under in the OS keyring.
+const KeyringService = "osssync"
+
+// SecretCommandTimeout is how long a cmd: reference may run.
+const SecretCommandTimeout = 30 * time.Second
+
+// IsSecretRef reports whether value is a secret reference rather than a literal.
+func IsSecretRef(value string) bool {
+	for _, prefix := range []string{envRefPrefix, fileRefPrefix, cmdRefPrefix, keyringRefPrefix} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return strings.Contains(value, "${")
+}
+
+// KeyringRef is the reference to the secret name in the OS keyring.
+func KeyringRef(name string) string {
+	return keyringRefPrefix + name
+}
+
+// KeyringName returns the name of the keyring secret value refers to, if it is a keyring reference.
+func KeyringName(value string) (string, bool) {
+	return strings.CutPrefix(value, keyringRefPrefix)
+}
+
+// ResolveSecret returns the value a secret reference points to, literals are returned as is.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, envRefPrefix):
+		name := strings.TrimPrefix(value, envRefPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(value, fileRefPrefix):
+		bs, err := os.ReadFile(strings.TrimPrefix(value, fileRefPrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(bs), "\r\n"), nil
+	case strings.HasPrefix(value, cmdRefPrefix):
+		return runSecretCommand(strings.TrimPrefix(value, cmdRefPrefix))
+	case strings.HasPrefix(value, keyringRefPrefix):
+		name := strings.TrimPrefix(value, keyringRefPrefix)
+		v, err := keyring.Get(KeyringService, name)
+		if err != nil {
+			return "", fmt.Errorf("keyring %s: %w", name, err)
+		}
+		return v, nil
+	case strings.Contains(value, "${"):
+		var errs []error
+		ret := os.Expand(value, func(name string) string {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("environment variable %s not set", name))
+			}
+			return v
+		})
+		return ret, errors.Join(errs...)
+	}
+	return value, nil
+}
+
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SecretCommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", command, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// secretRef remembers the reference a field was resolved from, so it can be saved instead of the secret.
+type secretRef struct {
+	ref   string
+	value string
+}
+
+// resolve replaces a reference in value by what it points to.
+func (r *secretRef) resolve(value *string) error {
+	if !IsSecretRef(*value) {
+		return nil
+	}
+	resolved, err := ResolveSecret(*value)
+	if err != nil {
+		return err
+	}
+	*r = secretRef{ref: *value, value: resolved}
+	*value = resolved
+	return nil
+}
+
+// raw is the reference value was resolved from, or value itself if it isn't resolved or was changed since.
+func (r secretRef) raw(value string) string {
+	if r.ref != "" && r.value == value {
+		return r.ref
+	}
+	return value
+}
+
+// current resolves the reference value was resolved from again, value is returned as is if it isn't
+// resolved or was changed since.
+func (r secretRef) current(value string) (string, error) {
+	if r.ref != "" && r.value == value {
+		return ResolveSecret(r.ref)
+	}
+	return value, nil
+}
+
+// ResolveSecrets replaces the secret references of the config by what they point to.
+func (c *Config) ResolveSecrets() error {
+	var errs []error
+	if err := c.HTTP.tokenRef.resolve(&c.HTTP.Token); err != nil {
+		errs = append(errs, fmt.Errorf("HTTP.Token: %w", err))
+	}
+	for idx := range c.Connections {
+		conn := &c.Connections[idx]
+		if err := conn.resolveSecrets(); err != nil {
+			errs = append(errs, fmt.Errorf("connection %s: %w", conn.Name, err))
+		}
+	}
+	for idx := range c.Settings {
+		s := &c.Settings[idx]
+		if s.Connection != "" {
+			// the connection's secrets are copied in by ApplyConnections
+			continue
+		}
+		if err := s.resolveSecrets(); err != nil {
+			errs = append(errs, fmt.Errorf("setting %s: %w", s.DisplayName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *Access) resolveSecrets() error {
+	var errs []error
+	if err := a.accessKeyIDRef.resolve(&a.AccessKeyID); err != nil {
+		errs = append(errs, fmt.Errorf("AccessKeyID: %w", err))
+	}
+	if err := a.accessKeySecretRef.resolve(&a.AccessKeySecret); err != nil {
+		errs = append(errs, fmt.Errorf("AccessKeySecret: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// RawAccessKeyID is AccessKeyID as written in the config file, a secret reference if it was resolved from one.
+func (c Access) RawAccessKeyID() string {
+	return c.accessKeyIDRef.raw(c.AccessKeyID)
+}
+
+// RawAccessKeySecret is AccessKeySecret as written in the config file, a secret reference if it was resolved from one.
+func (c Access) RawAccessKeySecret() string {
+	return c.accessKeySecretRef.raw(c.AccessKeySecret)
+}
+
+// RawToken is Token as written in the config file, a secret reference if it was resolved from one.
+func (h HTTP) RawToken() string {
+	return h.tokenRef.raw(h.Token)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("OSSSYNC_TEST_SECRET", "s3cret")
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+		unix    bool
+	}{
+		{value: "literal", want: "literal"},
+		{value: "${OSSSYNC_TEST_SECRET}", want: "s3cret"},
+		{value: "pre-${OSSSYNC_TEST_SECRET}-post", want: "pre-s3cret-post"},
+		{value: "${OSSSYNC_TEST_MISSING}", wantErr: true},
+		{value: "env:OSSSYNC_TEST_SECRET", want: "s3cret"},
+		{value: "env:OSSSYNC_TEST_MISSING", wantErr: true},
+		{value: "file:" + secretFile, want: "from-file"},
+		{value: "file:" + filepath.Join(t.TempDir(), "missing"), wantErr: true},
+		{value: "cmd:echo from-cmd", want: "from-cmd"},
+		{value: "cmd:exit 3", wantErr: true, unix: true},
+	}
+	for _, tt := range tests {
+		if tt.unix && runtime.GOOS == "windows" {
+			continue
+		}
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ResolveSecret(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveSecret(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("ResolveSecret(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretRefRaw(t *testing.T) {
+	t.Setenv("OSSSYNC_TEST_SECRET", "s3cret")
+	tests := []struct {
+		name    string
+		value   string
+		changed string
+		want    string
+	}{
+		{name: "literal", value: "literal", want: "literal"},
+		{name: "unchanged reference", value: "env:OSSSYNC_TEST_SECRET", want: "env:OSSSYNC_TEST_SECRET"},
+		{name: "changed reference", value: "env:OSSSYNC_TEST_SECRET", changed: "typed", want: "typed"},
+		{name: "replaced by another reference", value: "${OSSSYNC_TEST_SECRET}", changed: "file:/run/secret", want: "file:/run/secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ref secretRef
+			value := tt.value
+			if err := ref.resolve(&value); err != nil {
+				t.Fatal(err)
+			}
+			if IsSecretRef(tt.value) && value != "s3cret" {
+				t.Fatalf("resolved %q to %q", tt.value, value)
+			}
+			if tt.changed != "" {
+				value = tt.changed
+			}
+			if got := ref.raw(value); got != tt.want {
+				t.Fatalf("raw = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSecretsConfig(t *testing.T) {
+	t.Setenv("OSSSYNC_TEST_SECRET", "s3cret")
+	cfg := Config{
+		HTTP: HTTP{Token: "env:OSSSYNC_TEST_SECRET"},
+		Settings: []Setting{{
+			Name:       "docs",
+			Credential: Credential{Access: Access{AccessKeyID: "id", AccessKeySecret: "${OSSSYNC_TEST_SECRET}"}},
+		}},
+	}
+	if err := cfg.ResolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	s := cfg.Settings[0]
+	if cfg.HTTP.Token != "s3cret" || s.AccessKeySecret != "s3cret" {
+		t.Fatalf("secrets not resolved: %q %q", cfg.HTTP.Token, s.AccessKeySecret)
+	}
+	if cfg.HTTP.RawToken() != "env:OSSSYNC_TEST_SECRET" || s.RawAccessKeySecret() != "${OSSSYNC_TEST_SECRET}" || s.RawAccessKeyID() != "id" {
+		t.Fatalf("references not kept: %q %q %q", cfg.HTTP.RawToken(), s.RawAccessKeySecret(), s.RawAccessKeyID())
+	}
+}
+
+func TestCredentialsRotatedSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ak-secret")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	access := Access{AccessKeyID: "id", AccessKeySecret: "file:" + path}
+	if err := access.resolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := access.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := provider.Retrieve(context.Background())
+	if err != nil || creds.AccessKeySecret != "old" || creds.Expiration.IsZero() {
+		t.Fatalf("expected the old secret to expire, got %+v %v", creds, err)
+	}
+	// the secret is rotated in the file, the config stays the same
+	if err := os.WriteFile(path, []byte("new\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err = provider.Retrieve(context.Background()); err != nil || creds.AccessKeySecret != "new" {
+		t.Fatalf("expected the rotated secret, got %+v %v", creds, err)
+	}
+	// literal keys don't expire
+	provider, err = Access{AccessKeyID: "id", AccessKeySecret: "literal"}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds, err = provider.Retrieve(context.Background()); err != nil || !creds.Expiration.IsZero() {
+		t.Fatalf("expected long-lived keys, got %+v %v", creds, err)
+	}
+}
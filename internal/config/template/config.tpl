@@ -1,12 +1,78 @@
+{{- if .Concurrency}}
+Concurrency = {{.Concurrency}}
+{{end}}
+{{- if .DrainTimeout}}
+DrainTimeout = {{.DrainTimeout}}
+{{end}}
+{{- if .HTTP.Listen}}
+[HTTP]
+Listen = {{toml .HTTP.Listen}}
+{{- if .HTTP.Token}}
+Token = {{toml .HTTP.RawToken}}
+{{- end}}
+{{end}}
+{{- range $v := .Connections}}
+[[Connections]]
+Name = {{toml $v.Name}}
+{{template "access" $v.Access}}
+{{- if $v.Bucket}}
+Bucket = {{toml $v.Bucket}}
+{{- end}}
+{{end}}
 {{- range $v := .Settings}}
 [[Settings]]
-Name = "{{$v.Name}}"
-Local = "{{$v.Local}}"
-Endpoint = "{{$v.Endpoint}}"
-AccessKeyID = "{{$v.AccessKeyID}}"
-AccessKeySecret = "{{$v.AccessKeySecret}}"
-Bucket = "{{$v.Bucket}}"
-Prefix = "{{$v.Prefix}}"
+Name = {{toml $v.Name}}
+Local = {{toml $v.Local}}
+{{- if $v.Connection}}
+Connection = {{toml $v.Connection}}
+{{- else}}
+{{template "access" $v.Access}}
+{{- end}}
+{{- if $v.RawBucket}}
+Bucket = {{toml $v.RawBucket}}
+{{- end}}
+Prefix = {{toml $v.Prefix}}
+{{- if $v.MultipartThreshold}}
+MultipartThreshold = {{$v.MultipartThreshold}}
+{{- end}}
+{{- if $v.PartSize}}
+PartSize = {{$v.PartSize}}
+{{- end}}
+{{- if $v.Routines}}
+Routines = {{$v.Routines}}
+{{- end}}
+{{- if $v.Weight}}
+Weight = {{$v.Weight}}
+{{- end}}
 IgnoreHiddenFiles = {{$v.IgnoreHiddenFiles}}
 Delete = {{$v.Delete}}
 {{end}}
+
+{{- define "access" -}}
+Endpoint = {{toml .Endpoint}}
+{{- if .AccessKeyID}}
+AccessKeyID = {{toml .RawAccessKeyID}}
+AccessKeySecret = {{toml .RawAccessKeySecret}}
+{{- end}}
+{{- if .Provider}}
+Provider = {{toml .Provider}}
+{{- end}}
+{{- if .Profile}}
+Profile = {{toml .Profile}}
+{{- end}}
+{{- if .ECSRole}}
+ECSRole = {{toml .ECSRole}}
+{{- end}}
+{{- if .RoleArn}}
+RoleArn = {{toml .RoleArn}}
+{{- end}}
+{{- if .RoleSessionName}}
+RoleSessionName = {{toml .RoleSessionName}}
+{{- end}}
+{{- if .RoleDuration}}
+RoleDuration = {{.RoleDuration}}
+{{- end}}
+{{- if .STSEndpoint}}
+STSEndpoint = {{toml .STSEndpoint}}
+{{- end}}
+{{- end}}
@@ -2,17 +2,20 @@ package template
 
 import (
 	"embed"
+	"fmt"
 	"log"
+	"strings"
 	"text/template"
+	"unicode/utf8"
 )
 
-//go:embed "config.tpl"
+//go:embed "config.tpl" "systemd.service.tpl" "systemd.socket.tpl"
 var templateFS embed.FS
 
 var tpl *template.Template
 
 func init() {
-	if t, err := template.New("").ParseFS(templateFS, "config.tpl"); err != nil {
+	if t, err := template.New("").Funcs(template.FuncMap{"toml": tomlString}).ParseFS(templateFS, "*.tpl"); err != nil {
 		log.Fatalln(err)
 	} else {
 		tpl = t
@@ -22,3 +25,37 @@ func init() {
 func Template() *template.Template {
 	return tpl
 }
+
+// tomlString quotes s as a TOML basic string, Go quoting isn't valid TOML since it may emit \x and \a escapes.
+// TOML strings must be valid UTF-8, invalid bytes are replaced by U+FFFD.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for _, r := range strings.ToValidUTF8(s, string(utf8.RuneError)) {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
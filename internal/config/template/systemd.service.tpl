@@ -0,0 +1,23 @@
+[Unit]
+Description=osssync, sync local folders to Aliyun OSS
+After=network-online.target
+Wants=network-online.target
+{{- if .Socket}}
+Requires={{.Name}}.socket
+After={{.Name}}.socket
+{{- end}}
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{printf "%q" .Exec}} --config {{printf "%q" .Config}} sync
+Restart=on-failure
+RestartSec=5
+WatchdogSec={{.Watchdog}}
+TimeoutStopSec={{.TimeoutStop}}
+
+[Install]
+WantedBy=default.target
+{{- if .Socket}}
+Also={{.Name}}.socket
+{{- end}}
@@ -0,0 +1,12 @@
+[Unit]
+Description=osssync control socket
+
+[Socket]
+ListenStream={{.SocketPath}}
+FileDescriptorName={{.SocketName}}
+SocketMode=0600
+DirectoryMode=0700
+Service={{.Name}}.service
+
+[Install]
+WantedBy=sockets.target
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bububa/osssync/pkg/fs/oss"
+)
+
+// Validate checks what configor's required tags can't: folders, duplicates and ranges.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Concurrency < 0 {
+		errs = append(errs, errors.New("Concurrency can't be negative"))
+	}
+	if c.DrainTimeout < 0 {
+		errs = append(errs, errors.New("DrainTimeout can't be negative"))
+	}
+	if c.HTTP.Listen != "" {
+		if _, err := c.HTTP.Address(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid HTTP.Listen: %w", err))
+		}
+	}
+	connections := make(map[string]struct{}, len(c.Connections))
+	for _, conn := range c.Connections {
+		if err := conn.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("connection %s: %w", conn.Name, err))
+		}
+		if _, ok := connections[conn.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate connection name %s", conn.Name))
+		}
+		connections[conn.Name] = struct{}{}
+	}
+	names := make(map[string]struct{}, len(c.Settings))
+	keys := make(map[string]struct{}, len(c.Settings))
+	for _, s := range c.Settings {
+		if err := s.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("setting %s: %w", s.DisplayName(), err))
+		}
+		if _, ok := names[s.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate setting name %s", s.Name))
+		}
+		names[s.Name] = struct{}{}
+		if _, ok := connections[s.Connection]; s.Connection != "" && !ok {
+			errs = append(errs, fmt.Errorf("setting %s: connection %s not found", s.DisplayName(), s.Connection))
+		}
+		if _, ok := keys[s.Key()]; ok {
+			errs = append(errs, fmt.Errorf("duplicate setting %s", s.Key()))
+		}
+		keys[s.Key()] = struct{}{}
+	}
+	return errors.Join(errs...)
+}
+
+func (s Setting) Validate() error {
+	var errs []error
+	for _, f := range []struct{ name, value string }{
+		{"Name", s.Name},
+		{"Local", s.Local},
+		{"Endpoint", s.Endpoint},
+		{"Bucket", s.Bucket},
+		{"Prefix", s.Prefix},
+	} {
+		if f.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", f.name))
+		}
+	}
+	if s.Local != "" {
+		if !filepath.IsAbs(s.Local) {
+			errs = append(errs, fmt.Errorf("Local %s must be an absolute path", s.Local))
+		} else if fi, err := os.Stat(s.Local); err != nil {
+			errs = append(errs, fmt.Errorf("Local %w", err))
+		} else if !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("Local %s is not a directory", s.Local))
+		}
+	}
+	if s.Weight < 0 || s.MultipartThreshold < 0 || s.PartSize < 0 || s.Routines < 0 || s.RoleDuration < 0 {
+		errs = append(errs, errors.New("Weight, MultipartThreshold, PartSize, Routines and RoleDuration can't be negative"))
+	}
+	if s.PartSize > 0 && s.PartSize < oss.MinPartSize {
+		errs = append(errs, fmt.Errorf("PartSize must be at least %d bytes", oss.MinPartSize))
+	}
+	if s.Connection == "" {
+		// the credentials of a connection are validated with it
+		if err := s.Access.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c Connection) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("Name is required"))
+	}
+	if c.Endpoint == "" {
+		errs = append(errs, errors.New("Endpoint is required"))
+	}
+	if c.RoleDuration < 0 {
+		errs = append(errs, errors.New("RoleDuration can't be negative"))
+	}
+	if err := c.Access.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (c Access) validate() error {
+	var errs []error
+	if !slices.Contains(credentialProviders, c.CredentialProvider()) {
+		errs = append(errs, fmt.Errorf("Provider %s must be one of %s", c.Provider, strings.Join(credentialProviders, ", ")))
+	}
+	if (c.AccessKeyID == "") != (c.AccessKeySecret == "") {
+		errs = append(errs, errors.New("AccessKeyID and AccessKeySecret must be set together"))
+	}
+	if c.CredentialProvider() == CredentialStatic && c.AccessKeyID == "" {
+		errs = append(errs, errors.New("AccessKeyID and AccessKeySecret are required by the static provider"))
+	}
+	return errors.Join(errs...)
+}
+
+// Set assigns a setting field by its case insensitive name from its string form.
+func (s *Setting) Set(field string, value string) error {
+	var err error
+	switch strings.ToLower(field) {
+	case "name":
+		s.Name = value
+	case "local":
+		s.Local = value
+	case "connection":
+		s.Connection = value
+	case "bucket":
+		s.Bucket = value
+	case "prefix":
+		s.Prefix = value
+	case "multipartthreshold":
+		s.MultipartThreshold, err = strconv.ParseInt(value, 10, 64)
+	case "partsize":
+		s.PartSize, err = strconv.ParseInt(value, 10, 64)
+	case "routines":
+		s.Routines, err = strconv.Atoi(value)
+	case "weight":
+		s.Weight, err = strconv.Atoi(value)
+	case "ignorehiddenfiles":
+		s.IgnoreHiddenFiles, err = strconv.ParseBool(value)
+	case "delete":
+		s.Delete, err = strconv.ParseBool(value)
+	default:
+		if !isAccessField(field) {
+			return fmt.Errorf("unknown setting field %s", field)
+		}
+		if s.Connection != "" {
+			return fmt.Errorf("%s comes from connection %s, set it there or clear Connection first", field, s.Connection)
+		}
+		return s.Access.set(field, value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", field, err)
+	}
+	return nil
+}
+
+// accessFields are the lower case names of the fields of Access.
+var accessFields = []string{"endpoint", "accesskeyid", "accesskeysecret", "provider", "profile", "ecsrole", "rolearn", "rolesessionname", "roleduration", "stsendpoint"}
+
+func isAccessField(field string) bool {
+	return slices.Contains(accessFields, strings.ToLower(field))
+}
+
+// set assigns one of accessFields from its string form.
+func (a *Access) set(field string, value string) error {
+	var err error
+	switch strings.ToLower(field) {
+	case "endpoint":
+		a.Endpoint = value
+	case "accesskeyid":
+		a.AccessKeyID = value
+	case "accesskeysecret":
+		a.AccessKeySecret = value
+	case "provider":
+		a.Provider = value
+	case "profile":
+		a.Profile = value
+	case "ecsrole":
+		a.ECSRole = value
+	case "rolearn":
+		a.RoleArn = value
+	case "rolesessionname":
+		a.RoleSessionName = value
+	case "roleduration":
+		a.RoleDuration, err = strconv.Atoi(value)
+	case "stsendpoint":
+		a.STSEndpoint = value
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", field, err)
+	}
+	return nil
+}
+
+// Set assigns a global config field by its case insensitive name from its string form.
+func (c *Config) Set(field string, value string) error {
+	switch strings.ToLower(field) {
+	case "concurrency":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", field, err)
+		}
+		c.Concurrency = v
+		return nil
+	case "draintimeout":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", field, err)
+		}
+		c.DrainTimeout = v
+		return nil
+	case "http.listen":
+		c.HTTP.Listen = value
+		return nil
+	case "http.token":
+		c.HTTP.Token = value
+		return nil
+	}
+	return fmt.Errorf("unknown config field %s", field)
+}
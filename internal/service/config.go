@@ -1,63 +1,322 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/jinzhu/configor"
+	"go.uber.org/atomic"
 
 	"github.com/bububa/osssync/internal/config"
 	"github.com/bububa/osssync/internal/config/template"
+	"github.com/bububa/osssync/internal/service/log"
 	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/keyring"
 )
 
-var configSetting *config.Config
+var (
+	// configSetting is swapped as a whole on reload, readers keep the config they loaded
+	configSetting = atomic.NewPointer[config.Config](nil)
+	// configPath is the file the config was loaded from, SaveConfig writes back to it
+	configPath string
+	// httpListen overrides HTTP.Listen of every config loaded, see SetHTTPListen
+	httpListen string
+
+	ErrSettingNotExist  = errors.New("setting not exists")
+	ErrDuplicateSetting = errors.New("duplicate setting")
+
+	ErrConnectionNotExist  = errors.New("connection not exists")
+	ErrDuplicateConnection = errors.New("duplicate connection")
+)
 
 func SetConfig(cfg *config.Config) {
-	configSetting = cfg
+	configSetting.Store(cfg)
 }
 
+// Config is the config in use, it must not be modified since other goroutines read it too.
 func Config() *config.Config {
-	return configSetting
+	return configSetting.Load()
+}
+
+// SetHTTPListen overrides HTTP.Listen of the config in use and of the configs reloaded later.
+// It must be called before Start.
+func SetHTTPListen(listen string) {
+	httpListen = listen
+	cfg := *Config()
+	applyOverrides(&cfg)
+	SetConfig(&cfg)
+}
+
+// applyOverrides applies the command line overrides to a loaded config.
+func applyOverrides(cfg *config.Config) {
+	if httpListen != "" {
+		cfg.HTTP.Listen = httpListen
+	}
+}
+
+// ConfigPath is the config file in use.
+func ConfigPath() (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+	return xdg.ConfigFile(filepath.Join(pkg.AppIdentity, config.AppConfig))
 }
 
-func ConfigLoader(cfg *config.Config, configPath string) error {
+func ConfigLoader(cfg *config.Config, path string) error {
+	configPath = path
 	loader := configor.New(&configor.Config{
 		Environment:          "production",
 		ErrorOnUnmatchedKeys: true,
-		AutoReload:           true,
-		AutoReloadCallback: func(cfg interface{}) {
-			Reload(cfg.(*config.Config))
-		},
 	})
-	return loader.Load(cfg, configPath)
+	if err := loader.Load(cfg, path); err != nil {
+		return err
+	}
+	return cfg.Resolve()
+}
+
+// ConfigWatchInterval is how often a running daemon checks the config file for changes.
+const ConfigWatchInterval = time.Second
+
+// watchConfig reloads the config whenever its file changes until ctx is done. ReloadConfig only swaps
+// the new config in once its secrets resolved, so a broken edit leaves the running config alone.
+func watchConfig(ctx context.Context) {
+	path, err := ConfigPath()
+	if err != nil {
+		return
+	}
+	var modTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime()
+	}
+	ticker := time.NewTicker(ConfigWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil || fi.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = fi.ModTime()
+		// the syncer logs what the reload changed
+		if _, err := ReloadConfig(); err != nil {
+			log.Logger().Error().Err(err).Msg("reload")
+		}
+	}
 }
 
 func LoadConfig(cfg *config.Config) error {
-	configPath, err := xdg.ConfigFile(filepath.Join(pkg.AppIdentity, config.AppConfig))
+	path, err := xdg.ConfigFile(filepath.Join(pkg.AppIdentity, config.AppConfig))
 	if err != nil {
 		return err
 	}
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		if err := WriteConfigFile(configPath, nil); err != nil {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := WriteConfigFile(path, nil); err != nil {
 			return err
 		}
 	}
-	return ConfigLoader(cfg, configPath)
+	return ConfigLoader(cfg, path)
 }
 
+// SaveConfig writes cfg to the config file in use, replacing it atomically so a running daemon never reloads a partial file.
 func SaveConfig(cfg *config.Config) error {
-	configPath, err := xdg.ConfigFile(filepath.Join(pkg.AppIdentity, config.AppConfig))
+	path, err := ConfigPath()
 	if err != nil {
 		return err
 	}
-	w, err := os.Create(configPath)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := template.Template().ExecuteTemplate(&buf, "config.tpl", cfg); err != nil {
 		return err
 	}
-	defer w.Close()
-	return template.Template().ExecuteTemplate(w, "config.tpl", cfg)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// AddSetting appends setting to the config and saves it.
+func AddSetting(setting config.Setting) error {
+	cfg := *Config()
+	if err := checkDuplicateSetting(cfg.Settings, setting, ""); err != nil {
+		return err
+	}
+	cfg.Settings = append(append([]config.Setting{}, cfg.Settings...), setting)
+	return SaveConfig(&cfg)
+}
+
+// checkDuplicateSetting fails if a setting other than the one with key except has the key or name of setting.
+func checkDuplicateSetting(settings []config.Setting, setting config.Setting, except string) error {
+	for _, s := range settings {
+		if s.Key() == except {
+			continue
+		}
+		if s.Key() == setting.Key() || s.Name == setting.Name {
+			return ErrDuplicateSetting
+		}
+	}
+	return nil
+}
+
+// UpdateSetting replaces the setting with the given key and saves the config.
+func UpdateSetting(key string, setting config.Setting) error {
+	cfg := *Config()
+	// a changed name, folder, bucket or prefix mustn't clash with another setting
+	if err := checkDuplicateSetting(cfg.Settings, setting, key); err != nil {
+		return err
+	}
+	cfg.Settings = append([]config.Setting{}, cfg.Settings...)
+	for idx, s := range cfg.Settings {
+		if s.Key() == key {
+			cfg.Settings[idx] = setting
+			return SaveConfig(&cfg)
+		}
+	}
+	return ErrSettingNotExist
+}
+
+// RemoveSetting removes the setting with the given key and saves the config.
+func RemoveSetting(key string) error {
+	cfg := *Config()
+	settings := make([]config.Setting, 0, len(cfg.Settings))
+	var removed config.Setting
+	for _, s := range cfg.Settings {
+		if s.Key() == key {
+			removed = s
+			continue
+		}
+		settings = append(settings, s)
+	}
+	if len(settings) == len(cfg.Settings) {
+		return ErrSettingNotExist
+	}
+	cfg.Settings = settings
+	if err := SaveConfig(&cfg); err != nil {
+		return err
+	}
+	if removed.Connection != "" {
+		// the secret belongs to the connection
+		return nil
+	}
+	return deleteUnusedKeyringSecret(&cfg, removed.RawAccessKeySecret(), removed.DisplayName())
+}
+
+// AddConnection appends conn to the config and saves it.
+func AddConnection(conn config.Connection) error {
+	cfg := *Config()
+	if _, ok := cfg.FindConnection(conn.Name); ok {
+		return ErrDuplicateConnection
+	}
+	cfg.Connections = append(append([]config.Connection{}, cfg.Connections...), conn)
+	return SaveConfig(&cfg)
+}
+
+// UpdateConnection replaces the connection with the given name and saves the config, settings follow a rename.
+// A running daemon restarts the settings using the connection when it reloads the config.
+func UpdateConnection(name string, conn config.Connection) error {
+	cfg := *Config()
+	cfg.Connections = append([]config.Connection{}, cfg.Connections...)
+	idx := slices.IndexFunc(cfg.Connections, func(c config.Connection) bool { return c.Name == name })
+	if idx < 0 {
+		return ErrConnectionNotExist
+	}
+	if conn.Name != name {
+		if _, ok := cfg.FindConnection(conn.Name); ok {
+			return ErrDuplicateConnection
+		}
+	}
+	cfg.Connections[idx] = conn
+	cfg.Settings = append([]config.Setting{}, cfg.Settings...)
+	for idx := range cfg.Settings {
+		if cfg.Settings[idx].Connection == name {
+			cfg.Settings[idx].Connection = conn.Name
+		}
+	}
+	return SaveConfig(&cfg)
+}
+
+// RemoveConnection removes the connection with the given name and saves the config, it must not be in use.
+func RemoveConnection(name string) error {
+	cfg := *Config()
+	idx := slices.IndexFunc(cfg.Connections, func(c config.Connection) bool { return c.Name == name })
+	if idx < 0 {
+		return ErrConnectionNotExist
+	}
+	for _, s := range cfg.Settings {
+		if s.Connection == name {
+			return fmt.Errorf("connection %s is used by setting %s", name, s.DisplayName())
+		}
+	}
+	removed := cfg.Connections[idx]
+	cfg.Connections = slices.Delete(append([]config.Connection{}, cfg.Connections...), idx, idx+1)
+	if err := SaveConfig(&cfg); err != nil {
+		return err
+	}
+	return deleteUnusedKeyringSecret(&cfg, removed.RawAccessKeySecret(), "connection "+removed.Name)
+}
+
+// StoreSecretInKeyring moves the AccessKeySecret of setting into the OS keyring under its name and puts a
+// keyring reference in its place. Secrets already given by a reference stay where they are, and so do the
+// secrets of connections.
+func StoreSecretInKeyring(setting *config.Setting) error {
+	if setting.Connection != "" {
+		return nil
+	}
+	return storeSecretInKeyring(&setting.Access, setting.Name, setting.DisplayName())
+}
+
+// StoreConnectionSecretInKeyring is StoreSecretInKeyring for a connection, its secret is named after it
+// with a connection/ prefix so it doesn't clash with a setting of the same name.
+func StoreConnectionSecretInKeyring(conn *config.Connection) error {
+	return storeSecretInKeyring(&conn.Access, "connection/"+conn.Name, "connection "+conn.Name)
+}
+
+func storeSecretInKeyring(access *config.Access, name string, owner string) error {
+	if access.AccessKeySecret == "" {
+		// no static keys, the credential chain is used
+		return nil
+	}
+	if raw := access.RawAccessKeySecret(); config.IsSecretRef(raw) {
+		access.AccessKeySecret = raw
+		return nil
+	}
+	if err := keyring.Set(config.KeyringService, name, access.AccessKeySecret); err != nil {
+		return fmt.Errorf("store AccessKeySecret of %s in keyring: %w", owner, err)
+	}
+	access.AccessKeySecret = config.KeyringRef(name)
+	return nil
+}
+
+// deleteUnusedKeyringSecret deletes the keyring secret raw refers to unless a setting or connection of cfg still uses it.
+func deleteUnusedKeyringSecret(cfg *config.Config, raw string, owner string) error {
+	name, ok := config.KeyringName(raw)
+	if !ok {
+		return nil
+	}
+	for _, s := range cfg.Settings {
+		if other, ok := config.KeyringName(s.RawAccessKeySecret()); ok && other == name {
+			return nil
+		}
+	}
+	for _, conn := range cfg.Connections {
+		if other, ok := config.KeyringName(conn.RawAccessKeySecret()); ok && other == name {
+			return nil
+		}
+	}
+	if err := keyring.Delete(config.KeyringService, name); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("delete AccessKeySecret of %s from keyring: %w", owner, err)
+	}
+	return nil
 }
 
 func WriteConfigFile(configPath string, bs []byte) error {
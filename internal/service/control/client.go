@@ -0,0 +1,134 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service/sync"
+)
+
+type Client struct {
+	path string
+}
+
+// NewClient returns a client of the daemon listening on the socket at path.
+func NewClient(path string) *Client {
+	return &Client{path: path}
+}
+
+func (c *Client) Settings(ctx context.Context) ([]config.Setting, error) {
+	var ret []config.Setting
+	return ret, c.call(ctx, Request{Method: MethodSettings}, &ret)
+}
+
+func (c *Client) Status(ctx context.Context) ([]sync.Status, error) {
+	var ret []sync.Status
+	return ret, c.call(ctx, Request{Method: MethodStatus}, &ret)
+}
+
+func (c *Client) Transfers(ctx context.Context) ([]Transfer, error) {
+	var ret []Transfer
+	return ret, c.call(ctx, Request{Method: MethodTransfers}, &ret)
+}
+
+// Sync queues every file of the settings for upload, or of every setting if none is given.
+func (c *Client) Sync(ctx context.Context, settings ...string) error {
+	return c.call(ctx, Request{Method: MethodSync, Settings: settings}, nil)
+}
+
+func (c *Client) Pause(ctx context.Context, settings ...string) error {
+	return c.call(ctx, Request{Method: MethodPause, Settings: settings}, nil)
+}
+
+func (c *Client) Resume(ctx context.Context, settings ...string) error {
+	return c.call(ctx, Request{Method: MethodResume, Settings: settings}, nil)
+}
+
+// Reload makes the daemon read its config file again and returns what changed.
+func (c *Client) Reload(ctx context.Context) (*sync.ReloadResult, error) {
+	var ret sync.ReloadResult
+	if err := c.call(ctx, Request{Method: MethodReload}, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Events calls fn with every event of the daemon from now on, until ctx is done or fn fails.
+func (c *Client) Events(ctx context.Context, fn func(sync.Event) error) error {
+	conn, r, err := c.request(ctx, Request{Method: MethodEvents}, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		var ev sync.Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) call(ctx context.Context, req Request, result any) error {
+	conn, _, err := c.request(ctx, req, result)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// request sends req and decodes the result of the response into result, leaving the connection open for streams.
+func (c *Client) request(ctx context.Context, req Request, result any) (net.Conn, *bufio.Reader, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", sync.ErrNotRunning, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.Error != "" {
+		conn.Close()
+		return nil, nil, errors.New(resp.Error)
+	}
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, r, nil
+}
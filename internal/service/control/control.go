@@ -0,0 +1,62 @@
+// Package control lets other processes drive a running daemon over a Unix domain socket.
+//
+// A client sends one json Request per connection and reads one json Response back. An events
+// request keeps the connection open after the response and streams one json sync.Event per line.
+package control
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/queue"
+)
+
+const (
+	MethodSettings  = "settings"
+	MethodStatus    = "status"
+	MethodSync      = "sync"
+	MethodPause     = "pause"
+	MethodResume    = "resume"
+	MethodReload    = "reload"
+	MethodTransfers = "transfers"
+	MethodEvents    = "events"
+)
+
+// Daemon is the running syncer as seen by the control server. Settings are given by name, none means all.
+type Daemon interface {
+	// Settings are the settings of the daemon, with secrets masked
+	Settings() []config.Setting
+	Status() []sync.Status
+	Sync(settings []string) error
+	Pause(settings []string) error
+	Resume(settings []string) error
+	Reload() (*sync.ReloadResult, error)
+	Subscribe() *queue.Ring[sync.Event]
+	Unsubscribe(*queue.Ring[sync.Event])
+}
+
+type Request struct {
+	Method   string   `json:"method"`
+	Settings []string `json:"settings,omitempty"`
+}
+
+type Response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Transfer is a transfer in progress of a setting.
+type Transfer struct {
+	Setting string `json:"setting"`
+	sync.Transfer
+}
+
+// SocketPath is the control socket of the daemon of instance, in the runtime dir of the user.
+func SocketPath(instance string) string {
+	return filepath.Join(xdg.RuntimeDir, pkg.AppIdentity, instance+".sock")
+}
@@ -0,0 +1,153 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bububa/osssync/internal/service/control/controltest"
+	"github.com/bububa/osssync/internal/service/sync"
+)
+
+func startServer(t *testing.T) (*controltest.Daemon, *Server, *Client) {
+	t.Helper()
+	d := controltest.NewDaemon()
+	path := filepath.Join(t.TempDir(), "control.sock")
+	s, err := Listen(path, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return d, s, NewClient(path)
+}
+
+func TestRequests(t *testing.T) {
+	d, _, c := startServer(t)
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		call func() (any, error)
+		want any
+	}{
+		{name: "settings", call: func() (any, error) { return c.Settings(ctx) }, want: d.Settings()},
+		{name: "status", call: func() (any, error) { return c.Status(ctx) }, want: d.Status()},
+		{name: "transfers", call: func() (any, error) { return c.Transfers(ctx) },
+			want: []Transfer{{Setting: "docs", Transfer: sync.Transfer{Op: "upload", Src: "a.txt", TotalBytes: 10}}}},
+		{name: "reload", call: func() (any, error) { return c.Reload(ctx) },
+			want: &sync.ReloadResult{Added: []string{"photos"}, Unchanged: []string{"docs"}}},
+		{name: "sync", call: func() (any, error) { return nil, c.Sync(ctx) }},
+		{name: "pause", call: func() (any, error) { return nil, c.Pause(ctx, "docs", "photos") }},
+		{name: "resume", call: func() (any, error) { return nil, c.Resume(ctx, "docs") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	want := []string{"reload:", "sync:", "pause:docs,photos", "resume:docs"}
+	if got := d.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("daemon calls %v, want %v", got, want)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	_, _, c := startServer(t)
+	if err := c.Pause(context.Background(), "music"); err == nil || err.Error() != "setting not found: music" {
+		t.Fatalf("expected the daemon error, got %v", err)
+	}
+	if err := c.call(context.Background(), Request{Method: "shutdown"}, nil); err == nil || err.Error() != "unknown method: shutdown" {
+		t.Fatalf("expected an unknown method error, got %v", err)
+	}
+	conn, err := net.Dial("unix", c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("not json\n"))
+	var resp [256]byte
+	n, _ := conn.Read(resp[:])
+	if got := string(resp[:n]); !strings.HasPrefix(got, `{"error":"invalid request`) {
+		t.Fatalf("expected an invalid request response, got %s", got)
+	}
+}
+
+func TestNotRunning(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := c.Status(context.Background()); !errors.Is(err, sync.ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning, got %v", err)
+	}
+}
+
+func TestListenInUse(t *testing.T) {
+	_, s, _ := startServer(t)
+	if _, err := Listen(s.path, controltest.NewDaemon()); !errors.Is(err, ErrSocketInUse) {
+		t.Fatalf("expected ErrSocketInUse, got %v", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	d, s, c := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan sync.Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Events(ctx, func(ev sync.Event) error {
+			received <- ev
+			return nil
+		})
+	}()
+	d.WaitSubscribers(t, 1)
+	sent := []sync.Event{
+		{Type: sync.EventSyncStart, Setting: "docs"},
+		{Type: sync.EventSyncComplete, Setting: "docs", Error: "upload a.txt: denied"},
+	}
+	for _, ev := range sent {
+		d.Events.Publish(ev)
+	}
+	for _, want := range sent {
+		select {
+		case got := <-received:
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("event not streamed")
+		}
+	}
+	// hanging up unsubscribes
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	d.WaitSubscribers(t, 0)
+
+	// closing the server ends the stream
+	go func() {
+		done <- c.Events(context.Background(), func(sync.Event) error { return nil })
+	}()
+	d.WaitSubscribers(t, 1)
+	s.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected the stream to end with an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not ended by Close")
+	}
+}
+
+var _ Daemon = (*controltest.Daemon)(nil)
@@ -0,0 +1,96 @@
+// Package controltest provides a fake daemon for the tests of the servers driving a control.Daemon.
+package controltest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg/queue"
+)
+
+// Daemon is a fake control.Daemon with the settings docs and photos, it records the calls made to it.
+// Calls naming another setting fail with "setting not found".
+type Daemon struct {
+	mu     gosync.Mutex
+	calls  []string
+	Events *queue.Broadcast[sync.Event]
+}
+
+func NewDaemon() *Daemon {
+	return &Daemon{Events: queue.NewBroadcast[sync.Event](10)}
+}
+
+func (d *Daemon) record(method string, settings []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, method+":"+strings.Join(settings, ","))
+	for _, name := range settings {
+		if !slices.ContainsFunc(d.Status(), func(s sync.Status) bool { return s.Name == name }) {
+			return fmt.Errorf("setting not found: %s", name)
+		}
+	}
+	return nil
+}
+
+// Calls are the calls made so far, each as method:settings.
+func (d *Daemon) Calls() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.calls)
+}
+
+func (d *Daemon) Settings() []config.Setting {
+	return []config.Setting{{Name: "docs", Local: "/home/docs"}}
+}
+
+func (d *Daemon) Status() []sync.Status {
+	return []sync.Status{
+		{Name: "docs", Queued: 3, Transfers: []sync.Transfer{{Op: "upload", Src: "a.txt", TotalBytes: 10}}},
+		{Name: "photos", Paused: true},
+	}
+}
+
+func (d *Daemon) Sync(settings []string) error {
+	return d.record("sync", settings)
+}
+
+func (d *Daemon) Pause(settings []string) error {
+	return d.record("pause", settings)
+}
+
+func (d *Daemon) Resume(settings []string) error {
+	return d.record("resume", settings)
+}
+
+func (d *Daemon) Reload() (*sync.ReloadResult, error) {
+	if err := d.record("reload", nil); err != nil {
+		return nil, err
+	}
+	return &sync.ReloadResult{Added: []string{"photos"}, Unchanged: []string{"docs"}}, nil
+}
+
+func (d *Daemon) Subscribe() *queue.Ring[sync.Event] {
+	return d.Events.Subscribe()
+}
+
+func (d *Daemon) Unsubscribe(r *queue.Ring[sync.Event]) {
+	d.Events.Unsubscribe(r)
+}
+
+// WaitSubscribers polls until n consumers are subscribed to the events, failing the test after 5s.
+func (d *Daemon) WaitSubscribers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Events.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, d.Events.Subscribers())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
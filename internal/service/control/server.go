@@ -0,0 +1,188 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/bububa/osssync/internal/service/log"
+)
+
+// ErrSocketInUse is returned by Listen when another daemon serves the control socket.
+var ErrSocketInUse = errors.New("control socket in use by another daemon")
+
+// requestTimeout bounds reading a request, so an idle client can't hold a connection open.
+const requestTimeout = 5 * time.Second
+
+type Server struct {
+	ln     net.Listener
+	daemon Daemon
+	path   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     gosync.WaitGroup
+}
+
+// Listen binds the control socket at path, replacing a stale socket left by a crashed daemon.
+func Listen(path string, daemon Daemon) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, ErrSocketInUse
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	s := NewServer(ln, daemon)
+	s.path = path
+	return s, nil
+}
+
+// NewServer serves the control API on ln, like a socket passed by systemd socket activation. Close leaves the socket file alone.
+func NewServer(ln net.Listener, daemon Daemon) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		ln:     ln,
+		daemon: daemon,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Serve accepts connections until Close.
+func (s *Server) Serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Logger().Error().Err(err).Msg("control accept")
+			}
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			if err := s.handle(conn); err != nil {
+				log.Logger().Warn().Err(err).Msg("control")
+			}
+		}()
+	}
+}
+
+// Close stops accepting connections, ends event streams and removes the socket.
+func (s *Server) Close() error {
+	s.cancel()
+	err := s.ln.Close()
+	s.wg.Wait()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+	return err
+}
+
+func (s *Server) handle(conn net.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return writeResponse(conn, nil, fmt.Errorf("invalid request: %w", err))
+	}
+	if req.Method == MethodEvents {
+		return s.streamEvents(conn, r)
+	}
+	result, err := s.call(req)
+	return writeResponse(conn, result, err)
+}
+
+func (s *Server) call(req Request) (any, error) {
+	switch req.Method {
+	case MethodSettings:
+		return s.daemon.Settings(), nil
+	case MethodStatus:
+		return s.daemon.Status(), nil
+	case MethodTransfers:
+		var ret []Transfer
+		for _, status := range s.daemon.Status() {
+			for _, t := range status.Transfers {
+				ret = append(ret, Transfer{Setting: status.Name, Transfer: t})
+			}
+		}
+		return ret, nil
+	case MethodSync:
+		return nil, s.daemon.Sync(req.Settings)
+	case MethodPause:
+		return nil, s.daemon.Pause(req.Settings)
+	case MethodResume:
+		return nil, s.daemon.Resume(req.Settings)
+	case MethodReload:
+		return s.daemon.Reload()
+	}
+	return nil, fmt.Errorf("unknown method: %s", req.Method)
+}
+
+// streamEvents writes events until the client hangs up or the server closes.
+func (s *Server) streamEvents(conn net.Conn, r *bufio.Reader) error {
+	sub := s.daemon.Subscribe()
+	defer s.daemon.Unsubscribe(sub)
+	if err := writeResponse(conn, nil, nil); err != nil {
+		return err
+	}
+	hangup := make(chan struct{})
+	go func() {
+		// clients never write after the request, a read returns once they close
+		r.ReadByte()
+		close(hangup)
+	}()
+	enc := json.NewEncoder(conn)
+	for {
+		select {
+		case ev, ok := <-sub.C():
+			if !ok {
+				return nil
+			}
+			if err := enc.Encode(ev); err != nil {
+				return err
+			}
+		case <-hangup:
+			return nil
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+func writeResponse(conn net.Conn, result any, err error) error {
+	var resp Response
+	if err != nil {
+		resp.Error = err.Error()
+	} else if result != nil {
+		bs, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Result = bs
+		}
+	}
+	return json.NewEncoder(conn).Encode(resp)
+}
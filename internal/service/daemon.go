@@ -0,0 +1,175 @@
+package service
+
+import (
+	"fmt"
+	gosync "sync"
+
+	"github.com/jinzhu/configor"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service/control"
+	"github.com/bububa/osssync/internal/service/log"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/internal/service/web"
+	"github.com/bububa/osssync/pkg/queue"
+	"github.com/bububa/osssync/pkg/systemd"
+)
+
+var (
+	controlServer *control.Server
+	webServer     *web.Server
+)
+
+// daemon exposes the syncer of this process to the control server.
+type daemon struct{}
+
+func (daemon) Settings() []config.Setting {
+	settings := Config().Settings
+	ret := make([]config.Setting, 0, len(settings))
+	for _, s := range settings {
+		ret = append(ret, s.Masked())
+	}
+	return ret
+}
+
+func (daemon) Status() []sync.Status {
+	return Syncer().Status()
+}
+
+func (daemon) Sync(names []string) error {
+	settings, err := Config().SelectSettings(names)
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		Syncer().Sync(&setting)
+	}
+	return nil
+}
+
+func (daemon) Pause(names []string) error {
+	settings, err := selectNamedSettings(names)
+	if err != nil {
+		return err
+	}
+	Syncer().Pause(settings...)
+	return nil
+}
+
+func (daemon) Resume(names []string) error {
+	settings, err := selectNamedSettings(names)
+	if err != nil {
+		return err
+	}
+	Syncer().Resume(settings...)
+	return nil
+}
+
+// Reload reports settings which failed to start in the result rather than as an error.
+func (daemon) Reload() (*sync.ReloadResult, error) {
+	ret, err := ReloadConfig()
+	if ret != nil {
+		return ret, nil
+	}
+	return nil, err
+}
+
+func (daemon) Subscribe() *queue.Ring[sync.Event] {
+	return Syncer().Subscribe()
+}
+
+func (daemon) Unsubscribe(r *queue.Ring[sync.Event]) {
+	Syncer().Unsubscribe(r)
+}
+
+// selectNamedSettings is like Config.SelectSettings, but returns nil rather than every setting if names is empty.
+func selectNamedSettings(names []string) ([]config.Setting, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return Config().SelectSettings(names)
+}
+
+// reloadMu serializes ReloadConfig, the config watcher and the control socket may reload at the same time.
+var reloadMu gosync.Mutex
+
+// ReloadConfig reads the config file again and applies it to the running syncer.
+func ReloadConfig() (*sync.ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	var cfg config.Config
+	loader := configor.New(&configor.Config{
+		Environment:          "production",
+		ErrorOnUnmatchedKeys: true,
+	})
+	if err := loader.Load(&cfg, path); err != nil {
+		return nil, err
+	}
+	if err := cfg.Resolve(); err != nil {
+		return nil, err
+	}
+	applyOverrides(&cfg)
+	// only swapped in once the new config resolved
+	SetConfig(&cfg)
+	return Reload(&cfg)
+}
+
+// startControl serves the control socket, taking it from systemd socket activation if the daemon was started that way.
+func startControl() {
+	logger := log.Logger()
+	lns, err := systemd.Listeners()
+	if err != nil {
+		logger.Error().Err(err).Msg("socket activation")
+	}
+	if ln, ok := lns[ControlSocketName]; ok {
+		controlServer = control.NewServer(ln, daemon{})
+	} else if srv, err := control.Listen(SocketPath(), daemon{}); err != nil {
+		logger.Error().Err(err).Msg("control socket")
+		return
+	} else {
+		controlServer = srv
+	}
+	go controlServer.Serve()
+}
+
+func closeControl() {
+	if webServer != nil {
+		webServer.Close()
+		webServer = nil
+	}
+	if controlServer != nil {
+		controlServer.Close()
+		controlServer = nil
+	}
+}
+
+// startWeb serves the REST API and dashboard if the config enables them.
+func startWeb() {
+	cfg := Config().HTTP
+	if cfg.Listen == "" {
+		return
+	}
+	logger := log.Logger()
+	addr, err := cfg.Address()
+	if err != nil {
+		logger.Error().Err(err).Msg("http listen")
+		return
+	}
+	token, err := web.Token(cfg.Token)
+	if err != nil {
+		logger.Error().Err(err).Msg("http token")
+		return
+	}
+	srv, err := web.Listen(addr, token, daemon{})
+	if err != nil {
+		logger.Error().Err(err).Msg("http listen")
+		return
+	}
+	webServer = srv
+	logger.Warn().Str("url", fmt.Sprintf("http://%s/?token=%s", srv.Addr(), token)).Msg("web dashboard")
+	go srv.Serve()
+}
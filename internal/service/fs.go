@@ -0,0 +1,22 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg/fs/oss"
+)
+
+// SettingFS returns the setting named name and an oss.FS rooted at its prefix.
+func SettingFS(name string, opts ...oss.Option) (*config.Setting, *oss.FS, error) {
+	setting, ok := Config().FindSetting(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("setting %s not found", name)
+	}
+	fs, err := sync.NewFS(&setting, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &setting, fs, nil
+}
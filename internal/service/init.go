@@ -2,28 +2,81 @@ package service
 
 import (
 	"context"
+	gosync "sync"
 
 	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service/sync"
 )
 
-var systemBarReloadCh = make(chan struct{}, 1)
+var (
+	systemBarReloadCh = make(chan struct{}, 1)
+	// systemBarMu guards sending to systemBarReloadCh against Close closing it
+	systemBarMu     gosync.Mutex
+	systemBarClosed bool
+	// stopWatchConfig stops reloading the config on changes and waits for the watcher to return
+	stopWatchConfig = func() {}
+)
 
 func Init(cfg *config.Config) {
 	SetConfig(cfg)
 }
 
-func Start(ctx context.Context) {
-	Syncer().Start(ctx, Config())
+// Start starts syncing and serves the control socket for other processes.
+// It returns ErrAlreadyRunning if another process runs a daemon with the same config.
+func Start(ctx context.Context) error {
+	if err := lockInstance(); err != nil {
+		return err
+	}
+	Syncer().SetInstance(Instance())
+	if err := Syncer().Start(ctx, Config()); err != nil {
+		unlockInstance()
+		return err
+	}
+	startControl()
+	startWeb()
+	notifySystemd(ctx)
+	watchCtx, cancel := context.WithCancel(ctx)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		watchConfig(watchCtx)
+	}()
+	stopWatchConfig = func() {
+		cancel()
+		<-watchDone
+	}
+	return nil
 }
 
 func Close() {
+	if instanceLock != nil {
+		notifyStopping()
+	}
+	// no reload may start once the syncer closes, neither from the config watcher nor from the control socket
+	stopWatchConfig()
+	closeControl()
 	Syncer().Close()
-	close(systemBarReloadCh)
+	unlockInstance()
+	systemBarMu.Lock()
+	defer systemBarMu.Unlock()
+	if !systemBarClosed {
+		systemBarClosed = true
+		close(systemBarReloadCh)
+	}
 }
 
-func Reload(cfg *config.Config) {
-	systemBarReloadCh <- struct{}{}
-	Syncer().Reload(cfg)
+// Reload applies cfg to the running syncer, restarting only the settings which changed.
+func Reload(cfg *config.Config) (*sync.ReloadResult, error) {
+	systemBarMu.Lock()
+	if !systemBarClosed {
+		select {
+		case systemBarReloadCh <- struct{}{}:
+		default:
+			// the system bar hasn't picked the last reload up yet, or there is none
+		}
+	}
+	systemBarMu.Unlock()
+	return Syncer().Reload(cfg)
 }
 
 func SystemBarReload() <-chan struct{} {
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+
+	"github.com/bububa/osssync/internal/service/control"
+	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/lockfile"
+)
+
+// ErrAlreadyRunning is returned by Start when a daemon already runs with the same config, it can be driven with Client.
+var ErrAlreadyRunning = errors.New("osssync is already running with this config")
+
+var instanceLock *lockfile.Lock
+
+// Instance identifies the daemon of the config in use, one may run per config file.
+func Instance() string {
+	path, _ := ConfigPath()
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := md5.Sum([]byte(path))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// PIDPath is the pid file the daemon of the config in use locks while it runs.
+func PIDPath() string {
+	return filepath.Join(xdg.RuntimeDir, pkg.AppIdentity, Instance()+".pid")
+}
+
+// SocketPath is the control socket of the daemon of the config in use.
+func SocketPath() string {
+	return control.SocketPath(Instance())
+}
+
+// Client talks to the daemon of the config in use over its control socket.
+func Client() *control.Client {
+	return control.NewClient(SocketPath())
+}
+
+// RunningPID is the pid of the daemon of the config in use, 0 if none is running.
+func RunningPID() int {
+	pid, _ := lockfile.Probe(PIDPath())
+	return pid
+}
+
+// LockInstance takes the pid lock of the config in use for a one-off run which must not overlap with the daemon,
+// it returns ErrAlreadyRunning if the daemon holds it. Release it with UnlockInstance.
+func LockInstance() error {
+	return lockInstance()
+}
+
+func UnlockInstance() {
+	unlockInstance()
+}
+
+func lockInstance() error {
+	lock, err := lockfile.Acquire(PIDPath())
+	if err != nil {
+		if errors.Is(err, lockfile.ErrLocked) {
+			return fmt.Errorf("%w: %w", ErrAlreadyRunning, err)
+		}
+		return err
+	}
+	instanceLock = lock
+	return nil
+}
+
+func unlockInstance() {
+	if instanceLock != nil {
+		instanceLock.Release()
+		instanceLock = nil
+	}
+}
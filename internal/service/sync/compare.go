@@ -0,0 +1,202 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alitto/pond/v2"
+	ossSDK "github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/pkg/fs/local"
+	"github.com/bububa/osssync/pkg/fs/oss"
+)
+
+// HashRoutines is the number of files hashed at the same time by a hash comparison.
+const HashRoutines = 8
+
+type DiffKind string
+
+const (
+	DiffOnlyLocal  DiffKind = "only-local"
+	DiffOnlyRemote DiffKind = "only-remote"
+	DiffDifferent  DiffKind = "different"
+)
+
+// Diff is a file which isn't the same on both sides, Path is relative to the setting folder and prefix.
+type Diff struct {
+	Path   string   `json:"path"`
+	Kind   DiffKind `json:"kind"`
+	Reason string   `json:"reason,omitempty"`
+	Local  *Object  `json:"local,omitempty"`
+	Remote *Object  `json:"remote,omitempty"`
+}
+
+type Object struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	CRC64   string    `json:"crc64,omitempty"`
+}
+
+type compareOptions struct {
+	hash bool
+}
+
+type CompareOption func(*compareOptions)
+
+// WithHash compares the crc64 of files with the same size instead of trusting modification times.
+func WithHash(hash bool) CompareOption {
+	return func(opts *compareOptions) {
+		opts.hash = hash
+	}
+}
+
+// Compare walks the local folder and the remote prefix of cfg and returns the files which differ by
+// existence, size, modification time or optionally hash, sorted by path.
+// A file is different by modification time when it was changed locally after it was uploaded.
+func Compare(ctx context.Context, cfg *config.Setting, fs *oss.FS, opts ...CompareOption) ([]Diff, error) {
+	var options compareOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	locals := make(map[string]os.FileInfo)
+	err := filepath.Walk(cfg.Local, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != cfg.Local && ignoredLocal(cfg, path) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.Local, path)
+		if err != nil {
+			return err
+		}
+		locals[filepath.ToSlash(rel)] = fi
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ret []Diff
+		// same size on both sides, decided by hash
+		sameSize []*Diff
+	)
+	if err := fs.Walk(ctx, ".", func(info *oss.FileInfo) error {
+		path := info.Path()
+		if ignoredRemote(cfg, path) {
+			return nil
+		}
+		remote := &Object{Size: info.Size(), ModTime: info.ModTime()}
+		fi, ok := locals[path]
+		if !ok {
+			ret = append(ret, Diff{Path: path, Kind: DiffOnlyRemote, Remote: remote})
+			return nil
+		}
+		delete(locals, path)
+		diff := &Diff{
+			Path:   path,
+			Kind:   DiffDifferent,
+			Local:  &Object{Size: fi.Size(), ModTime: fi.ModTime()},
+			Remote: remote,
+		}
+		if fi.Size() != info.Size() {
+			diff.Reason = "size"
+		} else if options.hash {
+			sameSize = append(sameSize, diff)
+			return nil
+		} else if fi.ModTime().After(info.ModTime()) {
+			diff.Reason = "mtime"
+		} else {
+			return nil
+		}
+		ret = append(ret, *diff)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for path, fi := range locals {
+		ret = append(ret, Diff{
+			Path:  path,
+			Kind:  DiffOnlyLocal,
+			Local: &Object{Size: fi.Size(), ModTime: fi.ModTime()},
+		})
+	}
+	if len(sameSize) > 0 {
+		diffs, err := compareHashes(ctx, cfg, fs, sameSize)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, diffs...)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	return ret, nil
+}
+
+// compareHashes returns the candidates whose crc64 differ, falling back to modification
+// times for objects without a crc64 header.
+func compareHashes(ctx context.Context, cfg *config.Setting, fs *oss.FS, candidates []*Diff) ([]Diff, error) {
+	pool := pond.NewPool(HashRoutines, pond.WithContext(ctx))
+	defer pool.StopAndWait()
+	group := pool.NewGroup()
+	for _, diff := range candidates {
+		group.SubmitErr(func() error {
+			header, err := fs.Meta(ctx, diff.Path)
+			if err != nil {
+				return err
+			}
+			diff.Remote.CRC64 = header.Get(ossSDK.HTTPHeaderOssCRC64)
+			if diff.Remote.CRC64 == "" {
+				if diff.Local.ModTime.After(diff.Remote.ModTime) {
+					diff.Reason = "mtime"
+				}
+				return nil
+			}
+			if diff.Local.CRC64, err = local.CRC64(filepath.Join(cfg.Local, filepath.FromSlash(diff.Path))); err != nil {
+				return err
+			}
+			if diff.Local.CRC64 != diff.Remote.CRC64 {
+				diff.Reason = "hash"
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	var ret []Diff
+	for _, diff := range candidates {
+		if diff.Reason != "" {
+			ret = append(ret, *diff)
+		}
+	}
+	return ret, nil
+}
+
+func ignoredLocal(cfg *config.Setting, path string) bool {
+	return oss.IsTempFile(path) || (cfg.IgnoreHiddenFiles && strings.HasPrefix(filepath.Base(path), "."))
+}
+
+func ignoredRemote(cfg *config.Setting, path string) bool {
+	if !cfg.IgnoreHiddenFiles {
+		return false
+	}
+	for _, name := range strings.Split(path, "/") {
+		if strings.HasPrefix(name, ".") {
+			return true
+		}
+	}
+	return false
+}
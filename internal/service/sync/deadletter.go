@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/pkg/lockfile"
+	"github.com/bububa/osssync/pkg/watcher"
+)
+
+// MaxAttempts is how many times a file event is tried before it is moved to the dead-letter file.
+const MaxAttempts = 3
+
+// deadLetterMu serializes the writers of dead-letter files within the process, the lock file of
+// lockDeadLetters across processes, sync --once and a daemon of another config may share the state dir.
+var deadLetterMu gosync.Mutex
+
+// deadLetterLockTimeout is how long a writer waits for another process writing the dead-letter file.
+const deadLetterLockTimeout = 10 * time.Second
+
+// DeadLetter is a file event which kept failing and won't be retried until the next full sync.
+// It is removed once its path syncs, by a later event or a full sync.
+type DeadLetter struct {
+	Path     string    `json:"path"`
+	Ori      string    `json:"ori,omitempty"`
+	Op       string    `json:"op"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterPath is the JSONL file dead-letter items of the setting are appended to.
+func DeadLetterPath(cfg *config.Setting) string {
+	return filepath.Join(StateDir(), "deadletter", cfg.Mountpoint()+".jsonl")
+}
+
+// ReadDeadLetters returns the dead-letter items of the setting, oldest first.
+func ReadDeadLetters(cfg *config.Setting) ([]DeadLetter, error) {
+	fd, err := os.Open(DeadLetterPath(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fd.Close()
+	var ret []DeadLetter
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		var item DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			continue
+		}
+		ret = append(ret, item)
+	}
+	return ret, scanner.Err()
+}
+
+// lockDeadLetters locks the dead-letter file of the setting for writing, call the returned func to unlock it.
+func lockDeadLetters(cfg *config.Setting) (func(), error) {
+	deadLetterMu.Lock()
+	lock, err := lockfile.AcquireWait(DeadLetterPath(cfg)+".lock", deadLetterLockTimeout)
+	if err != nil {
+		deadLetterMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		lock.Release()
+		deadLetterMu.Unlock()
+	}, nil
+}
+
+func appendDeadLetter(cfg *config.Setting, ev *watcher.Event, err error) error {
+	item := DeadLetter{
+		Path:     ev.File.Path(),
+		Op:       ev.Op.String(),
+		Error:    err.Error(),
+		Attempts: ev.Attempts,
+		FailedAt: time.Now(),
+	}
+	if ev.Ori != nil {
+		item.Ori = ev.Ori.Path()
+	}
+	unlock, err := lockDeadLetters(cfg)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	fn := DeadLetterPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(fn), 0o700); err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	bs, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(append(bs, '\n'))
+	return err
+}
+
+// removeDeadLetters drops the dead-letter items of the setting matching drop, the file is removed once empty.
+// It returns the number of items left.
+func removeDeadLetters(cfg *config.Setting, drop func(DeadLetter) bool) (int, error) {
+	unlock, err := lockDeadLetters(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	items, err := ReadDeadLetters(cfg)
+	if err != nil || len(items) == 0 {
+		return len(items), err
+	}
+	kept := items[:0]
+	for _, item := range items {
+		if !drop(item) {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) == len(items) {
+		return len(kept), nil
+	}
+	fn := DeadLetterPath(cfg)
+	if len(kept) == 0 {
+		return 0, os.Remove(fn)
+	}
+	var buf []byte
+	for _, item := range kept {
+		bs, err := json.Marshal(item)
+		if err != nil {
+			return len(items), err
+		}
+		buf = append(append(buf, bs...), '\n')
+	}
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return len(items), err
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return len(items), err
+	}
+	return len(kept), nil
+}
@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/grafana/tail"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/internal/service/log"
+	"github.com/bububa/osssync/pkg/fs/oss"
+	"github.com/bububa/osssync/pkg/watcher"
+)
+
+const (
+	// EventLogSize is the size the event log is rotated at, one rotated file is kept.
+	EventLogSize = 16 << 20
+)
+
+// ErrNotRunning is returned when no sync daemon is running.
+var ErrNotRunning = errors.New("no running sync daemon")
+
+type EventType string
+
+const (
+	// EventWatch is a file system change picked up by the watcher
+	EventWatch EventType = "watch"
+	// EventSyncStart is a batch of changes of a setting starting to sync
+	EventSyncStart EventType = "sync_start"
+	// EventSyncComplete is a batch of changes of a setting done syncing
+	EventSyncComplete EventType = "sync_complete"
+	// EventProgress is an oss.ProgressEvent of a transfer
+	EventProgress EventType = "progress"
+	// EventError is a failed operation
+	EventError EventType = "error"
+	// EventConflict is a remote file newer than the local one, it is left alone
+	EventConflict EventType = "conflict"
+)
+
+// Event is a machine readable record of sync activity, emitted as one json line per event.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+	Setting string    `json:"setting,omitempty"`
+	Op      string    `json:"op,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Ori     string    `json:"ori,omitempty"`
+	Src     string    `json:"src,omitempty"`
+	Dist    string    `json:"dist,omitempty"`
+	// TotalBytes, ConsumedBytes and RwBytes are the counters of a progress event
+	TotalBytes    int64  `json:"total_bytes,omitempty"`
+	ConsumedBytes int64  `json:"consumed_bytes,omitempty"`
+	RwBytes       int64  `json:"rw_bytes,omitempty"`
+	Status        string `json:"status,omitempty"`
+	Attempts      int    `json:"attempts,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+func newEvent(cfg *config.Setting, typ EventType) Event {
+	return Event{
+		Time:    time.Now(),
+		Type:    typ,
+		Setting: cfg.DisplayName(),
+	}
+}
+
+func watchEvent(cfg *config.Setting, ev *watcher.Event) Event {
+	ret := newEvent(cfg, EventWatch)
+	ret.Op = ev.Op.String()
+	if ev.File != nil {
+		ret.Path = ev.File.Path()
+	}
+	if ev.Ori != nil {
+		ret.Ori = ev.Ori.Path()
+	}
+	return ret
+}
+
+func progressEvent(cfg *config.Setting, ev oss.ProgressEvent) Event {
+	ret := newEvent(cfg, EventProgress)
+	ret.Op = ev.Op.String()
+	ret.Src = ev.Src
+	ret.Dist = ev.Dist
+	ret.TotalBytes = ev.TotalBytes
+	ret.ConsumedBytes = ev.ConsumedBytes
+	ret.RwBytes = ev.RwBytes
+	ret.Status = ev.Status()
+	return ret
+}
+
+func errorEvent(cfg *config.Setting, op string, path string, err error) Event {
+	ret := newEvent(cfg, EventError)
+	ret.Op = op
+	ret.Path = path
+	ret.Error = err.Error()
+	return ret
+}
+
+// EventLogPath is the file the daemon of instance appends its events to, see TailEvents.
+func EventLogPath(instance string) string {
+	return filepath.Join(StateDir(), instance+".events.jsonl")
+}
+
+// eventLog appends events to EventLogPath, truncating it first and rotating it once it reaches EventLogSize.
+type eventLog struct {
+	f    *os.File
+	path string
+	size int64
+}
+
+func openEventLog(instance string) (*eventLog, error) {
+	path := EventLogPath(instance)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{f: f, path: path}, nil
+}
+
+func (l *eventLog) write(ev Event) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	if l.size+int64(len(buf)) > EventLogSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(buf)
+	l.size += int64(n)
+	return err
+}
+
+func (l *eventLog) rotate() error {
+	l.f.Close()
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	l.f = f
+	l.size = 0
+	return nil
+}
+
+func (l *eventLog) close() {
+	l.f.Close()
+	os.Remove(l.path)
+	os.Remove(l.path + ".1")
+}
+
+// TailEvents calls fn with every event the daemon of instance emits from now on, until ctx is done or fn fails.
+// The caller checks the daemon is running.
+func TailEvents(ctx context.Context, instance string, fn func(Event) error) error {
+	t, err := tail.TailFile(EventLogPath(instance), tail.Config{
+		Follow:   true,
+		ReOpen:   true,
+		Location: &tail.SeekInfo{Whence: io.SeekEnd},
+		Logger:   tail.DiscardingLogger,
+	})
+	if err != nil {
+		return err
+	}
+	defer t.Cleanup()
+	defer t.Stop()
+	for {
+		select {
+		case line, ok := <-t.Lines:
+			if !ok {
+				return t.Err()
+			}
+			if line.Err != nil {
+				return line.Err
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(line.Text), &ev); err != nil {
+				log.Logger().Warn().Err(err).Str("line", line.Text).Msg("tail events")
+				continue
+			}
+			if err := fn(ev); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	ossSDK "github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/credentials"
+	"github.com/bububa/osssync/pkg/fs/oss"
+)
+
+func StateDir() string {
+	return filepath.Join(xdg.StateHome, pkg.AppIdentity)
+}
+
+// clients are shared by the settings with the same endpoint and credentials, like the settings of a connection,
+// so their handlers and mounts use one connection pool and renew temporary credentials once.
+var clients = pkg.NewMap[config.Access, *ossSDK.Client]()
+
+// client returns the shared client of access, creating it on first use.
+func client(access config.Access) (*ossSDK.Client, error) {
+	if clt, ok := clients.Load(access); ok {
+		return clt, nil
+	}
+	provider, err := access.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	clt, err := ossSDK.New(access.Endpoint, "", "", ossSDK.SetCredentialsProvider(credentials.NewCache(provider)))
+	if err != nil {
+		return nil, err
+	}
+	clt, _ = clients.LoadOrStore(access, clt)
+	return clt, nil
+}
+
+// pruneClients forgets the clients no setting uses anymore, e.g. after a key was rotated.
+func pruneClients(settings []config.Setting) {
+	used := make(map[config.Access]struct{}, len(settings))
+	for _, s := range settings {
+		used[s.Access] = struct{}{}
+	}
+	for _, access := range clients.Keys() {
+		if _, ok := used[access]; !ok {
+			clients.Delete(access)
+		}
+	}
+}
+
+func NewFS(cfg *config.Setting, opts ...oss.Option) (*oss.FS, error) {
+	shared, err := client(cfg.Access)
+	if err != nil {
+		return nil, err
+	}
+	clt, err := oss.NewBucketClient(shared, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]oss.Option{
+		oss.WithPrefix(cfg.Prefix),
+		oss.WithLocal(cfg.Local),
+		oss.WithStateDir(StateDir()),
+		oss.WithMultipart(cfg.MultipartThreshold, cfg.PartSize, cfg.Routines),
+	}, opts...)
+	return oss.NewFS(clt, opts...), nil
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/bububa/osssync/internal/config"
+)
+
+func TestSharedClients(t *testing.T) {
+	t.Cleanup(func() { pruneClients(nil) })
+	work := config.Access{Endpoint: "oss-cn-hangzhou.aliyuncs.com", AccessKeyID: "work-id", AccessKeySecret: "work-secret"}
+	other := config.Access{Endpoint: "oss-cn-beijing.aliyuncs.com", AccessKeyID: "other-id", AccessKeySecret: "other-secret"}
+	first, err := client(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := client(work); err != nil || second != first {
+		t.Fatalf("expected settings with the same access to share a client, got %p %p %v", first, second, err)
+	}
+	if _, err := client(other); err != nil {
+		t.Fatal(err)
+	}
+
+	// rotating the key of the connection leaves the old client unused
+	rotated := work
+	rotated.AccessKeySecret = "rotated-secret"
+	settings := []config.Setting{
+		{Name: "a", Credential: config.Credential{Access: rotated}},
+		{Name: "b", Credential: config.Credential{Access: other}},
+	}
+	pruneClients(settings)
+	if _, ok := clients.Load(work); ok {
+		t.Fatal("expected the client of the old key to be pruned")
+	}
+	if _, ok := clients.Load(other); !ok {
+		t.Fatal("expected the client still in use to be kept")
+	}
+	if clt, err := client(work); err != nil || clt == first {
+		t.Fatalf("expected a new client after pruning, got %v", err)
+	}
+}
@@ -2,122 +2,378 @@ package sync
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
 	"time"
 
-	"github.com/alitto/pond/v2"
+	ossSDK "github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/fsnotify/fsnotify"
 	"go.uber.org/atomic"
 
 	"github.com/bububa/osssync/internal/config"
 	"github.com/bububa/osssync/internal/service/log"
 	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/fs/local"
 	"github.com/bububa/osssync/pkg/fs/mount"
 	"github.com/bububa/osssync/pkg/fs/oss"
+	"github.com/bububa/osssync/pkg/queue"
+	"github.com/bububa/osssync/pkg/scheduler"
 	"github.com/bububa/osssync/pkg/watcher"
 )
 
+// OrphanedUploadTTL is how long an unreferenced multipart upload is kept before being aborted.
+const OrphanedUploadTTL = 24 * time.Hour
+
 type Handler struct {
 	fs           *oss.FS
-	buffer       *pkg.Map[string, *watcher.Event]
+	scheduler    *scheduler.Scheduler
+	queue        *watcher.Queue
 	mounter      *atomic.Pointer[mount.Mounter]
-	eventCh      chan *watcher.Event
-	statusCh     chan<- SyncEvent
+	statusCh     *queue.Ring[SyncEvent]
+	events       *queue.Broadcast[Event]
 	stopCh       chan struct{}
 	exitCh       chan struct{}
+	drainTimeout *atomic.Duration
 	closed       *atomic.Bool
-	cfg          *config.Setting
+	cfg          *atomic.Pointer[config.Setting]
 	enableDelete bool
+	transfers    *pkg.Map[string, Transfer]
+	syncing      *atomic.Bool
+	paused       *atomic.Bool
+	lastSync     *atomic.Time
+	lastTick     *atomic.Time
+	errors       *atomic.Uint64
+	lastError    *atomic.String
+	watchError   *atomic.String
+
+	// running counts the tasks of the batch in progress holding a scheduler slot, progressed is when one last moved
+	running    *atomic.Int32
+	progressed *atomic.Time
+	// deadLetters counts the items of the dead-letter file, kept by its writers so Status doesn't read it
+	deadLetters *atomic.Int64
+
+	// handoffMu guards the events received after the queue was persisted on shutdown, late holds them
+	// until handoff passes them to next, the handler replacing this one on reload
+	handoffMu gosync.Mutex
+	persisted bool
+	late      []*watcher.Event
+	next      *Handler
 }
 
-func NewHandler(cfg *config.Setting, statusCh chan<- SyncEvent) (*Handler, error) {
-	clt, err := oss.NewClient(cfg.Bucket, cfg.Endpoint, cfg.AccessKeyID, cfg.AccessKeySecret)
+// QueuePath is the file events of the setting overflow to, unprocessed events in it survive restarts.
+func QueuePath(cfg *config.Setting) string {
+	return filepath.Join(StateDir(), "queue", cfg.Mountpoint()+".jsonl")
+}
+
+func NewHandler(cfg *config.Setting, sched *scheduler.Scheduler, statusCh *queue.Ring[SyncEvent], events *queue.Broadcast[Event]) (*Handler, error) {
+	fs, err := NewFS(cfg)
 	if err != nil {
 		return nil, err
 	}
-	fs := oss.NewFS(clt, oss.WithPrefix(cfg.Prefix), oss.WithLocal(cfg.Local))
+	sched.SetWeight(cfg.Key(), cfg.Weight)
 	h := &Handler{
-		cfg:          cfg,
+		cfg:          atomic.NewPointer(cfg),
 		fs:           fs,
-		buffer:       pkg.NewMap[string, *watcher.Event](),
+		scheduler:    sched,
+		queue:        watcher.NewQueue(watcher.DefaultQueueSize, QueuePath(cfg)),
 		enableDelete: cfg.Delete,
 		statusCh:     statusCh,
-		eventCh:      make(chan *watcher.Event, 10000),
+		events:       events,
 		stopCh:       make(chan struct{}, 1),
 		exitCh:       make(chan struct{}, 1),
+		drainTimeout: atomic.NewDuration(0),
 		closed:       atomic.NewBool(false),
+		mounter:      atomic.NewPointer[mount.Mounter](nil),
+		transfers:    pkg.NewMap[string, Transfer](),
+		syncing:      atomic.NewBool(false),
+		running:      atomic.NewInt32(0),
+		progressed:   atomic.NewTime(time.Time{}),
+		paused:       atomic.NewBool(false),
+		lastSync:     atomic.NewTime(time.Time{}),
+		lastTick:     atomic.NewTime(time.Now()),
+		errors:       atomic.NewUint64(0),
+		lastError:    atomic.NewString(""),
+		watchError:   atomic.NewString(""),
+		deadLetters:  atomic.NewInt64(0),
+	}
+	if items, err := ReadDeadLetters(cfg); err == nil {
+		h.deadLetters.Store(int64(len(items)))
 	}
 	h.start()
 	return h, nil
 }
 
+// Receive queues ev. It keeps queueing while the handler shuts down, the events left are persisted once it
+// drained. Events received after that are held for handoff, the watcher dispatches to the handler until a
+// reload replaced it.
 func (h *Handler) Receive(ev *watcher.Event) {
+	h.handoffMu.Lock()
+	if next := h.next; next != nil {
+		h.handoffMu.Unlock()
+		next.Receive(ev)
+		return
+	}
+	if h.persisted {
+		h.late = append(h.late, ev)
+		h.handoffMu.Unlock()
+		return
+	}
+	h.queue.Push(ev)
+	h.handoffMu.Unlock()
+	h.publish(watchEvent(h.setting(), ev))
+}
+
+// handoff passes the events received since the handler shut down to next, and the ones it receives later on.
+// Without a next handler they are persisted with the queue.
+func (h *Handler) handoff(next *Handler) {
+	h.handoffMu.Lock()
+	defer h.handoffMu.Unlock()
+	late := h.late
+	h.late = nil
+	if next == nil {
+		for _, ev := range late {
+			h.queue.Push(ev)
+		}
+		if err := h.queue.Persist(); err != nil {
+			log.Logger().Error().Err(err).Str("setting", h.setting().DisplayName()).Msg("persist queue")
+		}
+		return
+	}
+	// under the lock, so the events received meanwhile queue behind the late ones
+	for _, ev := range late {
+		next.Receive(ev)
+	}
+	h.next = next
+}
+
+func (h *Handler) publish(ev Event) {
+	if h.events != nil {
+		h.events.Publish(ev)
+	}
+}
+
+// Queued is the number of file events waiting to be processed.
+func (h *Handler) Queued() int {
+	return h.queue.Len()
+}
+
+// SpilledEvents is the number of file events which overflowed to disk.
+func (h *Handler) SpilledEvents() uint64 {
+	return h.queue.Spilled()
+}
+
+// DroppedProgress is the number of progress events dropped because they weren't consumed in time.
+func (h *Handler) DroppedProgress() uint64 {
+	return h.fs.DroppedEvents()
+}
+
+// Status reports the sync state of the handler, the dead letters are counted in memory by their writers.
+func (h *Handler) Status() Status {
+	ret := Status{
+		Name:      h.setting().DisplayName(),
+		Key:       h.ConfigKey(),
+		Watcher:   WatcherOK,
+		Syncing:   h.syncing.Load(),
+		Paused:    h.paused.Load(),
+		Queued:    h.queue.Len(),
+		LastSync:  h.lastSync.Load(),
+		Errors:    h.errors.Load(),
+		LastError: h.lastError.Load(),
+		Spilled:   h.SpilledEvents(),
+	}
+	if h.fs != nil {
+		ret.DroppedProgress = h.DroppedProgress()
+	}
 	if h.closed.Load() {
+		ret.Watcher = WatcherStopped
+	} else if err := h.watchError.Load(); err != "" {
+		ret.Watcher = WatcherFailing
+		ret.WatchError = err
+	}
+	h.transfers.Range(func(_ string, t Transfer) bool {
+		ret.Transfers = append(ret.Transfers, t)
+		return true
+	})
+	ret.DeadLetters = int(h.deadLetters.Load())
+	return ret
+}
+
+// alive returns an error unless the process loop ticked within stale. A batch in progress holds up the loop,
+// so then the running tasks must have made progress within stale instead, a hung transfer fails the check.
+func (h *Handler) alive(stale time.Duration) error {
+	if h.closed.Load() {
+		return nil
+	}
+	if h.syncing.Load() {
+		// tasks waiting for a scheduler slot are held up by the ones running, which are checked themselves
+		if h.running.Load() == 0 {
+			return nil
+		}
+		if since := time.Since(h.progressed.Load()); since > stale {
+			return fmt.Errorf("%s: no transfer progress for %s", h.setting().DisplayName(), since.Round(time.Second))
+		}
+		return nil
+	}
+	if since := time.Since(h.lastTick.Load()); since > stale {
+		return fmt.Errorf("%s: no tick for %s", h.setting().DisplayName(), since.Round(time.Second))
+	}
+	return nil
+}
+
+// watchFailed records an error of the file watcher feeding the handler.
+func (h *Handler) watchFailed(err error) {
+	h.watchError.Store(err.Error())
+	h.publish(errorEvent(h.setting(), "watch", h.setting().Local, err))
+}
+
+func (h *Handler) failed(ev Event) {
+	h.errors.Inc()
+	h.lastError.Store(ev.Error)
+	h.publish(ev)
+}
+
+// retry queues ev again, or moves it to the dead-letter file once it failed MaxAttempts times.
+func (h *Handler) retry(ev *watcher.Event, err error) {
+	ev.Attempts++
+	failure := errorEvent(h.setting(), ev.Op.String(), ev.File.Path(), err)
+	failure.Attempts = ev.Attempts
+	h.failed(failure)
+	if ev.Attempts < MaxAttempts {
+		h.queue.Retry(ev)
 		return
 	}
-	h.eventCh <- ev
+	if err := appendDeadLetter(h.setting(), ev, err); err != nil {
+		log.Logger().Error().Err(err).Str("file", ev.File.Path()).Msg("dead letter")
+		return
+	}
+	h.deadLetters.Inc()
+}
+
+// Pause stops processing file events, they stay queued until Resume.
+func (h *Handler) Pause() {
+	h.paused.Store(true)
+}
+
+func (h *Handler) Resume() {
+	h.paused.Store(false)
 }
 
 func (h *Handler) Key() string {
-	return h.cfg.BucketKey()
+	return h.setting().BucketKey()
 }
 
 func (h *Handler) ConfigKey() string {
-	return h.cfg.Key()
+	return h.setting().Key()
 }
 
 func (h *Handler) FS() *oss.FS {
 	return h.fs
 }
 
+// setting is the setting the handler runs, Update may replace it while the handler runs.
+func (h *Handler) setting() *config.Setting {
+	return h.cfg.Load()
+}
+
+// HasChange reports whether the handler must be replaced to run cfg. Only the name and weight can change in place.
 func (h *Handler) HasChange(cfg *config.Setting) bool {
-	return h.cfg.Credential != cfg.Credential || h.cfg.IgnoreHiddenFiles != cfg.IgnoreHiddenFiles || h.cfg.Delete != cfg.Delete
+	running, wanted := *h.setting(), *cfg
+	running.Name, wanted.Name = "", ""
+	running.Weight, wanted.Weight = 0, 0
+	return running != wanted
+}
+
+// Update applies the changes of cfg which don't need a restart, see HasChange.
+func (h *Handler) Update(cfg *config.Setting) {
+	if cfg.Weight != h.setting().Weight {
+		h.scheduler.SetWeight(cfg.Key(), cfg.Weight)
+	}
+	h.cfg.Store(cfg)
 }
 
 func (h *Handler) start() {
 	logger := log.Logger()
 	go func() {
 		for ev := range h.fs.Events() {
+			key := ev.Op.String() + ":" + ev.Src
+			switch ev.EventType {
+			case ossSDK.TransferStartedEvent, ossSDK.TransferDataEvent:
+				h.transfers.Store(key, transferFromEvent(ev))
+			default:
+				h.transfers.Delete(key)
+			}
+			h.progressed.Store(time.Now())
+			h.publish(progressEvent(h.setting(), ev))
 			logger.Warn().Msg(ev.String())
 		}
 	}()
 	ticker := time.NewTicker(500 * time.Millisecond)
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				h.process(ctx)
-			case <-ctx.Done():
-				ticker.Stop()
-				return
-			}
+		if err := h.fs.ResumeRenameDirs(ctx); err != nil {
+			logger.Error().Err(err).Msg("resume rename")
+		}
+		if err := h.fs.ResumeUploads(ctx); err != nil {
+			logger.Error().Err(err).Msg("resume upload")
+		}
+		if keys, err := h.fs.AbortOrphanedUploads(ctx, OrphanedUploadTTL); err != nil {
+			logger.Error().Err(err).Msg("abort orphaned uploads")
+		} else if len(keys) > 0 {
+			logger.Warn().Strs("keys", keys).Msg("abort orphaned uploads")
 		}
 	}()
+	processed := make(chan struct{})
 	go func() {
+		defer close(processed)
+		defer ticker.Stop()
 		for {
 			select {
-			case event := <-h.eventCh:
-				if event != nil && event.File != nil {
-					h.buffer.Store(event.File.Path(), event)
+			case <-ticker.C:
+				// select picks a ready case at random, don't start a batch once stopping
+				select {
+				case <-h.stopCh:
+					return
+				default:
 				}
+				h.lastTick.Store(time.Now())
+				h.process(ctx)
 			case <-h.stopCh:
-				cancel()
-				h.closed.Store(true)
-				close(h.eventCh)
-				h.fs.Close()
-				h.Unmount()
-				close(h.exitCh)
 				return
 			}
 		}
 	}()
+	go func() {
+		<-h.stopCh
+		h.closed.Store(true)
+		// let the batch in progress finish, interrupted transfers keep their checkpoints and events go back to the queue
+		select {
+		case <-processed:
+		case <-time.After(h.drainTimeout.Load()):
+			logger.Warn().Str("setting", h.setting().DisplayName()).Msg("drain timeout, interrupting transfers")
+			cancel()
+			<-processed
+		}
+		cancel()
+		h.handoffMu.Lock()
+		if err := h.queue.Persist(); err != nil {
+			logger.Error().Err(err).Str("setting", h.setting().DisplayName()).Msg("persist queue")
+		}
+		h.persisted = true
+		h.handoffMu.Unlock()
+		h.fs.Close()
+		h.Unmount()
+		close(h.exitCh)
+	}()
 }
 
 func (h *Handler) Mount() error {
 	mounter := h.mounter.Load()
 	if mounter == nil {
-		if m, err := Mount(context.Background(), h.cfg); err != nil {
+		if m, err := Mount(context.Background(), h.setting()); err != nil {
 			return err
 		} else {
 			mounter = m
@@ -129,85 +385,375 @@ func (h *Handler) Mount() error {
 
 func (h *Handler) Unmount() {
 	if mounter := h.mounter.Load(); mounter != nil {
-		mounter.Unmount()
+		if err := mounter.Unmount(); err != nil {
+			log.Logger().Error().Err(err).Str("mountpoint", mounter.Mountpoint()).Msg("unmount")
+		}
 	}
 }
 
+// Close stops the handler, interrupting transfers in progress. Pending events are kept for the next start.
 func (h *Handler) Close() {
+	h.Shutdown(0)
+}
+
+// Shutdown stops the handler after waiting up to drain for the transfers in progress. Pending events are kept for the next start.
+func (h *Handler) Shutdown(drain time.Duration) {
+	h.drainTimeout.Store(drain)
 	close(h.stopCh)
 	<-h.exitCh
 }
 
 func (h *Handler) process(ctx context.Context) error {
-	var events []*watcher.Event
-	h.buffer.Range(func(key string, ev *watcher.Event) bool {
-		events = append(events, ev)
-		h.buffer.Delete(key)
-		return true
-	})
-	if len(events) > 0 && h.statusCh != nil {
-		h.statusCh <- SyncEvent{Handler: h, Status: SyncStart}
-		defer func() {
-			h.statusCh <- SyncEvent{Handler: h, Status: SyncComplete}
-		}()
+	if h.paused.Load() {
+		return nil
 	}
-	return h.handle(ctx, events...)
+	events := h.queue.Drain()
+	if len(events) == 0 {
+		return nil
+	}
+	h.syncing.Store(true)
+	if h.statusCh != nil {
+		h.statusCh.Push(SyncEvent{Handler: h, Status: SyncStart})
+	}
+	h.publish(newEvent(h.setting(), EventSyncStart))
+	err := h.handle(ctx, events...)
+	if err == nil {
+		h.lastSync.Store(time.Now())
+	}
+	h.syncing.Store(false)
+	if h.statusCh != nil {
+		h.statusCh.Push(SyncEvent{Handler: h, Status: SyncComplete})
+	}
+	complete := newEvent(h.setting(), EventSyncComplete)
+	if err != nil {
+		complete.Error = err.Error()
+	}
+	h.publish(complete)
+	return err
 }
 
 func (h *Handler) handle(ctx context.Context, evs ...*watcher.Event) error {
-	deletes := make([]string, 0, len(evs))
 	logger := log.Logger()
-	pool := pond.NewPool(10)
-	group := pool.NewGroup()
+	renamed := make(map[string]struct{}, len(evs))
+	for _, ev := range evs {
+		if ev.Op&fsnotify.Rename == fsnotify.Rename && ev.Ori != nil {
+			renamed[ev.Ori.Path()] = struct{}{}
+		}
+	}
+	var (
+		deletes   []string
+		deleteEvs []*watcher.Event
+		// deleting a rename source before the rename copied it would lose the file
+		lateDeletes   []string
+		lateDeleteEvs []*watcher.Event
+		// unfinished are events neither done nor queued for retry, they go back to the queue if ctx is cancelled
+		unfinished = pkg.NewMap[string, *watcher.Event]()
+		// synced are the paths done without error, their dead-letter items are resolved
+		synced = pkg.NewMap[string, struct{}]()
+	)
+	finish := func(ctx context.Context, err error, evs ...*watcher.Event) {
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		for _, ev := range evs {
+			unfinished.Delete(ev.File.Path())
+			if err == nil {
+				synced.Store(ev.File.Path(), struct{}{})
+			}
+		}
+	}
+	batch := h.scheduler.NewBatch(ctx)
+	dirs, evs := h.dirRenames(evs)
+	for _, dir := range dirs {
+		logger.Warn().Str("dir", dir.dist).Str("ori", dir.src).Int("files", len(dir.evs)).Msg("fsnotify rename dir")
+		for _, ev := range dir.evs {
+			unfinished.Store(ev.File.Path(), ev)
+		}
+		batch.Submit(h.renameDirTask(dir, finish))
+	}
+	// the files of a renamed directory must be in place before other events touch them
+	dirErr := batch.Wait()
 	for _, ev := range evs {
 		l := logger.Warn().Str("file", ev.File.String()).Str("op", ev.Op.String())
 		if ev.Ori != nil {
 			l.Str("ori", ev.Ori.String())
 		}
 		l.Msg("fsnotify")
-		if h.enableDelete && ev.Op&fsnotify.Remove == fsnotify.Remove {
+		// a removed rename target also has its rename source to remove, see eventHandler
+		if h.enableDelete && ev.Op&fsnotify.Remove == fsnotify.Remove && ev.Ori == nil {
 			remotePath, err := h.fs.RemotePathFromLocalFile(ev.File)
 			if err != nil {
 				logger.Error().Err(err).Str("op", ev.Op.String()).Str("file", ev.File.Path()).Send()
+				continue
+			}
+			unfinished.Store(ev.File.Path(), ev)
+			if _, ok := renamed[ev.File.Path()]; ok {
+				lateDeletes = append(lateDeletes, remotePath)
+				lateDeleteEvs = append(lateDeleteEvs, ev)
+			} else {
+				deletes = append(deletes, remotePath)
+				deleteEvs = append(deleteEvs, ev)
 			}
-			deletes = append(deletes, remotePath)
 		} else {
-			ev := ev
-			group.Submit(func() {
-				h.eventHandler(ctx, ev)
+			unfinished.Store(ev.File.Path(), ev)
+			priority := scheduler.PriorityNormal
+			if ev.Manual {
+				priority = scheduler.PriorityUrgent
+			}
+			batch.Submit(scheduler.Task{
+				Group:    h.ConfigKey(),
+				Priority: priority,
+				Size:     ev.File.Size(),
+				Run: h.tracked(func(ctx context.Context) error {
+					err := h.eventHandler(ctx, ev)
+					if err != nil && ctx.Err() == nil {
+						h.retry(ev, err)
+					}
+					finish(ctx, err, ev)
+					return err
+				}),
 			})
 		}
 	}
-	if len(deletes) > 0 {
-		group.Submit(func() {
-			h.fs.Remove(ctx, deletes...)
+	h.submitRemoves(batch, deletes, deleteEvs, scheduler.PriorityHigh, finish)
+	err := errors.Join(dirErr, batch.Wait())
+	if len(lateDeletes) > 0 {
+		h.submitRemoves(batch, lateDeletes, lateDeleteEvs, scheduler.PriorityNormal, finish)
+		err = errors.Join(err, batch.Wait())
+	}
+	if ctx.Err() != nil {
+		unfinished.Range(func(_ string, ev *watcher.Event) bool {
+			h.queue.Retry(ev)
+			return true
 		})
 	}
-	return group.Wait()
+	if synced.Count() > 0 {
+		count, err := removeDeadLetters(h.setting(), func(item DeadLetter) bool {
+			_, ok := synced.Load(item.Path)
+			return ok
+		})
+		if err != nil {
+			logger.Error().Err(err).Str("setting", h.setting().DisplayName()).Msg("dead letter")
+		} else {
+			h.deadLetters.Store(int64(count))
+		}
+	}
+	return err
+}
+
+// dirRename is a directory renamed locally, found from the rename events of the files moved along with it.
+type dirRename struct {
+	src  string
+	dist string
+	evs  []*watcher.Event
+}
+
+// dirRenames groups the rename events of files moved along with their directory, so the directory is
+// renamed at once by oss.FS.RenameDir. The other events are returned as they were.
+func (h *Handler) dirRenames(evs []*watcher.Event) ([]*dirRename, []*watcher.Event) {
+	root := filepath.Clean(h.setting().Local) + string(filepath.Separator)
+	groups := make(map[[2]string]*dirRename)
+	rest := make([]*watcher.Event, 0, len(evs))
+	for _, ev := range evs {
+		// a renamed file changed since is uploaded on its own
+		if ev.Op != fsnotify.Rename || ev.Ori == nil {
+			rest = append(rest, ev)
+			continue
+		}
+		src, dist, ok := renamedDirs(ev.Ori.Path(), ev.File.Path())
+		if !ok || !strings.HasPrefix(src, root) || !strings.HasPrefix(dist, root) {
+			rest = append(rest, ev)
+			continue
+		}
+		key := [2]string{src, dist}
+		dir, ok := groups[key]
+		if !ok {
+			dir = &dirRename{src: src, dist: dist}
+			groups[key] = dir
+		}
+		dir.evs = append(dir.evs, ev)
+	}
+	ret := make([]*dirRename, 0, len(groups))
+	for _, dir := range groups {
+		// files moved out of a directory which is still there are renamed one by one
+		if _, err := os.Stat(dir.src); !os.IsNotExist(err) {
+			rest = append(rest, dir.evs...)
+			continue
+		}
+		ret = append(ret, dir)
+	}
+	return ret, rest
+}
+
+// renamedDirs strips the trailing path elements src and dist have in common, what is left are the
+// directories renamed if the file moved along with its directory. A file renamed in place has none.
+func renamedDirs(src string, dist string) (string, string, bool) {
+	if filepath.Base(src) != filepath.Base(dist) {
+		return "", "", false
+	}
+	for filepath.Base(src) == filepath.Base(dist) && src != dist {
+		src, dist = filepath.Dir(src), filepath.Dir(dist)
+	}
+	return src, dist, src != dist
+}
+
+func (h *Handler) renameDirTask(dir *dirRename, finish func(context.Context, error, ...*watcher.Event)) scheduler.Task {
+	return scheduler.Task{
+		Group: h.ConfigKey(),
+		Run: h.tracked(func(ctx context.Context) error {
+			err := h.renameDir(ctx, dir)
+			if err != nil && ctx.Err() == nil {
+				// retried events are grouped again, RenameDir resumes from its journal
+				for _, ev := range dir.evs {
+					h.retry(ev, err)
+				}
+			}
+			finish(ctx, err, dir.evs...)
+			return err
+		}),
+	}
+}
+
+func (h *Handler) renameDir(ctx context.Context, dir *dirRename) error {
+	logger := log.Logger()
+	src, err := h.fs.RemotePathFromLocalFile(local.NewStaticFileInfo(dir.src, 0, os.ModeDir, time.Time{}))
+	if err != nil {
+		logger.Error().Err(err).Str("op", fsnotify.Rename.String()).Str("src", dir.src).Send()
+		return err
+	}
+	dist, err := h.fs.RemotePathFromLocalFile(local.NewStaticFileInfo(dir.dist, 0, os.ModeDir, time.Time{}))
+	if err != nil {
+		logger.Error().Err(err).Str("op", fsnotify.Rename.String()).Str("dist", dir.dist).Send()
+		return err
+	}
+	if err := h.fs.RenameDir(ctx, src, dist); err != nil {
+		logger.Error().Err(err).Str("op", fsnotify.Rename.String()).Str("src", src).Str("dist", dist).Send()
+		return err
+	}
+	return nil
+}
+
+// submitRemoves deletes the remote keys in tasks of up to oss.MaxDeleteKeys, keys[i] being the key of evs[i].
+func (h *Handler) submitRemoves(batch *scheduler.Batch, keys []string, evs []*watcher.Event, priority scheduler.Priority, finish func(context.Context, error, ...*watcher.Event)) {
+	for len(keys) > 0 {
+		n := min(len(keys), oss.MaxDeleteKeys)
+		batch.Submit(h.removeTask(keys[:n], evs[:n], priority, finish))
+		keys, evs = keys[n:], evs[n:]
+	}
+}
+
+// removeTask deletes keys, the events of the keys which weren't deleted are retried like failed uploads.
+func (h *Handler) removeTask(keys []string, evs []*watcher.Event, priority scheduler.Priority, finish func(context.Context, error, ...*watcher.Event)) scheduler.Task {
+	return scheduler.Task{
+		Group:    h.ConfigKey(),
+		Priority: priority,
+		Run: h.tracked(func(ctx context.Context) error {
+			deleted, err := h.fs.Remove(ctx, keys...)
+			if err != nil && ctx.Err() != nil {
+				// interrupted, the events go back to the queue
+				return err
+			}
+			done := make(map[string]struct{}, len(deleted))
+			for _, key := range deleted {
+				done[key] = struct{}{}
+			}
+			var missed int
+			for idx, ev := range evs {
+				if _, ok := done[h.fs.PathAddPrefix(keys[idx])]; ok {
+					finish(ctx, nil, ev)
+					continue
+				}
+				evErr := err
+				if evErr == nil {
+					missed++
+					evErr = fmt.Errorf("%s not deleted", keys[idx])
+				}
+				h.retry(ev, evErr)
+				finish(ctx, evErr, ev)
+			}
+			if err == nil && missed > 0 {
+				err = fmt.Errorf("%d of %d objects not deleted", missed, len(keys))
+			}
+			return err
+		}),
+	}
+}
+
+// tracked wraps the run of a task so alive can tell a task making progress from a hung one.
+func (h *Handler) tracked(run func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		h.running.Inc()
+		h.progressed.Store(time.Now())
+		defer func() {
+			h.progressed.Store(time.Now())
+			h.running.Dec()
+		}()
+		return run(ctx)
+	}
 }
 
 func (h *Handler) eventHandler(ctx context.Context, ev *watcher.Event) error {
 	logger := log.Logger()
 	if ev.Op&fsnotify.Create == fsnotify.Create || ev.Op&fsnotify.Write == fsnotify.Write {
 		if _, err := os.Stat(ev.File.Path()); err != nil {
+			if os.IsNotExist(err) {
+				// removed before it was uploaded
+				return nil
+			}
 			logger.Error().Err(err).Send()
 			return err
 		}
 		if err := h.fs.UploadFile(ctx, ev.File); err != nil {
 			logger.Error().Err(err).Str("op", ev.Op.String()).Str("file", ev.File.Path()).Send()
+			return err
+		}
+		if ev.Op&fsnotify.Rename == fsnotify.Rename && ev.Ori != nil {
+			// renamed and written since, the new content is uploaded so only the rename source is left to remove
+			src, err := h.fs.RemotePathFromLocalFile(ev.Ori)
+			if err != nil {
+				logger.Error().Err(err).Str("op", ev.Op.String()).Str("src", ev.Ori.Path()).Send()
+				return err
+			}
+			if err := h.removeKeys(ctx, src); err != nil {
+				logger.Error().Err(err).Str("op", ev.Op.String()).Str("src", src).Send()
+				return err
+			}
 		}
 	} else if ev.Op&fsnotify.Rename == fsnotify.Rename {
 		src, err := h.fs.RemotePathFromLocalFile(ev.Ori)
 		if err != nil {
 			logger.Error().Err(err).Str("op", ev.Op.String()).Str("src", ev.Ori.Path()).Send()
+			return err
 		}
 		dist, err := h.fs.RemotePathFromLocalFile(ev.File)
 		if err != nil {
 			logger.Error().Err(err).Str("op", ev.Op.String()).Str("dist", ev.File.Path()).Send()
+			return err
+		}
+		if h.enableDelete && ev.Op&fsnotify.Remove == fsnotify.Remove {
+			// renamed and removed since, neither path is left locally
+			if err := h.removeKeys(ctx, src, dist); err != nil {
+				logger.Error().Err(err).Str("op", ev.Op.String()).Str("src", src).Str("dist", dist).Send()
+				return err
+			}
+			return nil
 		}
 		if err := h.fs.Rename(ctx, src, dist); err != nil {
 			logger.Error().Err(err).Str("op", ev.Op.String()).Str("src", src).Str("dist", dist).Send()
+			return err
 		}
 	}
 	return nil
 }
+
+// removeKeys deletes the remote keys, failing unless all of them were deleted.
+func (h *Handler) removeKeys(ctx context.Context, keys ...string) error {
+	deleted, err := h.fs.Remove(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	if len(deleted) < len(keys) {
+		return fmt.Errorf("%d of %d objects not deleted", len(keys)-len(deleted), len(keys))
+	}
+	return nil
+}
@@ -2,8 +2,6 @@ package sync
 
 import (
 	"context"
-	"log"
-	"os"
 	"path/filepath"
 
 	"github.com/adrg/xdg"
@@ -14,19 +12,22 @@ import (
 	"github.com/bububa/osssync/pkg/fs/oss"
 )
 
+// Mount mounts the remote prefix of cfg under the xdg data dir.
 func Mount(ctx context.Context, cfg *config.Setting) (*mount.Mounter, error) {
 	mountpoint := filepath.Join(xdg.DataHome, pkg.AppIdentity, "mnt", cfg.Mountpoint())
-	if _, err := os.Stat(mountpoint); os.IsNotExist(err) {
-		if err := os.MkdirAll(mountpoint, os.ModePerm); err != nil {
-			log.Fatalln(err)
-		}
-	}
-	clt, err := oss.NewClient(cfg.Bucket, cfg.Endpoint, cfg.AccessKeyID, cfg.AccessKeySecret)
+	return MountAt(ctx, cfg, mountpoint)
+}
+
+// MountAt mounts the remote prefix of cfg at mountpoint and returns once the mount is ready.
+func MountAt(ctx context.Context, cfg *config.Setting, mountpoint string, opts ...mount.Option) (*mount.Mounter, error) {
+	fs, err := NewFS(cfg, oss.WithIgnoreHidden(cfg.IgnoreHiddenFiles))
 	if err != nil {
 		return nil, err
 	}
-	fs := oss.NewFS(clt, oss.WithPrefix(cfg.Prefix), oss.WithLocal(cfg.Local), oss.WithIgnoreHidden(cfg.IgnoreHiddenFiles))
-	mounter := mount.NewMounter(fs, mountpoint, cfg.Mountpoint())
-	go mounter.Mount(ctx)
+	mounter := mount.NewMounter(fs, mountpoint, cfg.Mountpoint(), opts...)
+	if err := mounter.Mount(ctx); err != nil {
+		fs.Close()
+		return nil, err
+	}
 	return mounter, nil
 }
@@ -0,0 +1,201 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/atomic"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/fs/local"
+	"github.com/bububa/osssync/pkg/fs/oss"
+	"github.com/bububa/osssync/pkg/scheduler"
+)
+
+// ReconcileFailure is a file a reconciliation couldn't transfer.
+type ReconcileFailure struct {
+	Path  string `json:"path"`
+	Op    string `json:"op"`
+	Error string `json:"error"`
+}
+
+// ReconcileSummary is the outcome of a one-off reconciliation of a setting.
+type ReconcileSummary struct {
+	Setting  string `json:"setting"`
+	Uploaded int    `json:"uploaded"`
+	Deleted  int    `json:"deleted"`
+	Bytes    int64  `json:"bytes"`
+	// Conflicts are the paths of remote files differing from the local ones without being older, they are never overwritten
+	Conflicts []string           `json:"conflicts,omitempty"`
+	Failures  []ReconcileFailure `json:"failures,omitempty"`
+	Duration  time.Duration      `json:"duration"`
+	mu        gosync.Mutex
+	emit      func(Event)
+}
+
+func (s *ReconcileSummary) fail(cfg *config.Setting, path string, op string, err error) {
+	s.mu.Lock()
+	s.Failures = append(s.Failures, ReconcileFailure{Path: path, Op: op, Error: err.Error()})
+	s.mu.Unlock()
+	s.emit(errorEvent(cfg, op, path, err))
+}
+
+// Reconcile brings the remote prefix of every setting up to date with its local folder and waits for all transfers:
+// interrupted renames and uploads are resumed, missing and locally modified files uploaded and, if the setting
+// enables Delete, remote files missing locally deleted. Settings share sched according to their weight.
+// fn, if not nil, is called with the events of the reconciliation, one at a time.
+func Reconcile(ctx context.Context, sched *scheduler.Scheduler, settings []config.Setting, fn func(Event)) []*ReconcileSummary {
+	ret := make([]*ReconcileSummary, len(settings))
+	var (
+		wg gosync.WaitGroup
+		mu gosync.Mutex
+	)
+	emit := func(ev Event) {
+		if fn == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		fn(ev)
+	}
+	for idx := range settings {
+		setting := &settings[idx]
+		summary := &ReconcileSummary{Setting: setting.DisplayName(), emit: emit}
+		ret[idx] = summary
+		sched.SetWeight(setting.Key(), setting.Weight)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			emit(newEvent(setting, EventSyncStart))
+			if err := reconcile(ctx, sched, setting, summary); err != nil {
+				summary.fail(setting, setting.Local, "reconcile", err)
+			}
+			summary.Duration = time.Since(start)
+			emit(newEvent(setting, EventSyncComplete))
+		}()
+	}
+	wg.Wait()
+	return ret
+}
+
+func reconcile(ctx context.Context, sched *scheduler.Scheduler, setting *config.Setting, summary *ReconcileSummary) error {
+	fs, err := NewFS(setting, oss.WithIgnoreHidden(setting.IgnoreHiddenFiles))
+	if err != nil {
+		return err
+	}
+	// the progress events are all emitted before reconcile returns, so none prints after the summary
+	emitted := make(chan struct{})
+	defer func() {
+		fs.Close()
+		<-emitted
+	}()
+	go func() {
+		defer close(emitted)
+		for ev := range fs.Events() {
+			summary.emit(progressEvent(setting, ev))
+		}
+	}()
+	if err := fs.ResumeRenameDirs(ctx); err != nil {
+		summary.fail(setting, setting.Local, "resume rename", err)
+	}
+	if err := fs.ResumeUploads(ctx); err != nil {
+		summary.fail(setting, setting.Local, "resume upload", err)
+	}
+	diffs, err := Compare(ctx, setting, fs)
+	if err != nil {
+		return err
+	}
+	var (
+		batch   = sched.NewBatch(ctx)
+		deletes []string
+		// unsynced are the local paths still differing from the remote, their dead-letter items stay
+		unsynced      = pkg.NewMap[string, struct{}]()
+		deletesFailed = atomic.NewBool(false)
+		localPath     = func(path string) string {
+			return filepath.Join(setting.Local, filepath.FromSlash(path))
+		}
+	)
+	for _, diff := range diffs {
+		if diff.Kind == DiffOnlyRemote {
+			if setting.Delete {
+				deletes = append(deletes, diff.Path)
+			}
+			continue
+		}
+		if diff.Kind == DiffDifferent && !diff.Local.ModTime.After(diff.Remote.ModTime) {
+			summary.mu.Lock()
+			summary.Conflicts = append(summary.Conflicts, diff.Path)
+			summary.mu.Unlock()
+			unsynced.Store(localPath(diff.Path), struct{}{})
+			conflict := newEvent(setting, EventConflict)
+			conflict.Path = diff.Path
+			conflict.Status = "skipped"
+			summary.emit(conflict)
+			continue
+		}
+		batch.Submit(scheduler.Task{
+			Group: setting.Key(),
+			Size:  diff.Local.Size,
+			Run: func(ctx context.Context) error {
+				path := localPath(diff.Path)
+				fi, err := os.Stat(path)
+				if err == nil {
+					err = fs.UploadFileTo(ctx, local.NewFileInfo(fi, local.WithPath(path)), diff.Path)
+				}
+				if err != nil {
+					unsynced.Store(path, struct{}{})
+					summary.fail(setting, diff.Path, oss.Upload.String(), err)
+					return err
+				}
+				summary.mu.Lock()
+				summary.Uploaded++
+				summary.Bytes += fi.Size()
+				summary.mu.Unlock()
+				return nil
+			},
+		})
+	}
+	for len(deletes) > 0 {
+		keys := deletes[:min(len(deletes), oss.MaxDeleteKeys)]
+		deletes = deletes[len(keys):]
+		batch.Submit(scheduler.Task{
+			Group:    setting.Key(),
+			Priority: scheduler.PriorityHigh,
+			Run: func(ctx context.Context) error {
+				deleted, err := fs.Remove(ctx, keys...)
+				summary.mu.Lock()
+				summary.Deleted += len(deleted)
+				summary.mu.Unlock()
+				if err != nil {
+					deletesFailed.Store(true)
+					summary.fail(setting, fmt.Sprintf("%d objects", len(keys)), oss.Remove.String(), err)
+				} else if len(deleted) < len(keys) {
+					deletesFailed.Store(true)
+					summary.fail(setting, fmt.Sprintf("%d objects", len(keys)-len(deleted)), oss.Remove.String(), fmt.Errorf("not deleted"))
+				}
+				return err
+			},
+		})
+	}
+	batch.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	// the remote now matches the local folder except for the paths which failed or were skipped
+	if _, err := removeDeadLetters(setting, func(item DeadLetter) bool {
+		if _, ok := unsynced.Load(item.Path); ok {
+			return false
+		}
+		return !deletesFailed.Load() || item.Op != fsnotify.Remove.String()
+	}); err != nil {
+		summary.fail(setting, DeadLetterPath(setting), "dead letter", err)
+	}
+	return nil
+}
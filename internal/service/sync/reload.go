@@ -0,0 +1,214 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/bububa/osssync/internal/config"
+)
+
+// ReloadResult is what applying a config changed, settings are given by display name.
+type ReloadResult struct {
+	// Added settings weren't running before
+	Added []string `json:"added,omitempty"`
+	// Removed settings are no longer in the config and were stopped
+	Removed []string `json:"removed,omitempty"`
+	// Restarted settings changed and got a new handler, their interrupted transfers resume
+	Restarted []string `json:"restarted,omitempty"`
+	// Unchanged settings kept running untouched
+	Unchanged []string `json:"unchanged,omitempty"`
+	// Failed settings couldn't be started, they aren't running
+	Failed []ReloadFailure `json:"failed,omitempty"`
+}
+
+// ReloadFailure is a setting which couldn't be started.
+type ReloadFailure struct {
+	Setting string `json:"setting"`
+	Error   string `json:"error"`
+}
+
+func (r *ReloadResult) fail(cfg *config.Setting, err error) {
+	r.Failed = append(r.Failed, ReloadFailure{Setting: cfg.DisplayName(), Error: err.Error()})
+}
+
+// drop removes a setting which failed after all from the other lists.
+func (r *ReloadResult) drop(name string) {
+	for _, names := range []*[]string{&r.Added, &r.Restarted, &r.Unchanged} {
+		*names = slices.DeleteFunc(*names, func(n string) bool {
+			return n == name
+		})
+	}
+}
+
+func (r *ReloadResult) sort() {
+	for _, names := range [][]string{r.Added, r.Removed, r.Restarted, r.Unchanged} {
+		sort.Strings(names)
+	}
+	sort.Slice(r.Failed, func(i, j int) bool {
+		return r.Failed[i].Setting < r.Failed[j].Setting
+	})
+}
+
+// Err joins the errors of the settings which failed to start.
+func (r *ReloadResult) Err() error {
+	errs := make([]error, 0, len(r.Failed))
+	for _, f := range r.Failed {
+		errs = append(errs, fmt.Errorf("%s: %s", f.Setting, f.Error))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *ReloadResult) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d restarted, %d unchanged, %d failed", len(r.Added), len(r.Removed), len(r.Restarted), len(r.Unchanged), len(r.Failed))
+}
+
+type reloadRequest struct {
+	cfg    *config.Config
+	result chan *ReloadResult
+}
+
+// reloadStage is a reload whose changed handlers are being stopped, see prepare and finish.
+type reloadStage struct {
+	req     reloadRequest
+	ret     *ReloadResult
+	stopped []*Handler
+	// dirty are the folders whose watcher must dispatch to a different set of handlers
+	dirty     map[string]struct{}
+	restarted map[string]struct{}
+}
+
+// apply makes the running handlers and watchers match cfg, see prepare and finish.
+func (s *Syncer) apply(cfg *config.Config) *ReloadResult {
+	stage := s.prepare(reloadRequest{cfg: cfg})
+	shutdown(stage.stopped, s.drain)
+	return s.finish(stage)
+}
+
+// prepare takes the removed and changed handlers of req out of the syncer, they must be shut down before finish.
+// Settings are matched by Setting.Key, only the added, removed and changed ones are touched so the others keep
+// their watcher and transfers in progress.
+func (s *Syncer) prepare(req reloadRequest) *reloadStage {
+	cfg := req.cfg
+	s.scheduler.SetLimit(cfg.Concurrency)
+	s.drain = cfg.Drain()
+	if s.drainOverride > 0 {
+		s.drain = s.drainOverride
+	}
+	stage := &reloadStage{
+		req:       req,
+		ret:       new(ReloadResult),
+		dirty:     make(map[string]struct{}),
+		restarted: make(map[string]struct{}),
+	}
+	settings := make(map[string]config.Setting, len(cfg.Settings))
+	for _, setting := range cfg.Settings {
+		settings[setting.Key()] = setting
+	}
+	for key, h := range s.handlers {
+		setting, ok := settings[key]
+		if ok && !h.HasChange(&setting) {
+			h.Update(&setting)
+			stage.ret.Unchanged = append(stage.ret.Unchanged, setting.DisplayName())
+			continue
+		}
+		stage.stopped = append(stage.stopped, h)
+		delete(s.handlers, key)
+		stage.dirty[h.setting().Local] = struct{}{}
+		if ok {
+			stage.restarted[key] = struct{}{}
+		} else {
+			stage.ret.Removed = append(stage.ret.Removed, h.setting().DisplayName())
+		}
+	}
+	return stage
+}
+
+// finish starts the added and changed handlers of a prepared reload once its stopped handlers shut down,
+// a restarted setting's new handler picks up the queue its old handler persisted.
+func (s *Syncer) finish(stage *reloadStage) *ReloadResult {
+	cfg, ret, dirty := stage.req.cfg, stage.ret, stage.dirty
+	for _, setting := range cfg.Settings {
+		key := setting.Key()
+		if _, ok := s.handlers[key]; ok {
+			continue
+		}
+		h, err := NewHandler(&setting, s.scheduler, s.eventCh, s.events)
+		if err != nil {
+			ret.fail(&setting, err)
+			continue
+		}
+		s.handlers[key] = h
+		dirty[setting.Local] = struct{}{}
+		if _, ok := stage.restarted[key]; ok {
+			ret.Restarted = append(ret.Restarted, setting.DisplayName())
+		} else {
+			ret.Added = append(ret.Added, setting.DisplayName())
+		}
+	}
+	folders := make(map[string][]*Handler, len(s.handlers))
+	for _, h := range s.handlers {
+		folders[h.setting().Local] = append(folders[h.setting().Local], h)
+	}
+	for local, w := range s.watchers {
+		if _, ok := folders[local]; !ok {
+			w.Close()
+			delete(s.watchers, local)
+		}
+	}
+	for local := range dirty {
+		handlers := folders[local]
+		if len(handlers) == 0 {
+			continue
+		}
+		sort.Slice(handlers, func(i, j int) bool {
+			return handlers[i].setting().Key() < handlers[j].setting().Key()
+		})
+		// the first setting of a folder decides the watcher filter, as on start
+		first := handlers[0].setting()
+		if w, ok := s.watchers[local]; ok {
+			if w.ignoreHiddenFiles == first.IgnoreHiddenFiles {
+				w.SetHandlers(handlers)
+				continue
+			}
+			w.Close()
+			delete(s.watchers, local)
+		}
+		w, err := Watch(first, handlers)
+		if err != nil {
+			// a setting without its watcher would silently stop syncing
+			for _, h := range handlers {
+				h.Close()
+				delete(s.handlers, h.setting().Key())
+				ret.drop(h.setting().DisplayName())
+				ret.fail(h.setting(), err)
+			}
+			continue
+		}
+		s.watchers[local] = w
+	}
+	// the stopped handlers kept taking the file events of their watchers until now, the ones of restarted
+	// settings go on to the new handlers
+	for _, h := range stage.stopped {
+		h.handoff(s.handlers[h.setting().Key()])
+	}
+	pruneClients(cfg.Settings)
+	ret.sort()
+	return ret
+}
+
+// abort answers a prepared reload the syncer stopped before finishing it, the settings it didn't start fail.
+func (s *Syncer) abort(stage *reloadStage) *ReloadResult {
+	err := errors.New("syncer stopped before the setting started")
+	for _, h := range stage.stopped {
+		h.handoff(nil)
+	}
+	for _, setting := range stage.req.cfg.Settings {
+		if _, ok := s.handlers[setting.Key()]; !ok {
+			stage.ret.fail(&setting, err)
+		}
+	}
+	stage.ret.sort()
+	return stage.ret
+}
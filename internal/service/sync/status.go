@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bububa/osssync/pkg/fs/oss"
+)
+
+// StatusInterval is how often a running daemon writes its status report.
+const StatusInterval = 2 * time.Second
+
+type WatcherHealth string
+
+const (
+	WatcherOK      WatcherHealth = "ok"
+	WatcherFailing WatcherHealth = "failing"
+	WatcherStopped WatcherHealth = "stopped"
+)
+
+// Transfer is an upload, download or copy in progress.
+type Transfer struct {
+	Op            string `json:"op"`
+	Src           string `json:"src"`
+	Dist          string `json:"dist"`
+	TotalBytes    int64  `json:"total_bytes"`
+	ConsumedBytes int64  `json:"consumed_bytes"`
+}
+
+func (t Transfer) Progress() float64 {
+	if t.TotalBytes == 0 {
+		return 0
+	}
+	return float64(t.ConsumedBytes) * 100 / float64(t.TotalBytes)
+}
+
+// Status is the sync state of a setting.
+type Status struct {
+	Name       string        `json:"name"`
+	Key        string        `json:"key"`
+	Watcher    WatcherHealth `json:"watcher"`
+	WatchError string        `json:"watch_error,omitempty"`
+	Syncing    bool          `json:"syncing"`
+	Paused     bool          `json:"paused,omitempty"`
+	Queued     int           `json:"queued"`
+	Transfers  []Transfer    `json:"transfers,omitempty"`
+	LastSync   time.Time     `json:"last_sync,omitempty"`
+	Errors     uint64        `json:"errors"`
+	LastError  string        `json:"last_error,omitempty"`
+	// DeadLetters is the number of items in the dead-letter file, read them with ReadDeadLetters
+	DeadLetters int `json:"dead_letters,omitempty"`
+	// Spilled is the number of file events which overflowed the queue to disk
+	Spilled uint64 `json:"spilled,omitempty"`
+	// DroppedProgress is the number of transfer progress updates dropped because they weren't consumed in time
+	DroppedProgress uint64 `json:"dropped_progress,omitempty"`
+	// DroppedEvents is the number of sync events the daemon dropped for slow consumers, it is shared by every setting
+	DroppedEvents uint64 `json:"dropped_events,omitempty"`
+}
+
+// StatusReport is written by a running daemon so other processes can read its state.
+type StatusReport struct {
+	PID       int       `json:"pid"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Settings  []Status  `json:"settings"`
+}
+
+// StatusReportPath is the report of the daemon of instance, each config runs its own daemon.
+func StatusReportPath(instance string) string {
+	return filepath.Join(StateDir(), instance+".status.json")
+}
+
+// ReadStatusReport returns the report of the daemon of instance, or nil if it isn't running.
+func ReadStatusReport(instance string) (*StatusReport, error) {
+	bs, err := os.ReadFile(StatusReportPath(instance))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var report StatusReport
+	if err := json.Unmarshal(bs, &report); err != nil {
+		return nil, err
+	}
+	// the daemon rewrites the report every StatusInterval and removes it on exit
+	if time.Since(report.UpdatedAt) > 3*StatusInterval {
+		return nil, nil
+	}
+	return &report, nil
+}
+
+func writeStatusReport(instance string, report *StatusReport) error {
+	fn := StatusReportPath(instance)
+	if err := os.MkdirAll(filepath.Dir(fn), 0o700); err != nil {
+		return err
+	}
+	bs, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+func transferFromEvent(ev oss.ProgressEvent) Transfer {
+	return Transfer{
+		Op:            ev.Op.String(),
+		Src:           ev.Src,
+		Dist:          ev.Dist,
+		TotalBytes:    ev.TotalBytes,
+		ConsumedBytes: ev.ConsumedBytes,
+	}
+}
@@ -4,12 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"sort"
+	gosync "sync"
+	"time"
 
 	"github.com/bububa/osssync/internal/config"
 	"github.com/bububa/osssync/internal/service/log"
-	"github.com/bububa/osssync/pkg/watcher"
+	"github.com/bububa/osssync/pkg/queue"
+	"github.com/bububa/osssync/pkg/scheduler"
 )
 
+// EventQueueSize is the number of SyncEvent and Event kept for slow consumers, older ones are dropped first.
+const EventQueueSize = 1000
+
 type SyncStatus int32
 
 const (
@@ -17,6 +25,16 @@ const (
 	SyncStart
 )
 
+type pauseRequest struct {
+	settings []config.Setting
+	paused   bool
+}
+
+type aliveRequest struct {
+	stale  time.Duration
+	result chan error
+}
+
 type SyncEvent struct {
 	Handler    *Handler
 	SettingKey string
@@ -24,45 +42,103 @@ type SyncEvent struct {
 }
 
 type Syncer struct {
-	reloadCh chan *config.Config
-	syncCh   chan *config.Setting
-	mountCh  chan *config.Setting
-	eventCh  chan SyncEvent
-	stopCh   chan struct{}
-	exitCh   chan struct{}
-	watchers map[string]*watcher.Watcher
+	scheduler *scheduler.Scheduler
+	reloadCh  chan reloadRequest
+	syncCh    chan *config.Setting
+	mountCh   chan *config.Setting
+	pauseCh   chan pauseRequest
+	statusCh  chan chan []Status
+	aliveCh   chan aliveRequest
+	eventCh   *queue.Ring[SyncEvent]
+	events    *queue.Broadcast[Event]
+	eventLog  chan struct{}
+	stopCh    chan struct{}
+	exitCh    chan struct{}
+	// watchers are keyed by local folder, handlers by Setting.Key
+	watchers map[string]*FolderWatcher
 	handlers map[string]*Handler
-	closed   bool
+	// instance keys the status report and event log, see SetInstance
+	instance string
+	// drain is how long stopping waits for transfers in progress
+	drain time.Duration
+	// drainOverride replaces the DrainTimeout of every config applied when set, see SetDrainTimeout
+	drainOverride time.Duration
+	closed        bool
+	started       bool
 }
 
 func NewSyncer() *Syncer {
 	return &Syncer{
-		watchers: make(map[string]*watcher.Watcher),
-		handlers: make(map[string]*Handler),
-		eventCh:  make(chan SyncEvent, 1000),
-		syncCh:   make(chan *config.Setting, 1),
-		mountCh:  make(chan *config.Setting, 1),
-		reloadCh: make(chan *config.Config, 1),
-		stopCh:   make(chan struct{}, 1),
-		exitCh:   make(chan struct{}, 1),
+		scheduler: scheduler.New(scheduler.DefaultLimit),
+		watchers:  make(map[string]*FolderWatcher),
+		handlers:  make(map[string]*Handler),
+		eventCh:   queue.NewRing[SyncEvent](EventQueueSize),
+		events:    queue.NewBroadcast[Event](EventQueueSize),
+		syncCh:    make(chan *config.Setting, 1),
+		mountCh:   make(chan *config.Setting, 1),
+		pauseCh:   make(chan pauseRequest, 1),
+		statusCh:  make(chan chan []Status),
+		aliveCh:   make(chan aliveRequest),
+		reloadCh:  make(chan reloadRequest),
+		stopCh:    make(chan struct{}, 1),
+		exitCh:    make(chan struct{}, 1),
+	}
+}
+
+// SetInstance names the daemon the syncer runs in, so daemons of different configs keep their status
+// reports and event logs apart. It must be called before Start.
+func (s *Syncer) SetInstance(instance string) {
+	s.instance = instance
+}
+
+// SetDrainTimeout overrides the DrainTimeout of the config, also of the configs reloaded later.
+// It must be called before Start.
+func (s *Syncer) SetDrainTimeout(d time.Duration) error {
+	if d < time.Second {
+		return fmt.Errorf("drain timeout %s is below 1s", d)
 	}
+	s.drainOverride = d
+	return nil
 }
 
 func (s *Syncer) Start(ctx context.Context, cfg *config.Config) error {
-	if err := s.start(ctx, cfg); err != nil {
+	if err := s.apply(cfg).Err(); err != nil {
+		s.stop()
 		return err
 	}
+	s.started = true
 	logger := log.Logger()
+	s.startEventLog()
+	ticker := time.NewTicker(StatusInterval)
 	go func() {
+		// reloadCh is nil while a reload drains its stopped handlers off the loop, one reload runs at a time
+		reloadCh := s.reloadCh
+		var reloading *reloadStage
+		drained := make(chan *reloadStage, 1)
 		for {
 			select {
-			case cfg := <-s.reloadCh:
-				if s.closed || cfg == nil {
-					return
-				}
-				if err := s.reload(ctx, cfg); err != nil {
+			case <-ticker.C:
+				s.writeStatusReport()
+			case ch := <-s.statusCh:
+				ch <- s.status()
+			case req := <-s.aliveCh:
+				req.result <- s.alive(req.stale)
+			case req := <-reloadCh:
+				// draining on the loop would hold up Alive for the drain timeout and starve the watchdog. The
+				// watchers keep dispatching to the stopped handlers meanwhile, finish hands their events on
+				reloading, reloadCh = s.prepare(req), nil
+				go func(stage *reloadStage, drain time.Duration) {
+					shutdown(stage.stopped, drain)
+					drained <- stage
+				}(reloading, s.drain)
+			case stage := <-drained:
+				reloading, reloadCh = nil, s.reloadCh
+				ret := s.finish(stage)
+				if err := ret.Err(); err != nil {
 					logger.Error().Err(err).Msg("reload")
 				}
+				logger.Info().Msgf("reload: %s", ret)
+				stage.req.result <- ret
 			case setting := <-s.syncCh:
 				if s.closed || setting == nil {
 					return
@@ -73,11 +149,23 @@ func (s *Syncer) Start(ctx context.Context, cfg *config.Config) error {
 					return
 				}
 				s.mount(setting)
+			case req := <-s.pauseCh:
+				s.pause(req)
 			case <-s.stopCh:
+				ticker.Stop()
+				os.Remove(StatusReportPath(s.instance))
+				if reloading != nil {
+					<-drained
+					reloading.req.result <- s.abort(reloading)
+				}
 				s.closed = true
-				s.stop(nil)
-				close(s.reloadCh)
-				close(s.eventCh)
+				s.stop()
+				s.scheduler.Close()
+				s.eventCh.Close()
+				s.events.Close()
+				if s.eventLog != nil {
+					<-s.eventLog
+				}
 				close(s.syncCh)
 				close(s.mountCh)
 				close(s.exitCh)
@@ -88,14 +176,20 @@ func (s *Syncer) Start(ctx context.Context, cfg *config.Config) error {
 	return nil
 }
 
-func (s *Syncer) Reload(cfg *config.Config) {
-	s.reloadCh <- cfg
-}
-
-func (s *Syncer) SyncAll() {
-	for _, w := range s.watchers {
-		w.Notify("")
+// Reload applies cfg to the running settings, see ReloadResult for what it changed.
+// The error joins the errors of the settings which failed to start.
+func (s *Syncer) Reload(cfg *config.Config) (*ReloadResult, error) {
+	if !s.started {
+		return nil, ErrNotRunning
 	}
+	req := reloadRequest{cfg: cfg, result: make(chan *ReloadResult, 1)}
+	select {
+	case s.reloadCh <- req:
+	case <-s.exitCh:
+		return nil, ErrNotRunning
+	}
+	ret := <-req.result
+	return ret, ret.Err()
 }
 
 func (s *Syncer) Sync(cfg *config.Setting) {
@@ -106,63 +200,160 @@ func (s *Syncer) Mount(cfg *config.Setting) {
 	s.mountCh <- cfg
 }
 
+// Pause stops syncing the settings, or every setting if none is given. File changes keep being queued.
+func (s *Syncer) Pause(settings ...config.Setting) {
+	s.pauseCh <- pauseRequest{settings: settings, paused: true}
+}
+
+// Resume syncs the settings paused by Pause again, or every setting if none is given.
+func (s *Syncer) Resume(settings ...config.Setting) {
+	s.pauseCh <- pauseRequest{settings: settings}
+}
+
+// Scheduler is the transfer scheduler shared by every handler.
+func (s *Syncer) Scheduler() *scheduler.Scheduler {
+	return s.scheduler
+}
+
+// Status returns the sync state of every running setting.
+func (s *Syncer) Status() []Status {
+	if !s.started {
+		return nil
+	}
+	ch := make(chan []Status, 1)
+	select {
+	case s.statusCh <- ch:
+		return <-ch
+	case <-s.exitCh:
+		return nil
+	}
+}
+
+// Alive returns an error unless the sync loop answers within timeout and the loop of every handler ticked within stale.
+func (s *Syncer) Alive(timeout, stale time.Duration) error {
+	if !s.started {
+		return nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	req := aliveRequest{stale: stale, result: make(chan error, 1)}
+	select {
+	case s.aliveCh <- req:
+	case <-s.exitCh:
+		return errors.New("syncer stopped")
+	case <-timer.C:
+		return fmt.Errorf("sync loop not answering within %s", timeout)
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("sync loop not answering within %s", timeout)
+	}
+}
+
+func (s *Syncer) alive(stale time.Duration) error {
+	errs := make([]error, 0, len(s.handlers))
+	for _, h := range s.handlers {
+		errs = append(errs, h.alive(stale))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Syncer) status() []Status {
+	ret := make([]Status, 0, len(s.handlers))
+	dropped := s.DroppedEvents()
+	for _, h := range s.handlers {
+		status := h.Status()
+		status.DroppedEvents = dropped
+		ret = append(ret, status)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func (s *Syncer) writeStatusReport() {
+	if err := writeStatusReport(s.instance, &StatusReport{
+		PID:       os.Getpid(),
+		UpdatedAt: time.Now(),
+		Settings:  s.status(),
+	}); err != nil {
+		log.Logger().Error().Err(err).Msg("write status report")
+	}
+}
+
 func (s *Syncer) Events() <-chan SyncEvent {
-	return s.eventCh
-}
-
-func (s *Syncer) start(ctx context.Context, cfg *config.Config) error {
-	settings := cfg.Settings
-	handlers := make(map[string][]*Handler, len(settings))
-	s.watchers = make(map[string]*watcher.Watcher, len(settings))
-	for _, setting := range settings {
-		key := setting.Local
-		bucketKey := setting.BucketKey()
-		if h, ok := s.handlers[bucketKey]; ok && !h.HasChange(&setting) {
-			handlers[key] = append(handlers[key], s.handlers[bucketKey])
-		} else {
-			if h, err := NewHandler(&setting, s.eventCh); err != nil {
-				return err
-			} else {
-				handlers[key] = append(handlers[key], h)
-				s.handlers[bucketKey] = h
-			}
-		}
+	return s.eventCh.C()
+}
+
+// DroppedSyncEvents is the number of SyncEvent dropped because Events wasn't drained in time,
+// a consumer seeing it grow has missed state transitions and should resync from Status.
+func (s *Syncer) DroppedSyncEvents() uint64 {
+	return s.eventCh.Dropped()
+}
+
+// Subscribe returns a ring receiving every Event of the running settings, release it with Unsubscribe.
+func (s *Syncer) Subscribe() *queue.Ring[Event] {
+	return s.events.Subscribe()
+}
+
+func (s *Syncer) Unsubscribe(r *queue.Ring[Event]) {
+	s.events.Unsubscribe(r)
+}
+
+// startEventLog writes events to EventLogPath for other processes to tail, until the syncer is closed.
+func (s *Syncer) startEventLog() {
+	logger := log.Logger()
+	l, err := openEventLog(s.instance)
+	if err != nil {
+		logger.Error().Err(err).Msg("open event log")
+		return
 	}
-	for _, setting := range settings {
-		key := setting.Local
-		if _, ok := s.watchers[key]; !ok {
-			if w, err := Watch(&setting, handlers[key]); err != nil {
-				return err
-			} else {
-				s.watchers[key] = w
+	sub := s.events.Subscribe()
+	s.eventLog = make(chan struct{})
+	go func() {
+		defer close(s.eventLog)
+		defer l.close()
+		for ev := range sub.C() {
+			if err := l.write(ev); err != nil {
+				logger.Error().Err(err).Msg("write event log")
 			}
 		}
-	}
-	return nil
+	}()
 }
 
-func (s *Syncer) reload(ctx context.Context, cfg *config.Config) error {
-	s.stop(cfg)
-	return s.start(ctx, cfg)
+// DroppedEvents is the number of sync events dropped because Events wasn't drained in time,
+// and of events dropped for subscribers which didn't keep up.
+func (s *Syncer) DroppedEvents() uint64 {
+	return s.eventCh.Dropped() + s.events.Dropped()
 }
 
-func (s *Syncer) stop(cfg *config.Config) {
+func (s *Syncer) stop() {
 	for _, w := range s.watchers {
 		w.Close()
 	}
-	s.watchers = nil
-	for bucketKey, h := range s.handlers {
-		if cfg != nil {
-			for _, setting := range cfg.Settings {
-				if !h.HasChange(&setting) {
-					h.Close()
-					delete(s.handlers, bucketKey)
-				}
-			}
-		} else {
-			h.Close()
-		}
+	s.watchers = make(map[string]*FolderWatcher)
+	handlers := make([]*Handler, 0, len(s.handlers))
+	for _, h := range s.handlers {
+		handlers = append(handlers, h)
 	}
+	shutdown(handlers, s.drain)
+	s.handlers = make(map[string]*Handler)
+}
+
+// shutdown stops handlers at the same time, so it takes at most one drain timeout.
+func shutdown(handlers []*Handler, drain time.Duration) {
+	var wg gosync.WaitGroup
+	for _, h := range handlers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.Shutdown(drain)
+		}()
+	}
+	wg.Wait()
 }
 
 func (s *Syncer) sync(cfg *config.Setting) {
@@ -172,8 +363,29 @@ func (s *Syncer) sync(cfg *config.Setting) {
 	}
 }
 
+func (s *Syncer) pause(req pauseRequest) {
+	handlers := make([]*Handler, 0, len(s.handlers))
+	if len(req.settings) == 0 {
+		for _, h := range s.handlers {
+			handlers = append(handlers, h)
+		}
+	}
+	for _, setting := range req.settings {
+		if h, ok := s.handlers[setting.Key()]; ok {
+			handlers = append(handlers, h)
+		}
+	}
+	for _, h := range handlers {
+		if req.paused {
+			h.Pause()
+		} else {
+			h.Resume()
+		}
+	}
+}
+
 func (s *Syncer) mount(cfg *config.Setting) error {
-	h, ok := s.handlers[cfg.BucketKey()]
+	h, ok := s.handlers[cfg.Key()]
 	if !ok {
 		return errors.New("handler not exists")
 	}
@@ -181,6 +393,9 @@ func (s *Syncer) mount(cfg *config.Setting) error {
 }
 
 func (s *Syncer) Close() {
+	if !s.started {
+		return
+	}
 	fmt.Println("syncer close")
 	close(s.stopCh)
 	<-s.exitCh
@@ -0,0 +1,519 @@
+package sync
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	ossSDK "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/atomic"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/pkg"
+	"github.com/bububa/osssync/pkg/fs/local"
+	"github.com/bububa/osssync/pkg/fs/oss"
+	"github.com/bububa/osssync/pkg/scheduler"
+	"github.com/bububa/osssync/pkg/watcher"
+)
+
+func TestAliveStuckLoop(t *testing.T) {
+	s := NewSyncer()
+	if err := s.Alive(10*time.Millisecond, time.Second); err != nil {
+		t.Fatalf("expected a syncer which isn't started to pass, got %v", err)
+	}
+	// started but its loop never answers
+	s.started = true
+	if err := s.Alive(10*time.Millisecond, time.Second); err == nil || !strings.Contains(err.Error(), "not answering") {
+		t.Fatalf("expected a stuck loop to fail, got %v", err)
+	}
+}
+
+func TestHandlerAlive(t *testing.T) {
+	h := &Handler{
+		cfg:      atomic.NewPointer(&config.Setting{Name: "docs"}),
+		closed:   atomic.NewBool(false),
+		syncing:  atomic.NewBool(false),
+		lastTick: atomic.NewTime(time.Now()),
+	}
+	if err := h.alive(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	h.lastTick.Store(time.Now().Add(-time.Minute))
+	if err := h.alive(time.Second); err == nil || !strings.Contains(err.Error(), "docs") {
+		t.Fatalf("expected a stale tick to fail, got %v", err)
+	}
+	// a batch in progress blocks the ticker without the handler being stuck
+	h.syncing.Store(true)
+	h.running, h.progressed = atomic.NewInt32(0), atomic.NewTime(time.Now().Add(-time.Minute))
+	if err := h.alive(time.Second); err != nil {
+		t.Fatalf("expected a batch waiting for a scheduler slot to pass, got %v", err)
+	}
+	h.running.Inc()
+	if err := h.alive(time.Second); err == nil || !strings.Contains(err.Error(), "no transfer progress") {
+		t.Fatalf("expected a hung transfer to fail, got %v", err)
+	}
+	h.progressed.Store(time.Now())
+	if err := h.alive(time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadDrainsOffLoop(t *testing.T) {
+	testStateDir(t)
+	setting := testSetting("docs", t.TempDir())
+	h := testHandler(t, setting)
+	h.stopCh, h.exitCh, h.drainTimeout = make(chan struct{}), make(chan struct{}), atomic.NewDuration(0)
+	s := NewSyncer()
+	h.scheduler = s.scheduler
+	s.handlers[setting.Key()] = h
+	if err := s.Start(context.Background(), &config.Config{Settings: []config.Setting{*setting}}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// the handler doesn't exit until exitCh closes, like one draining a transfer
+	done := make(chan *ReloadResult, 1)
+	go func() {
+		ret, _ := s.Reload(&config.Config{DrainTimeout: 60})
+		done <- ret
+	}()
+	<-h.stopCh
+	if err := s.Alive(100*time.Millisecond, time.Minute); err != nil {
+		t.Fatalf("expected the loop to answer while the reload drains, got %v", err)
+	}
+	// file events keep reaching the queue of the draining handler
+	h.Receive(&watcher.Event{Op: fsnotify.Write, File: local.NewStaticFileInfo(filepath.Join(setting.Local, "a.txt"), 1, 0o644, time.Now())})
+	close(h.exitCh)
+	ret := <-done
+	if len(ret.Removed) != 1 || ret.Removed[0] != setting.DisplayName() {
+		t.Fatalf("expected %s removed, got %+v", setting.DisplayName(), ret)
+	}
+	if n := h.queue.Len(); n != 1 {
+		t.Fatalf("expected the event received while draining queued, got %d", n)
+	}
+}
+
+// testStateDir points StateDir at a temporary dir for the test.
+func testStateDir(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+	t.Cleanup(xdg.Reload)
+}
+
+// testHandler is a handler without a remote, enough to queue, retry and handle events which need no transfer.
+func testHandler(t *testing.T, cfg *config.Setting) *Handler {
+	t.Helper()
+	return &Handler{
+		cfg:         atomic.NewPointer(cfg),
+		scheduler:   scheduler.New(1),
+		queue:       watcher.NewQueue(watcher.DefaultQueueSize, ""),
+		closed:      atomic.NewBool(false),
+		syncing:     atomic.NewBool(false),
+		running:     atomic.NewInt32(0),
+		progressed:  atomic.NewTime(time.Time{}),
+		paused:      atomic.NewBool(false),
+		lastSync:    atomic.NewTime(time.Time{}),
+		lastTick:    atomic.NewTime(time.Now()),
+		transfers:   pkg.NewMap[string, Transfer](),
+		errors:      atomic.NewUint64(0),
+		lastError:   atomic.NewString(""),
+		watchError:  atomic.NewString(""),
+		deadLetters: atomic.NewInt64(0),
+	}
+}
+
+func testSetting(name, local string) *config.Setting {
+	return &config.Setting{Name: name, Local: local, Credential: config.Credential{Bucket: name, Prefix: name}}
+}
+
+func TestDispatchSameFolder(t *testing.T) {
+	testStateDir(t)
+	dir := t.TempDir()
+	a := testHandler(t, testSetting("a", dir))
+	b := testHandler(t, testSetting("b", dir))
+	fw := &FolderWatcher{handlers: atomic.NewPointer(&[]*Handler{a, b})}
+	path := filepath.Join(dir, "a.txt")
+	fw.dispatch(watcher.Event{Op: fsnotify.Write, File: local.NewStaticFileInfo(path, 1, 0o644, time.Now())})
+	evA, evB := a.queue.Drain(), b.queue.Drain()
+	if len(evA) != 1 || len(evB) != 1 || evA[0] == evB[0] {
+		t.Fatalf("expected each handler to get its own event, got %v %v", evA, evB)
+	}
+	if evA[0].SettingKey != a.ConfigKey() || evB[0].SettingKey != b.ConfigKey() {
+		t.Fatalf("unexpected setting keys %s, %s", evA[0].SettingKey, evB[0].SettingKey)
+	}
+	// failures of one setting don't count toward the attempts of the other
+	ev := evA[0]
+	for range MaxAttempts - 1 {
+		a.retry(ev, errors.New("denied"))
+		ev = a.queue.Drain()[0]
+	}
+	if ev.Attempts != MaxAttempts-1 {
+		t.Fatalf("expected %d attempts for a, got %d", MaxAttempts-1, ev.Attempts)
+	}
+	b.retry(evB[0], errors.New("denied"))
+	if got := b.queue.Drain(); len(got) != 1 || got[0].Attempts != 1 {
+		t.Fatalf("expected 1 attempt for b, got %v", got)
+	}
+	for _, h := range []*Handler{a, b} {
+		if items, _ := ReadDeadLetters(h.setting()); len(items) != 0 {
+			t.Fatalf("%s: unexpected dead letters %v", h.setting().Name, items)
+		}
+	}
+}
+
+func TestDeadLettersResolved(t *testing.T) {
+	testStateDir(t)
+	dir := t.TempDir()
+	h := testHandler(t, testSetting("docs", dir))
+	gone := filepath.Join(dir, "gone.txt")
+	kept := filepath.Join(dir, "kept.txt")
+	for _, path := range []string{gone, kept} {
+		ev := &watcher.Event{Op: fsnotify.Create, File: local.NewStaticFileInfo(path, 1, 0o644, time.Now()), Attempts: MaxAttempts - 1}
+		h.retry(ev, errors.New("denied"))
+	}
+	if items, err := ReadDeadLetters(h.setting()); err != nil || len(items) != 2 {
+		t.Fatalf("expected 2 dead letters, got %v %v", items, err)
+	}
+	if count := h.Status().DeadLetters; count != 2 {
+		t.Fatalf("expected a status of 2 dead letters, got %d", count)
+	}
+	// gone.txt doesn't exist, handling it succeeds without a transfer
+	if err := h.handle(context.Background(), &watcher.Event{Op: fsnotify.Create, File: local.NewStaticFileInfo(gone, 1, 0o644, time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+	items, err := ReadDeadLetters(h.setting())
+	if err != nil || len(items) != 1 || items[0].Path != kept {
+		t.Fatalf("expected only %s left, got %v %v", kept, items, err)
+	}
+	if count := h.Status().DeadLetters; count != 1 {
+		t.Fatalf("expected a status of 1 dead letter, got %d", count)
+	}
+	if count, err := removeDeadLetters(h.setting(), func(DeadLetter) bool { return true }); err != nil || count != 0 {
+		t.Fatalf("expected no items left, got %d %v", count, err)
+	}
+	if _, err := os.Stat(DeadLetterPath(h.setting())); !os.IsNotExist(err) {
+		t.Fatalf("expected the empty dead-letter file to be removed, got %v", err)
+	}
+}
+
+func TestDrainOverride(t *testing.T) {
+	s := NewSyncer()
+	if err := s.SetDrainTimeout(500 * time.Millisecond); err == nil {
+		t.Fatal("expected a sub-second drain timeout to be rejected")
+	}
+	s.apply(&config.Config{DrainTimeout: 5})
+	if s.drain != 5*time.Second {
+		t.Fatalf("expected the drain of the config, got %s", s.drain)
+	}
+	if err := s.SetDrainTimeout(1500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// a reloaded config doesn't reset the override
+	s.apply(&config.Config{DrainTimeout: 5})
+	if s.drain != 1500*time.Millisecond {
+		t.Fatalf("expected the override to survive a reload, got %s", s.drain)
+	}
+}
+
+// testDeleteServer answers DeleteObjects like a bucket which refuses to delete keys containing "locked".
+func testDeleteServer(t *testing.T) *ossSDK.Client {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Objects []struct {
+				Key string `xml:"Key"`
+			} `xml:"Object"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var buf strings.Builder
+		buf.WriteString("<DeleteResult>")
+		for _, obj := range req.Objects {
+			if !strings.Contains(obj.Key, "locked") {
+				fmt.Fprintf(&buf, "<Deleted><Key>%s</Key></Deleted>", obj.Key)
+			}
+		}
+		buf.WriteString("</DeleteResult>")
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, buf.String())
+	}))
+	t.Cleanup(ts.Close)
+	clt, err := ossSDK.New(ts.URL, "id", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clt
+}
+
+func TestRemoveNotDeletedRetried(t *testing.T) {
+	testStateDir(t)
+	dir := t.TempDir()
+	setting := testSetting("docs", dir)
+	h := testHandler(t, setting)
+	bucket, err := oss.NewBucketClient(testDeleteServer(t), setting.Bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.fs = oss.NewFS(bucket, oss.WithPrefix(setting.Prefix), oss.WithLocal(dir), oss.WithStateDir(t.TempDir()))
+	defer h.fs.Close()
+	h.enableDelete = true
+	removed := filepath.Join(dir, "a.txt")
+	locked := filepath.Join(dir, "locked.txt")
+	evs := []*watcher.Event{
+		{Op: fsnotify.Remove, File: local.NewStaticFileInfo(removed, 1, 0o644, time.Now())},
+		{Op: fsnotify.Remove, File: local.NewStaticFileInfo(locked, 1, 0o644, time.Now())},
+	}
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		if err := h.handle(context.Background(), evs...); err == nil || !strings.Contains(err.Error(), "not deleted") {
+			t.Fatalf("expected the partial delete to fail, got %v", err)
+		}
+		evs = h.queue.Drain()
+		if attempt == MaxAttempts {
+			break
+		}
+		if len(evs) != 1 || evs[0].File.Path() != locked || evs[0].Attempts != attempt {
+			t.Fatalf("expected only %s queued for retry after attempt %d, got %v", locked, attempt, evs)
+		}
+	}
+	if len(evs) != 0 {
+		t.Fatalf("expected nothing queued once the delete failed %d times, got %v", MaxAttempts, evs)
+	}
+	items, err := ReadDeadLetters(setting)
+	if err != nil || len(items) != 1 || items[0].Path != locked || items[0].Op != fsnotify.Remove.String() {
+		t.Fatalf("expected %s dead-lettered, got %v %v", locked, items, err)
+	}
+}
+
+func TestRenamedThenRemoved(t *testing.T) {
+	testStateDir(t)
+	dir := t.TempDir()
+	setting := testSetting("docs", dir)
+	h := testHandler(t, setting)
+	bucket, err := oss.NewBucketClient(testDeleteServer(t), setting.Bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.fs = oss.NewFS(bucket, oss.WithPrefix(setting.Prefix), oss.WithLocal(dir), oss.WithStateDir(t.TempDir()))
+	defer h.fs.Close()
+	h.enableDelete = true
+	removed := func(ori string) *watcher.Event {
+		return &watcher.Event{
+			Op:   fsnotify.Rename | fsnotify.Remove,
+			File: local.NewStaticFileInfo(filepath.Join(dir, "b.txt"), 1, 0o644, time.Now()),
+			Ori:  local.NewStaticFileInfo(filepath.Join(dir, ori), 1, 0o644, time.Now()),
+		}
+	}
+	if err := h.handle(context.Background(), removed("a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if evs := h.queue.Drain(); len(evs) != 0 {
+		t.Fatalf("expected nothing to retry, got %v", evs)
+	}
+	// the rename source is deleted along with the target
+	if err := h.handle(context.Background(), removed("locked.txt")); err == nil {
+		t.Fatal("expected the rename source which wasn't deleted to fail")
+	}
+	if evs := h.queue.Drain(); len(evs) != 1 || evs[0].Ori.Path() != filepath.Join(dir, "locked.txt") {
+		t.Fatalf("expected the event to be retried, got %v", evs)
+	}
+}
+
+func TestDirRenames(t *testing.T) {
+	dir := t.TempDir()
+	h := testHandler(t, testSetting("docs", dir))
+	if err := os.MkdirAll(filepath.Join(dir, "kept"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	renamed := func(ori, path string) *watcher.Event {
+		return &watcher.Event{
+			Op:   fsnotify.Rename,
+			File: local.NewStaticFileInfo(filepath.Join(dir, path), 1, 0o644, time.Now()),
+			Ori:  local.NewStaticFileInfo(filepath.Join(dir, ori), 1, 0o644, time.Now()),
+		}
+	}
+	evs := []*watcher.Event{
+		// photos was renamed to pictures
+		renamed("photos/a.jpg", "pictures/a.jpg"),
+		renamed("photos/2024/b.jpg", "pictures/2024/b.jpg"),
+		// a file moved out of a directory which is still there
+		renamed("kept/c.txt", "other/c.txt"),
+		// a file renamed in place
+		renamed("d.txt", "e.txt"),
+	}
+	dirs, rest := h.dirRenames(evs)
+	if len(dirs) != 1 || dirs[0].src != filepath.Join(dir, "photos") || dirs[0].dist != filepath.Join(dir, "pictures") || len(dirs[0].evs) != 2 {
+		t.Fatalf("expected photos renamed to pictures, got %+v", dirs)
+	}
+	if len(rest) != 2 {
+		t.Fatalf("expected the other renames to be kept, got %v", rest)
+	}
+}
+
+// testOSS is a bucket accepting uploads, puts are held while block is open.
+type testOSS struct {
+	mu      gosync.Mutex
+	puts    []string
+	started chan string
+	block   chan struct{}
+}
+
+func (o *testOSS) uploaded() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return slices.Clone(o.puts)
+}
+
+// testRemote serves a bucket to the settings of the test, it returns the setting of dir using it.
+func testRemote(t *testing.T, name, dir string) (*config.Setting, *testOSS) {
+	t.Helper()
+	o := &testOSS{started: make(chan string, 100)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.Method {
+		case http.MethodPut:
+			io.Copy(io.Discard, r.Body)
+			o.started <- r.URL.Path
+			if o.block != nil {
+				<-o.block
+			}
+			o.mu.Lock()
+			o.puts = append(o.puts, r.URL.Path)
+			o.mu.Unlock()
+			w.Header().Set("ETag", `"etag"`)
+		case http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case http.MethodPost:
+			io.WriteString(w, "<DeleteResult></DeleteResult>")
+		default:
+			if _, ok := r.URL.Query()["uploads"]; ok {
+				io.WriteString(w, "<ListMultipartUploadsResult></ListMultipartUploadsResult>")
+				return
+			}
+			io.WriteString(w, "<ListBucketResult></ListBucketResult>")
+		}
+	}))
+	t.Cleanup(func() {
+		ts.CloseClientConnections()
+		ts.Close()
+		pruneClients(nil)
+	})
+	setting := testSetting(name, dir)
+	setting.Access = config.Access{Endpoint: ts.URL, AccessKeyID: "id", AccessKeySecret: "secret"}
+	return setting, o
+}
+
+func TestShutdownPersistsEventsReceivedWhileDraining(t *testing.T) {
+	testStateDir(t)
+	dir := t.TempDir()
+	setting, remote := testRemote(t, "docs", dir)
+	remote.block = make(chan struct{})
+	h, err := NewHandler(setting, scheduler.New(1), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte(path), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Receive(testEvent(t, fsnotify.Create, a))
+	<-remote.started
+	done := make(chan struct{})
+	go func() {
+		h.Shutdown(time.Minute)
+		close(done)
+	}()
+	for !h.closed.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	// b changes while a is still uploading
+	h.Receive(testEvent(t, fsnotify.Write, b))
+	close(remote.block)
+	<-done
+	if got := remote.uploaded(); len(got) != 1 || !strings.HasSuffix(got[0], "a.txt") {
+		t.Fatalf("expected only a.txt uploaded while draining, got %v", got)
+	}
+	// the persisted events are read back by the first drain
+	q := watcher.NewQueue(watcher.DefaultQueueSize, QueuePath(setting))
+	q.Drain()
+	if evs := q.Drain(); len(evs) != 1 || evs[0].File.Path() != b {
+		t.Fatalf("expected the event of b.txt persisted, got %v", evs)
+	}
+}
+
+func testEvent(t *testing.T, op fsnotify.Op, path string) *watcher.Event {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &watcher.Event{Op: op, File: local.NewFileInfo(fi, local.WithPath(path))}
+}
+
+func TestReloadKeepsEventsOfRestartedSettings(t *testing.T) {
+	testStateDir(t)
+	dir := t.TempDir()
+	setting, remote := testRemote(t, "docs", dir)
+	s := NewSyncer()
+	if err := s.apply(&config.Config{Settings: []config.Setting{*setting}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.stop()
+	old := s.handlers[setting.Key()]
+	changed := *setting
+	changed.Delete = true
+	stage := s.prepare(reloadRequest{cfg: &config.Config{Settings: []config.Setting{changed}}})
+	// a.txt is written while the old handler drains, b.txt once it persisted its queue
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	shutdown(stage.stopped, s.drain)
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		old.handoffMu.Lock()
+		late := len(old.late)
+		old.handoffMu.Unlock()
+		if late > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("b.txt not received by the stopped handler")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ret := s.finish(stage); len(ret.Restarted) != 1 {
+		t.Fatalf("expected %s restarted, got %+v", setting.DisplayName(), ret)
+	}
+	want := []string{"/docs/docs/a.txt", "/docs/docs/b.txt"}
+	deadline = time.Now().Add(10 * time.Second)
+	for {
+		got := remote.uploaded()
+		slices.Sort(got)
+		if slices.Equal(slices.Compact(got), want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v uploaded, got %v", want, got)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,325 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	gosync "sync"
+
+	"github.com/alitto/pond/v2"
+	ossSDK "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"golang.org/x/time/rate"
+
+	"github.com/bububa/osssync/internal/config"
+	"github.com/bububa/osssync/pkg/fs/local"
+	"github.com/bububa/osssync/pkg/fs/oss"
+)
+
+type VerifyAlgorithm string
+
+const (
+	VerifyCRC64 VerifyAlgorithm = "crc64"
+	VerifyMD5   VerifyAlgorithm = "md5"
+)
+
+type VerifyStatus string
+
+const (
+	VerifyOK VerifyStatus = "ok"
+	// VerifyMismatch is a remote object whose hash or size differs from the local file
+	VerifyMismatch VerifyStatus = "mismatch"
+	VerifyMissing  VerifyStatus = "missing"
+	// VerifyUnverifiable is a remote object without metadata for the algorithm, e.g. the md5 of a multipart upload
+	VerifyUnverifiable VerifyStatus = "unverifiable"
+	VerifyRepaired     VerifyStatus = "repaired"
+	VerifyFailed       VerifyStatus = "failed"
+)
+
+// VerifyResult is the outcome of verifying one local file, Path is relative to the setting folder.
+type VerifyResult struct {
+	Path   string       `json:"path"`
+	Status VerifyStatus `json:"status"`
+	Local  string       `json:"local,omitempty"`
+	Remote string       `json:"remote,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	// Resumed is set for results recorded by an interrupted run
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// Failed reports whether the remote object still doesn't match the local file.
+func (r VerifyResult) Failed() bool {
+	switch r.Status {
+	case VerifyMismatch, VerifyMissing, VerifyFailed:
+		return true
+	}
+	return false
+}
+
+type VerifyOptions struct {
+	Algorithm VerifyAlgorithm
+	// Repair uploads missing and mismatching files again
+	Repair bool
+	// Rate limits the number of files verified per second, 0 is unlimited
+	Rate float64
+	// Bandwidth limits the bytes hashed per second, 0 is unlimited
+	Bandwidth int64
+	Routines  int
+	// Restart ignores the journal of an interrupted run
+	Restart bool
+}
+
+// VerifyJournalPath is the JSONL file results are appended to, so an interrupted verify continues where it stopped.
+func VerifyJournalPath(cfg *config.Setting, algo VerifyAlgorithm) string {
+	return filepath.Join(StateDir(), "verify", cfg.Mountpoint()+"-"+string(algo)+".jsonl")
+}
+
+// Verify hashes every local file of cfg and compares it with the metadata of the remote object, fn is called
+// for every result including the ones recorded by an interrupted run, never concurrently. The journal is removed once every file was verified.
+func Verify(ctx context.Context, cfg *config.Setting, fs *oss.FS, opts VerifyOptions, fn func(VerifyResult)) error {
+	if opts.Algorithm == "" {
+		opts.Algorithm = VerifyCRC64
+	}
+	if opts.Algorithm != VerifyCRC64 && opts.Algorithm != VerifyMD5 {
+		return fmt.Errorf("unknown verify algorithm %s", opts.Algorithm)
+	}
+	if opts.Routines <= 0 {
+		opts.Routines = HashRoutines
+	}
+	journalPath := VerifyJournalPath(cfg, opts.Algorithm)
+	if opts.Restart {
+		if err := os.Remove(journalPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	done, err := readVerifyJournal(journalPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(journalPath), 0o700); err != nil {
+		return err
+	}
+	journal, err := os.OpenFile(journalPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	v := &verifier{
+		cfg:     cfg,
+		fs:      fs,
+		opts:    opts,
+		journal: journal,
+		fn:      fn,
+	}
+	if opts.Rate > 0 {
+		v.limiter = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+	if opts.Bandwidth > 0 {
+		v.bandwidth = rate.NewLimiter(rate.Limit(opts.Bandwidth), int(min(opts.Bandwidth, bandwidthBurst)))
+	}
+	pool := pond.NewPool(opts.Routines, pond.WithContext(ctx))
+	defer pool.StopAndWait()
+	group := pool.NewGroup()
+	err = filepath.Walk(cfg.Local, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != cfg.Local && ignoredLocal(cfg, path) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.Local, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if res, ok := done[rel]; ok {
+			res.Resumed = true
+			v.mu.Lock()
+			fn(res)
+			v.mu.Unlock()
+			return nil
+		}
+		group.Submit(func() {
+			v.verify(ctx, path, rel, fi)
+		})
+		return ctx.Err()
+	})
+	if waitErr := group.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return err
+	}
+	journal.Close()
+	return os.Remove(journalPath)
+}
+
+// bandwidthBurst is the largest chunk read at once when the bandwidth is limited.
+const bandwidthBurst = 1 << 20
+
+type verifier struct {
+	cfg       *config.Setting
+	fs        *oss.FS
+	opts      VerifyOptions
+	limiter   *rate.Limiter
+	bandwidth *rate.Limiter
+	mu        gosync.Mutex
+	journal   *os.File
+	fn        func(VerifyResult)
+}
+
+func (v *verifier) verify(ctx context.Context, path string, rel string, fi os.FileInfo) {
+	if v.limiter != nil {
+		if err := v.limiter.Wait(ctx); err != nil {
+			return
+		}
+	}
+	res := v.compare(ctx, path, rel, fi)
+	if res.Failed() && res.Status != VerifyFailed && v.opts.Repair {
+		if err := v.fs.UploadFileTo(ctx, local.NewFileInfo(fi, local.WithPath(path)), rel); err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Status = VerifyRepaired
+		}
+	}
+	if ctx.Err() != nil {
+		// interrupted, verified again on resume
+		return
+	}
+	v.record(res)
+}
+
+func (v *verifier) compare(ctx context.Context, path string, rel string, fi os.FileInfo) VerifyResult {
+	res := VerifyResult{Path: rel}
+	header, err := v.fs.Meta(ctx, rel)
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			res.Status = VerifyMissing
+		} else {
+			res.Status = VerifyFailed
+			res.Error = err.Error()
+		}
+		return res
+	}
+	if size := header.Get("Content-Length"); size != strconv.FormatInt(fi.Size(), 10) {
+		res.Status = VerifyMismatch
+		res.Error = fmt.Sprintf("size mismatch, local:%d, remote:%s", fi.Size(), size)
+		return res
+	}
+	res.Remote = remoteHash(header, v.opts.Algorithm)
+	if res.Remote == "" {
+		res.Status = VerifyUnverifiable
+		return res
+	}
+	if res.Local, err = v.hash(ctx, path); err != nil {
+		res.Status = VerifyFailed
+		res.Error = err.Error()
+		return res
+	}
+	if res.Local != res.Remote {
+		res.Status = VerifyMismatch
+		return res
+	}
+	res.Status = VerifyOK
+	return res
+}
+
+func (v *verifier) hash(ctx context.Context, path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	var r io.Reader = fd
+	if v.bandwidth != nil {
+		r = &limitedReader{ctx: ctx, r: fd, limiter: v.bandwidth}
+	}
+	if v.opts.Algorithm == VerifyMD5 {
+		return local.MD5Reader(r)
+	}
+	return local.CRC64Reader(r)
+}
+
+func (v *verifier) record(res VerifyResult) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if bs, err := json.Marshal(res); err == nil {
+		v.journal.Write(append(bs, '\n'))
+	}
+	v.fn(res)
+}
+
+// remoteHash returns the checksum of the object for algo in the format returned by the local hash helpers.
+func remoteHash(header http.Header, algo VerifyAlgorithm) string {
+	get := header.Get
+	if algo == VerifyCRC64 {
+		return get(ossSDK.HTTPHeaderOssCRC64)
+	}
+	if contentMD5 := get(ossSDK.HTTPHeaderContentMD5); contentMD5 != "" {
+		if bs, err := base64.StdEncoding.DecodeString(contentMD5); err == nil {
+			return hex.EncodeToString(bs)
+		}
+	}
+	// the etag of a multipart or appendable object isn't the md5 of its content
+	etag := strings.ToLower(strings.Trim(get(ossSDK.HTTPHeaderEtag), `"`))
+	if len(etag) == 32 && !strings.Contains(etag, "-") {
+		return etag
+	}
+	return ""
+}
+
+func readVerifyJournal(name string) (map[string]VerifyResult, error) {
+	ret := make(map[string]VerifyResult)
+	fd, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		var res VerifyResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			continue
+		}
+		ret[res.Path] = res
+	}
+	return ret, scanner.Err()
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if burst := l.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if waitErr := l.limiter.WaitN(l.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
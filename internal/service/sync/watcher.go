@@ -1,39 +1,76 @@
 package sync
 
 import (
+	"os"
+
 	"github.com/fsnotify/fsnotify"
+	"go.uber.org/atomic"
 
 	"github.com/bububa/osssync/internal/config"
 	"github.com/bububa/osssync/internal/service/log"
+	"github.com/bububa/osssync/pkg/fs/oss"
 	"github.com/bububa/osssync/pkg/watcher"
 )
 
-func Watch(cfg *config.Setting, handlers []*Handler) (*watcher.Watcher, error) {
+// ignoreTempFiles skips partial downloads so they are never uploaded back.
+func ignoreTempFiles(info os.FileInfo, fullPath string) error {
+	if oss.IsTempFile(fullPath) {
+		return watcher.ErrSkip
+	}
+	return nil
+}
+
+// FolderWatcher watches a local folder for every setting syncing it, the settings can change without restarting it.
+type FolderWatcher struct {
+	*watcher.Watcher
+	handlers *atomic.Pointer[[]*Handler]
+	// ignoreHiddenFiles is the filter the watcher was started with, changing it needs a new watcher
+	ignoreHiddenFiles bool
+}
+
+// SetHandlers replaces the handlers the watcher dispatches file changes to.
+func (fw *FolderWatcher) SetHandlers(handlers []*Handler) {
+	fw.handlers.Store(&handlers)
+}
+
+// dispatch gives every handler of the folder its own copy of event, their retries count attempts separately.
+func (fw *FolderWatcher) dispatch(event watcher.Event) {
+	for _, h := range *fw.handlers.Load() {
+		if event.HandlerKey != "" && event.HandlerKey != h.Key() {
+			continue
+		}
+		ev := event
+		ev.SettingKey = h.setting().Key()
+		h.Receive(&ev)
+	}
+}
+
+func Watch(cfg *config.Setting, handlers []*Handler) (*FolderWatcher, error) {
 	op := fsnotify.Create | fsnotify.Write | fsnotify.Rename | fsnotify.Remove
-	w, err := watcher.NewWatcher(watcher.WithIgnoreHiddenFiles(cfg.IgnoreHiddenFiles), watcher.WithOpFilter(op))
+	w, err := watcher.NewWatcher(watcher.WithIgnoreHiddenFiles(cfg.IgnoreHiddenFiles), watcher.WithOpFilter(op), watcher.WithFilterHook(ignoreTempFiles))
 	if err != nil {
 		return nil, err
 	}
+	fw := &FolderWatcher{
+		Watcher:           w,
+		handlers:          atomic.NewPointer(&handlers),
+		ignoreHiddenFiles: cfg.IgnoreHiddenFiles,
+	}
 	logger := log.Logger()
 	closed := false
-	key := cfg.Key()
 	go func() {
 		for {
 			select {
 			case event := <-w.Events:
-				for _, h := range handlers {
-					if closed {
-						break
-					}
-					if event.HandlerKey != "" && event.HandlerKey != h.Key() {
-						continue
-					}
-					event.SettingKey = key
-					h.Receive(&event)
+				if !closed {
+					fw.dispatch(event)
 				}
 			case err := <-w.Errors:
 				if err != nil {
 					logger.Error().Err(err).Msg("watch")
+					for _, h := range *fw.handlers.Load() {
+						h.watchFailed(err)
+					}
 				}
 			case <-w.Closed:
 				closed = true
@@ -44,5 +81,5 @@ func Watch(cfg *config.Setting, handlers []*Handler) (*watcher.Watcher, error) {
 	if err := w.Start(cfg.Local); err != nil {
 		return nil, err
 	}
-	return w, nil
+	return fw, nil
 }
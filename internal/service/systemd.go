@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bububa/osssync/internal/service/log"
+	"github.com/bububa/osssync/internal/service/sync"
+	"github.com/bububa/osssync/pkg/systemd"
+)
+
+// ControlSocketName is the FileDescriptorName of the control socket in the systemd socket unit.
+const ControlSocketName = "control"
+
+// notifySystemd reports readiness to systemd, then keeps its status line up to date until ctx is done.
+// The watchdog is only fed while the syncer passes its liveness check.
+func notifySystemd(ctx context.Context) {
+	logger := log.Logger()
+	if ok, err := systemd.Notify(systemd.Ready, systemd.Status(statusText())); err != nil {
+		logger.Error().Err(err).Msg("sd_notify")
+		return
+	} else if !ok {
+		return
+	}
+	interval := sync.StatusInterval
+	watchdog := systemd.WatchdogInterval()
+	if watchdog > 0 && watchdog/2 < interval {
+		interval = watchdog / 2
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				var states []string
+				if watchdog > 0 {
+					// only feed the watchdog while the sync loop and the handlers keep running, systemd restarts a stuck daemon
+					if err := Syncer().Alive(interval, watchdog); err != nil {
+						logger.Error().Err(err).Msg("watchdog")
+						continue
+					}
+					states = append(states, systemd.Watchdog)
+				}
+				states = append(states, systemd.Status(statusText()))
+				if _, err := systemd.Notify(states...); err != nil {
+					logger.Error().Err(err).Msg("sd_notify")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func notifyStopping() {
+	systemd.Notify(systemd.Stopping, systemd.Status("stopping"))
+}
+
+// statusText summarizes the daemon in one line, like "3 settings, 12 queued, 2 transferring".
+func statusText() string {
+	var queued, transfers, paused int
+	statuses := Syncer().Status()
+	for _, s := range statuses {
+		queued += s.Queued
+		transfers += len(s.Transfers)
+		if s.Paused {
+			paused++
+		}
+	}
+	ret := fmt.Sprintf("%d settings, %d queued, %d transferring", len(statuses), queued, transfers)
+	if paused > 0 {
+		ret += fmt.Sprintf(", %d paused", paused)
+	}
+	return ret
+}
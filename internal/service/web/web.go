@@ -0,0 +1,273 @@
+// Package web serves the REST API and dashboard of the daemon over HTTP, on top of the same control.Daemon as the control socket.
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/bububa/osssync/internal/service/control"
+	"github.com/bububa/osssync/internal/service/log"
+	"github.com/bububa/osssync/internal/service/sync"
+)
+
+const (
+	// HistorySize is the number of sync, error and conflict events kept for /api/history.
+	HistorySize = 200
+	// heartbeatInterval keeps idle event streams from being cut by proxies.
+	heartbeatInterval = 15 * time.Second
+)
+
+//go:embed static
+var static embed.FS
+
+type Server struct {
+	srv     *http.Server
+	ln      net.Listener
+	daemon  control.Daemon
+	token   string
+	history []sync.Event
+	mu      gosync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      gosync.WaitGroup
+}
+
+// TokenPath is where the generated token is kept when the config doesn't set one.
+func TokenPath() string {
+	return filepath.Join(sync.StateDir(), "http.token")
+}
+
+// Token returns token, or the generated one if it is empty, creating it on first use.
+func Token(token string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	path := TokenPath()
+	if bs, err := os.ReadFile(path); err == nil && len(bs) > 0 {
+		return strings.TrimSpace(string(bs)), nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	return token, os.WriteFile(path, []byte(token+"\n"), 0o600)
+}
+
+// Listen binds addr, every API request must carry token as a bearer token or a token query parameter.
+func Listen(addr string, token string, daemon control.Daemon) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		ln:     ln,
+		daemon: daemon,
+		token:  token,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	s.srv = &http.Server{
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// Addr is the address the server listens on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Serve handles requests until Close.
+func (s *Server) Serve() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.recordHistory()
+	}()
+	if err := s.srv.Serve(s.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Logger().Error().Err(err).Msg("http serve")
+	}
+}
+
+// Close ends event streams and shuts the server down.
+func (s *Server) Close() error {
+	s.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.srv.Shutdown(ctx)
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	root, _ := fs.Sub(static, "static")
+	mux.Handle("GET /", http.FileServer(http.FS(root)))
+	mux.Handle("GET /api/settings", s.auth(s.settings))
+	mux.Handle("GET /api/status", s.auth(s.status))
+	mux.Handle("GET /api/transfers", s.auth(s.transfers))
+	mux.Handle("GET /api/history", s.auth(s.historyEvents))
+	mux.Handle("GET /api/events", s.auth(s.events))
+	mux.Handle("POST /api/sync", s.auth(s.action(s.daemon.Sync)))
+	mux.Handle("POST /api/pause", s.auth(s.action(s.daemon.Pause)))
+	mux.Handle("POST /api/resume", s.auth(s.action(s.daemon.Resume)))
+	mux.Handle("POST /api/reload", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		ret, err := s.daemon.Reload()
+		writeJSON(w, ret, err)
+	}))
+	return mux
+}
+
+// auth rejects requests without the token, event streams can only pass it as a query parameter.
+func (s *Server) auth(fn http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = v
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fn(w, r)
+	})
+}
+
+func (s *Server) settings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.daemon.Settings(), nil)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.daemon.Status(), nil)
+}
+
+func (s *Server) transfers(w http.ResponseWriter, r *http.Request) {
+	ret := []control.Transfer{}
+	for _, status := range s.daemon.Status() {
+		for _, t := range status.Transfers {
+			ret = append(ret, control.Transfer{Setting: status.Name, Transfer: t})
+		}
+	}
+	writeJSON(w, ret, nil)
+}
+
+func (s *Server) historyEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ret := make([]sync.Event, len(s.history))
+	copy(ret, s.history)
+	s.mu.Unlock()
+	writeJSON(w, ret, nil)
+}
+
+// action runs fn with the settings named by the setting query parameters, none means all.
+func (s *Server) action(fn func([]string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, nil, fn(r.URL.Query()["setting"]))
+	}
+}
+
+// events streams every event of the daemon as Server-Sent Events.
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sub := s.daemon.Subscribe()
+	defer s.daemon.Unsubscribe(sub)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			bs, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, bs); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// recordHistory keeps the last HistorySize events, progress events are too many to be worth keeping.
+func (s *Server) recordHistory() {
+	sub := s.daemon.Subscribe()
+	defer s.daemon.Unsubscribe(sub)
+	for {
+		select {
+		case ev, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if ev.Type == sync.EventProgress || ev.Type == sync.EventWatch {
+				continue
+			}
+			s.mu.Lock()
+			if len(s.history) == HistorySize {
+				s.history = append(s.history[:0], s.history[1:]...)
+			}
+			s.history = append(s.history, ev)
+			s.mu.Unlock()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, result any, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	var resp control.Response
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		resp.Error = err.Error()
+	} else if result != nil {
+		bs, err := json.Marshal(result)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			resp.Error = err.Error()
+		} else {
+			resp.Result = bs
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bububa/osssync/internal/service/control"
+	"github.com/bububa/osssync/internal/service/control/controltest"
+	"github.com/bububa/osssync/internal/service/sync"
+)
+
+const testToken = "s3cret-token"
+
+func startServer(t *testing.T) (*controltest.Daemon, *Server) {
+	t.Helper()
+	d := controltest.NewDaemon()
+	s, err := Listen("127.0.0.1:0", testToken, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return d, s
+}
+
+func TestAuth(t *testing.T) {
+	_, s := startServer(t)
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   int
+	}{
+		{name: "no token", target: "/api/status", want: http.StatusUnauthorized},
+		{name: "wrong bearer", target: "/api/status", header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "wrong query", target: "/api/status?token=nope", want: http.StatusUnauthorized},
+		{name: "not bearer", target: "/api/status", header: "Basic " + testToken, want: http.StatusUnauthorized},
+		{name: "bearer", target: "/api/status", header: "Bearer " + testToken, want: http.StatusOK},
+		{name: "query", target: "/api/status?token=" + testToken, want: http.StatusOK},
+		{name: "bearer wins", target: "/api/status?token=" + testToken, header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "dashboard is public", target: "/", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Fatal("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAPI(t *testing.T) {
+	d, s := startServer(t)
+	tests := []struct {
+		method string
+		target string
+		status int
+		want   string
+	}{
+		{method: http.MethodGet, target: "/api/status", status: http.StatusOK, want: `"name":"docs"`},
+		{method: http.MethodGet, target: "/api/settings", status: http.StatusOK, want: `"Local":"/home/docs"`},
+		{method: http.MethodGet, target: "/api/transfers", status: http.StatusOK, want: `{"result":[{"setting":"docs","op":"upload","src":"a.txt"`},
+		{method: http.MethodGet, target: "/api/history", status: http.StatusOK, want: `{"result":[]}`},
+		{method: http.MethodPost, target: "/api/sync", status: http.StatusOK, want: `{}`},
+		{method: http.MethodPost, target: "/api/pause?setting=docs&setting=photos", status: http.StatusOK, want: `{}`},
+		{method: http.MethodPost, target: "/api/resume?setting=missing", status: http.StatusBadRequest, want: `{"error":"setting not found: missing"}`},
+		{method: http.MethodPost, target: "/api/reload", status: http.StatusOK, want: `{"result":{"added":["photos"],"unchanged":["docs"]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set("Authorization", "Bearer "+testToken)
+			w := httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+	want := "sync:|pause:docs,photos|resume:missing|reload:"
+	if got := strings.Join(d.Calls(), "|"); got != want {
+		t.Fatalf("daemon calls %s, want %s", got, want)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	d, s := startServer(t)
+	req, err := http.NewRequest(http.MethodGet, "http://"+s.Addr()+"/api/events?token="+testToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %s", ct)
+	}
+	// the history recorder and the stream
+	d.WaitSubscribers(t, 2)
+	sent := sync.Event{Type: sync.EventSyncComplete, Setting: "docs", Error: "denied"}
+	d.Events.Publish(sent)
+	r := bufio.NewReader(resp.Body)
+	var frame []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "\n" {
+			break
+		}
+		frame = append(frame, strings.TrimSuffix(line, "\n"))
+	}
+	if len(frame) != 2 || frame[0] != "event: sync_complete" || !strings.HasPrefix(frame[1], "data: ") {
+		t.Fatalf("unexpected frame %q", frame)
+	}
+	var got sync.Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(frame[1], "data: ")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != sent {
+		t.Fatalf("got %+v, want %+v", got, sent)
+	}
+
+	// the event made it into the history too, progress events don't
+	d.Events.Publish(sync.Event{Type: sync.EventProgress, Setting: "docs"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/history?token="+testToken, nil)
+		s.srv.Handler.ServeHTTP(w, r)
+		var resp struct {
+			Result []sync.Event `json:"result"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.Result) == 1 && resp.Result[0] == sent {
+			break
+		}
+		if len(resp.Result) > 1 || time.Now().After(deadline) {
+			t.Fatalf("unexpected history %+v", resp.Result)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var _ control.Daemon = (*controltest.Daemon)(nil)
@@ -0,0 +1,238 @@
+// Package credentials provides Alibaba Cloud credentials to OSS clients: static keys, environment variables,
+// Aliyun CLI profiles, STS AssumeRole and ECS RAM roles, tried in a chain and refreshed before they expire.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// ErrNoCredentials is returned by a provider which has nothing to offer, so a chain moves on to the next one.
+var ErrNoCredentials = errors.New("no credentials")
+
+// RefreshWindow is how long before expiry temporary credentials are renewed.
+const RefreshWindow = 5 * time.Minute
+
+// Credentials are an access key pair, with a security token and expiry if temporary.
+type Credentials struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SecurityToken   string
+	// Expiration is when the credentials must be renewed, zero for long-lived keys
+	Expiration time.Time
+}
+
+func (c *Credentials) GetAccessKeyID() string {
+	return c.AccessKeyID
+}
+
+func (c *Credentials) GetAccessKeySecret() string {
+	return c.AccessKeySecret
+}
+
+func (c *Credentials) GetSecurityToken() string {
+	return c.SecurityToken
+}
+
+// expiring reports whether the credentials must be renewed before use.
+func (c *Credentials) expiring(now time.Time) bool {
+	return !c.Expiration.IsZero() && now.Add(RefreshWindow).After(c.Expiration)
+}
+
+// Provider retrieves credentials, it is called again when temporary credentials are about to expire.
+type Provider interface {
+	Retrieve(ctx context.Context) (*Credentials, error)
+	// Name identifies the provider in errors
+	Name() string
+}
+
+type staticProvider struct {
+	creds Credentials
+}
+
+// Static provides fixed keys, with an optional security token.
+func Static(accessKeyID, accessKeySecret, securityToken string) Provider {
+	return &staticProvider{creds: Credentials{AccessKeyID: accessKeyID, AccessKeySecret: accessKeySecret, SecurityToken: securityToken}}
+}
+
+func (p *staticProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	if p.creds.AccessKeyID == "" || p.creds.AccessKeySecret == "" {
+		return nil, ErrNoCredentials
+	}
+	creds := p.creds
+	return &creds, nil
+}
+
+func (p *staticProvider) Name() string {
+	return "static"
+}
+
+type resolvedProvider struct {
+	resolve func() (accessKeyID, accessKeySecret string, err error)
+	ttl     time.Duration
+}
+
+// Resolved provides keys looked up by resolve, e.g. from a file or a command. They expire after ttl,
+// so a Cache looks them up again and picks up a rotated key.
+func Resolved(resolve func() (accessKeyID, accessKeySecret string, err error), ttl time.Duration) Provider {
+	return &resolvedProvider{resolve: resolve, ttl: ttl}
+}
+
+func (p *resolvedProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	id, secret, err := p.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if id == "" || secret == "" {
+		return nil, ErrNoCredentials
+	}
+	// the Cache renews RefreshWindow before expiry
+	return &Credentials{AccessKeyID: id, AccessKeySecret: secret, Expiration: time.Now().Add(RefreshWindow + p.ttl)}, nil
+}
+
+func (p *resolvedProvider) Name() string {
+	return "static"
+}
+
+// the variables read by Env, the ones of the Alibaba Cloud SDKs first, then the ones of the OSS SDK
+var envVars = [][3]string{
+	{"ALIBABA_CLOUD_ACCESS_KEY_ID", "ALIBABA_CLOUD_ACCESS_KEY_SECRET", "ALIBABA_CLOUD_SECURITY_TOKEN"},
+	{"OSS_ACCESS_KEY_ID", "OSS_ACCESS_KEY_SECRET", "OSS_SESSION_TOKEN"},
+}
+
+type envProvider struct{}
+
+// Env provides keys from ALIBABA_CLOUD_ACCESS_KEY_ID, ALIBABA_CLOUD_ACCESS_KEY_SECRET and
+// ALIBABA_CLOUD_SECURITY_TOKEN, or the OSS_ACCESS_KEY_ID, OSS_ACCESS_KEY_SECRET and OSS_SESSION_TOKEN of the OSS SDK.
+func Env() Provider {
+	return envProvider{}
+}
+
+func (envProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	for _, vars := range envVars {
+		id, secret := os.Getenv(vars[0]), os.Getenv(vars[1])
+		if id != "" && secret != "" {
+			return &Credentials{AccessKeyID: id, AccessKeySecret: secret, SecurityToken: os.Getenv(vars[2])}, nil
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+func (envProvider) Name() string {
+	return "env"
+}
+
+type chainProvider struct {
+	providers []Provider
+	mu        sync.Mutex
+	// last is the provider which succeeded last time, it is tried first
+	last Provider
+}
+
+// Chain tries the providers in order and uses the first which has credentials.
+func Chain(providers ...Provider) Provider {
+	return &chainProvider{providers: providers}
+}
+
+func (p *chainProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	p.mu.Lock()
+	last := p.last
+	p.mu.Unlock()
+	if last != nil {
+		if creds, err := last.Retrieve(ctx); err == nil {
+			return creds, nil
+		}
+	}
+	var errs []error
+	for _, provider := range p.providers {
+		creds, err := provider.Retrieve(ctx)
+		if err == nil {
+			p.mu.Lock()
+			p.last = provider
+			p.mu.Unlock()
+			return creds, nil
+		}
+		if !errors.Is(err, ErrNoCredentials) {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w from %s", ErrNoCredentials, p.Name())
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (p *chainProvider) Name() string {
+	names := make([]string, 0, len(p.providers))
+	for _, provider := range p.providers {
+		names = append(names, provider.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Cache keeps the credentials of a provider until they are about to expire. It implements the
+// credentials provider of the OSS SDK, which asks for credentials before signing each request.
+type Cache struct {
+	provider Provider
+	// timeout bounds retrieving credentials on behalf of the OSS SDK
+	timeout time.Duration
+	mu      sync.Mutex
+	creds   *Credentials
+}
+
+var _ oss.CredentialsProviderE = (*Cache)(nil)
+
+// NewCache caches the credentials of provider.
+func NewCache(provider Provider) *Cache {
+	return &Cache{provider: provider, timeout: 30 * time.Second}
+}
+
+// Retrieve returns the cached credentials, renewing them first if they are about to expire.
+func (c *Cache) Retrieve(ctx context.Context) (*Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.creds != nil && !c.creds.expiring(time.Now()) {
+		return c.creds, nil
+	}
+	creds, err := c.provider.Retrieve(ctx)
+	if err != nil {
+		if c.creds != nil && time.Now().Before(c.creds.Expiration) {
+			// renewing failed, the old credentials are still good for a little while
+			return c.creds, nil
+		}
+		return nil, err
+	}
+	c.creds = creds
+	return creds, nil
+}
+
+func (c *Cache) Name() string {
+	return c.provider.Name()
+}
+
+// GetCredentialsE is called by the OSS SDK for each request.
+func (c *Cache) GetCredentialsE() (oss.Credentials, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	creds, err := c.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// GetCredentials is GetCredentialsE for callers which can't handle errors, they get empty credentials.
+func (c *Cache) GetCredentials() oss.Credentials {
+	creds, err := c.GetCredentialsE()
+	if err != nil {
+		return &Credentials{}
+	}
+	return creds
+}
@@ -0,0 +1,163 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider returns creds or err and counts its calls.
+type fakeProvider struct {
+	name  string
+	creds *Credentials
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	creds := *p.creds
+	return &creds, nil
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func TestChain(t *testing.T) {
+	none := &fakeProvider{name: "none", err: ErrNoCredentials}
+	first := &fakeProvider{name: "first", creds: &Credentials{AccessKeyID: "first"}}
+	second := &fakeProvider{name: "second", creds: &Credentials{AccessKeyID: "second"}}
+	chain := Chain(none, first, second)
+	for range 2 {
+		creds, err := chain.Retrieve(context.Background())
+		if err != nil || creds.AccessKeyID != "first" {
+			t.Fatalf("expected the first provider with credentials, got %+v %v", creds, err)
+		}
+	}
+	if none.calls != 1 || first.calls != 2 || second.calls != 0 {
+		t.Fatalf("expected the chain to stick to the last provider, calls %d %d %d", none.calls, first.calls, second.calls)
+	}
+	// the sticky provider failing sends the chain through all providers again
+	first.err = errors.New("expired")
+	creds, err := chain.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "second" {
+		t.Fatalf("expected to fall back to the second provider, got %+v %v", creds, err)
+	}
+	if none.calls != 2 {
+		t.Fatalf("expected the chain to start over, none called %d times", none.calls)
+	}
+	if chain.Name() != "none, first, second" {
+		t.Fatalf("unexpected name %q", chain.Name())
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	_, err := Chain(&fakeProvider{name: "a", err: ErrNoCredentials}, &fakeProvider{name: "b", err: ErrNoCredentials}).Retrieve(context.Background())
+	if !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials, got %v", err)
+	}
+	_, err = Chain(&fakeProvider{name: "a", err: errors.New("denied")}, &fakeProvider{name: "b", err: ErrNoCredentials}).Retrieve(context.Background())
+	if err == nil || errors.Is(err, ErrNoCredentials) || !strings.Contains(err.Error(), "a: denied") {
+		t.Fatalf("expected the real error of a, got %v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	p := &fakeProvider{name: "fake", creds: &Credentials{AccessKeyID: "one", Expiration: time.Now().Add(time.Hour)}}
+	cache := NewCache(p)
+	for range 3 {
+		if _, err := cache.GetCredentialsE(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.calls != 1 {
+		t.Fatalf("expected valid credentials to be cached, %d calls", p.calls)
+	}
+
+	// inside the refresh window the credentials are renewed
+	p.creds = &Credentials{AccessKeyID: "two", Expiration: time.Now().Add(RefreshWindow / 2)}
+	cache = NewCache(p)
+	cache.Retrieve(context.Background())
+	p.creds = &Credentials{AccessKeyID: "three", Expiration: time.Now().Add(time.Hour)}
+	creds, err := cache.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "three" {
+		t.Fatalf("expected renewed credentials, got %+v %v", creds, err)
+	}
+
+	// failing to renew keeps credentials which haven't expired yet
+	p.creds = &Credentials{AccessKeyID: "four", Expiration: time.Now().Add(RefreshWindow / 2)}
+	cache = NewCache(p)
+	cache.Retrieve(context.Background())
+	p.err = errors.New("sts down")
+	creds, err = cache.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "four" {
+		t.Fatalf("expected the still valid credentials, got %+v %v", creds, err)
+	}
+
+	// but not expired ones
+	p.err = nil
+	p.creds = &Credentials{AccessKeyID: "five", Expiration: time.Now().Add(-time.Minute)}
+	cache = NewCache(p)
+	cache.Retrieve(context.Background())
+	p.err = errors.New("sts down")
+	if _, err := cache.Retrieve(context.Background()); err == nil {
+		t.Fatal("expected an error with expired credentials")
+	}
+	if creds := cache.GetCredentials(); creds.GetAccessKeyID() != "" {
+		t.Fatalf("expected empty credentials, got %s", creds.GetAccessKeyID())
+	}
+}
+
+func TestStaticAndEnv(t *testing.T) {
+	if _, err := Static("", "", "").Retrieve(context.Background()); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials without keys, got %v", err)
+	}
+	t.Setenv("ALIBABA_CLOUD_ACCESS_KEY_ID", "")
+	t.Setenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET", "")
+	t.Setenv("OSS_ACCESS_KEY_ID", "oss-id")
+	t.Setenv("OSS_ACCESS_KEY_SECRET", "oss-secret")
+	t.Setenv("OSS_SESSION_TOKEN", "oss-token")
+	creds, err := Env().Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "oss-id" || creds.SecurityToken != "oss-token" {
+		t.Fatalf("expected the OSS SDK variables, got %+v %v", creds, err)
+	}
+	t.Setenv("ALIBABA_CLOUD_ACCESS_KEY_ID", "ali-id")
+	t.Setenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET", "ali-secret")
+	creds, err = Env().Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "ali-id" || creds.SecurityToken != "" {
+		t.Fatalf("expected the Alibaba Cloud variables first, got %+v %v", creds, err)
+	}
+}
+
+func TestResolved(t *testing.T) {
+	secret, calls := "old", 0
+	resolve := func() (string, string, error) {
+		calls++
+		return "id", secret, nil
+	}
+	cache := NewCache(Resolved(resolve, time.Hour))
+	for range 2 {
+		if creds, err := cache.Retrieve(context.Background()); err != nil || creds.AccessKeySecret != "old" {
+			t.Fatalf("expected the resolved keys, got %+v %v", creds, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the keys to be cached, resolved %d times", calls)
+	}
+	// once they expire the keys are resolved again, a rotated secret is picked up
+	cache = NewCache(Resolved(resolve, 0))
+	cache.Retrieve(context.Background())
+	secret = "new"
+	if creds, err := cache.Retrieve(context.Background()); err != nil || creds.AccessKeySecret != "new" {
+		t.Fatalf("expected the rotated secret, got %+v %v", creds, err)
+	}
+	if _, err := Resolved(func() (string, string, error) { return "id", "", nil }, time.Hour).Retrieve(context.Background()); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials without a secret, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultMetadataEndpoint is the ECS instance metadata service.
+const DefaultMetadataEndpoint = "http://100.100.100.200"
+
+const (
+	metadataRolePath  = "/latest/meta-data/ram/security-credentials/"
+	metadataTokenPath = "/latest/api/token"
+	// metadataTokenTTL is how long the token of the hardened metadata mode is valid, in seconds
+	metadataTokenTTL = "21600"
+)
+
+type ecsRoleProvider struct {
+	roleName string
+	endpoint string
+	client   *http.Client
+}
+
+// ECSRole provides the temporary credentials of the RAM role attached to the ECS instance, roleName is
+// looked up from the metadata service if empty. Wrapped in a Cache they are renewed before they expire.
+func ECSRole(roleName, endpoint string) Provider {
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+	}
+	return &ecsRoleProvider{
+		roleName: roleName,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		// the metadata service answers at once on ECS, elsewhere there is no point waiting for it
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+func (p *ecsRoleProvider) Name() string {
+	return "ecs role"
+}
+
+type ecsCredentials struct {
+	Code            string    `json:"Code"`
+	AccessKeyID     string    `json:"AccessKeyId"`
+	AccessKeySecret string    `json:"AccessKeySecret"`
+	SecurityToken   string    `json:"SecurityToken"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (p *ecsRoleProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	// the hardened mode needs a token, the normal mode ignores it, so failing to get one is fine
+	token, _ := p.token(ctx)
+	roleName := p.roleName
+	if roleName == "" {
+		body, err := p.get(ctx, metadataRolePath, token)
+		if err != nil {
+			return nil, err
+		}
+		if roleName = strings.TrimSpace(strings.SplitN(string(body), "\n", 2)[0]); roleName == "" {
+			return nil, fmt.Errorf("%w: no RAM role attached to the instance", ErrNoCredentials)
+		}
+	}
+	body, err := p.get(ctx, metadataRolePath+roleName, token)
+	if err != nil {
+		return nil, err
+	}
+	var ret ecsCredentials
+	if err := json.Unmarshal(body, &ret); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	if ret.Code != "Success" {
+		return nil, fmt.Errorf("metadata: role %s: %s", roleName, ret.Code)
+	}
+	return &Credentials{
+		AccessKeyID:     ret.AccessKeyID,
+		AccessKeySecret: ret.AccessKeySecret,
+		SecurityToken:   ret.SecurityToken,
+		Expiration:      ret.Expiration,
+	}, nil
+}
+
+func (p *ecsRoleProvider) token(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.endpoint+metadataTokenPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aliyun-ecs-metadata-token-ttl-seconds", metadataTokenTTL)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata token: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return string(body), err
+}
+
+func (p *ecsRoleProvider) get(ctx context.Context, path, token string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-aliyun-ecs-metadata-token", token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// not on ECS, let a chain move on
+		return nil, fmt.Errorf("%w: metadata: %w", ErrNoCredentials, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: metadata %s not found", ErrNoCredentials, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata %s: %s", path, resp.Status)
+	}
+	return body, nil
+}
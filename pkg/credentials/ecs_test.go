@@ -0,0 +1,71 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeMetadata serves the RAM role credentials of the ECS metadata service, requiring the hardened mode token.
+func fakeMetadata(t *testing.T, role string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT "+metadataTokenPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aliyun-ecs-metadata-token-ttl-seconds") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("metadata-token"))
+	})
+	mux.HandleFunc("GET "+metadataRolePath+"{role...}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aliyun-ecs-metadata-token") != "metadata-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.PathValue("role") {
+		case "":
+			w.Write([]byte(role + "\n"))
+		case role:
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"STS.ecs","AccessKeySecret":"ecs-secret",` +
+				`"SecurityToken":"ecs-token","Expiration":"2030-01-01T00:00:00Z"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestECSRole(t *testing.T) {
+	srv := fakeMetadata(t, "sync-role")
+	for _, roleName := range []string{"", "sync-role"} {
+		creds, err := ECSRole(roleName, srv.URL+"/").Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("role %q: %v", roleName, err)
+		}
+		want := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		if creds.AccessKeyID != "STS.ecs" || creds.AccessKeySecret != "ecs-secret" || creds.SecurityToken != "ecs-token" || !creds.Expiration.Equal(want) {
+			t.Fatalf("role %q: unexpected credentials %+v", roleName, creds)
+		}
+	}
+}
+
+func TestECSRoleNoCredentials(t *testing.T) {
+	srv := fakeMetadata(t, "sync-role")
+	if _, err := ECSRole("other-role", srv.URL).Retrieve(context.Background()); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials for a missing role, got %v", err)
+	}
+	empty := fakeMetadata(t, "")
+	if _, err := ECSRole("", empty.URL).Retrieve(context.Background()); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials without an attached role, got %v", err)
+	}
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if _, err := ECSRole("", closed.URL).Retrieve(context.Background()); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials off ECS, got %v", err)
+	}
+}
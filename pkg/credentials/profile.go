@@ -0,0 +1,144 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the modes of Aliyun CLI profiles supported by Profile
+const (
+	profileModeAK                  = "AK"
+	profileModeStsToken            = "StsToken"
+	profileModeRamRoleArn          = "RamRoleArn"
+	profileModeEcsRamRole          = "EcsRamRole"
+	profileModeChainableRamRoleArn = "ChainableRamRoleArn"
+)
+
+// cliConfig is the config.json written by `aliyun configure`.
+type cliConfig struct {
+	Current  string       `json:"current"`
+	Profiles []cliProfile `json:"profiles"`
+}
+
+type cliProfile struct {
+	Name            string `json:"name"`
+	Mode            string `json:"mode"`
+	AccessKeyID     string `json:"access_key_id"`
+	AccessKeySecret string `json:"access_key_secret"`
+	StsToken        string `json:"sts_token"`
+	RamRoleName     string `json:"ram_role_name"`
+	RamRoleArn      string `json:"ram_role_arn"`
+	RoleSessionName string `json:"ram_session_name"`
+	ExpiredSeconds  int    `json:"expired_seconds"`
+	SourceProfile   string `json:"source_profile"`
+	StsRegion       string `json:"sts_region"`
+}
+
+// CLIConfigPath is where the Aliyun CLI keeps its profiles, ALIBABA_CLOUD_CONFIG_FILE overrides it.
+func CLIConfigPath() string {
+	if path := os.Getenv("ALIBABA_CLOUD_CONFIG_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aliyun", "config.json")
+}
+
+type profileProvider struct {
+	path string
+	name string
+}
+
+// Profile provides the credentials of a profile of the Aliyun CLI config at path, CLIConfigPath if empty.
+// name defaults to ALIBABA_CLOUD_PROFILE, then to the current profile of the CLI.
+func Profile(path, name string) Provider {
+	if path == "" {
+		path = CLIConfigPath()
+	}
+	if name == "" {
+		name = os.Getenv("ALIBABA_CLOUD_PROFILE")
+	}
+	return &profileProvider{path: path, name: name}
+}
+
+func (p *profileProvider) Name() string {
+	if p.name == "" {
+		return "aliyun cli profile"
+	}
+	return "aliyun cli profile " + p.name
+}
+
+func (p *profileProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	bs, err := os.ReadFile(p.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && p.name == "" {
+			return nil, ErrNoCredentials
+		}
+		return nil, err
+	}
+	var cfg cliConfig
+	if err := json.Unmarshal(bs, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.path, err)
+	}
+	name := p.name
+	if name == "" {
+		name = cfg.Current
+	}
+	provider, err := cfg.provider(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Retrieve(ctx)
+}
+
+// provider turns a profile into the provider of its mode, depth guards against source profiles referencing each other.
+func (c *cliConfig) provider(name string, depth int) (Provider, error) {
+	if depth > len(c.Profiles) {
+		return nil, fmt.Errorf("profile %s: source profiles form a loop", name)
+	}
+	var profile *cliProfile
+	for idx := range c.Profiles {
+		if c.Profiles[idx].Name == name {
+			profile = &c.Profiles[idx]
+			break
+		}
+	}
+	if profile == nil {
+		return nil, fmt.Errorf("profile %s not found", name)
+	}
+	switch profile.Mode {
+	case profileModeAK, "":
+		return Static(profile.AccessKeyID, profile.AccessKeySecret, ""), nil
+	case profileModeStsToken:
+		return Static(profile.AccessKeyID, profile.AccessKeySecret, profile.StsToken), nil
+	case profileModeRamRoleArn:
+		return profile.assumeRole(Static(profile.AccessKeyID, profile.AccessKeySecret, "")), nil
+	case profileModeChainableRamRoleArn:
+		source, err := c.provider(profile.SourceProfile, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return profile.assumeRole(source), nil
+	case profileModeEcsRamRole:
+		return ECSRole(profile.RamRoleName, ""), nil
+	}
+	return nil, fmt.Errorf("profile %s: unsupported mode %s", name, profile.Mode)
+}
+
+func (p *cliProfile) assumeRole(source Provider) Provider {
+	opts := []AssumeRoleOption{
+		WithSessionName(p.RoleSessionName),
+		WithDuration(time.Duration(p.ExpiredSeconds) * time.Second),
+	}
+	if p.StsRegion != "" {
+		opts = append(opts, WithSTSEndpoint(fmt.Sprintf("sts.%s.aliyuncs.com", p.StsRegion)))
+	}
+	return AssumeRole(source, p.RamRoleArn, opts...)
+}
@@ -0,0 +1,131 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCLIConfig = `{
+  "current": "ak",
+  "profiles": [
+    {"name": "ak", "mode": "AK", "access_key_id": "ak-id", "access_key_secret": "ak-secret"},
+    {"name": "sts", "mode": "StsToken", "access_key_id": "sts-id", "access_key_secret": "sts-secret", "sts_token": "sts-token"},
+    {"name": "role", "mode": "RamRoleArn", "access_key_id": "role-id", "access_key_secret": "role-secret",
+      "ram_role_arn": "acs:ram::1:role/a", "ram_session_name": "cli", "expired_seconds": 900, "sts_region": "cn-hangzhou"},
+    {"name": "chained", "mode": "ChainableRamRoleArn", "source_profile": "ak", "ram_role_arn": "acs:ram::1:role/b"},
+    {"name": "ecs", "mode": "EcsRamRole", "ram_role_name": "ecs-role"},
+    {"name": "loop-a", "mode": "ChainableRamRoleArn", "source_profile": "loop-b", "ram_role_arn": "acs:ram::1:role/c"},
+    {"name": "loop-b", "mode": "ChainableRamRoleArn", "source_profile": "loop-a", "ram_role_arn": "acs:ram::1:role/d"},
+    {"name": "oidc", "mode": "OIDC"}
+  ]
+}`
+
+func writeCLIConfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testCLIConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProfileStatic(t *testing.T) {
+	path := writeCLIConfig(t)
+	t.Setenv("ALIBABA_CLOUD_PROFILE", "")
+	tests := []struct {
+		name string
+		want Credentials
+	}{
+		{name: "", want: Credentials{AccessKeyID: "ak-id", AccessKeySecret: "ak-secret"}},
+		{name: "ak", want: Credentials{AccessKeyID: "ak-id", AccessKeySecret: "ak-secret"}},
+		{name: "sts", want: Credentials{AccessKeyID: "sts-id", AccessKeySecret: "sts-secret", SecurityToken: "sts-token"}},
+	}
+	for _, tt := range tests {
+		creds, err := Profile(path, tt.name).Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("profile %q: %v", tt.name, err)
+		}
+		if *creds != tt.want {
+			t.Fatalf("profile %q: got %+v, want %+v", tt.name, creds, tt.want)
+		}
+	}
+}
+
+func TestProfileModes(t *testing.T) {
+	cfg := readCLIConfig(t, writeCLIConfig(t))
+	role, err := cfg.provider("role", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assume, ok := role.(*assumeRoleProvider)
+	if !ok || assume.roleArn != "acs:ram::1:role/a" || assume.sessionName != "cli" || assume.duration != 15*time.Minute ||
+		assume.endpoint != "https://sts.cn-hangzhou.aliyuncs.com" {
+		t.Fatalf("unexpected RamRoleArn provider %+v", role)
+	}
+	if source, ok := assume.source.(*staticProvider); !ok || source.creds.AccessKeyID != "role-id" {
+		t.Fatalf("unexpected RamRoleArn source %+v", assume.source)
+	}
+	chained, err := cfg.provider("chained", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assume, ok = chained.(*assumeRoleProvider)
+	if !ok || assume.roleArn != "acs:ram::1:role/b" || assume.endpoint != DefaultSTSEndpoint {
+		t.Fatalf("unexpected ChainableRamRoleArn provider %+v", chained)
+	}
+	if source, ok := assume.source.(*staticProvider); !ok || source.creds.AccessKeyID != "ak-id" {
+		t.Fatalf("expected the source profile ak, got %+v", assume.source)
+	}
+	ecs, err := cfg.provider("ecs", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := ecs.(*ecsRoleProvider); !ok || p.roleName != "ecs-role" {
+		t.Fatalf("unexpected EcsRamRole provider %+v", ecs)
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	path := writeCLIConfig(t)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "loop-a", want: "loop"},
+		{name: "missing", want: "profile missing not found"},
+		{name: "oidc", want: "unsupported mode OIDC"},
+	}
+	for _, tt := range tests {
+		_, err := Profile(path, tt.name).Retrieve(context.Background())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("profile %s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+	missing := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("ALIBABA_CLOUD_PROFILE", "")
+	if _, err := Profile(missing, "").Retrieve(context.Background()); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials without a cli config, got %v", err)
+	}
+	if _, err := Profile(missing, "work").Retrieve(context.Background()); err == nil || errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected an error for a named profile without a cli config, got %v", err)
+	}
+}
+
+func readCLIConfig(t *testing.T, path string) *cliConfig {
+	t.Helper()
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg cliConfig
+	if err := json.Unmarshal(bs, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
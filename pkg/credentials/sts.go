@@ -0,0 +1,189 @@
+package credentials
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSTSEndpoint is the public STS endpoint, a regional one like sts-vpc.cn-hangzhou.aliyuncs.com avoids the internet
+	DefaultSTSEndpoint = "https://sts.aliyuncs.com"
+	// DefaultRoleDuration is how long assumed role credentials are valid
+	DefaultRoleDuration = time.Hour
+	// DefaultRoleSessionName names the sessions in the ActionTrail logs of the role
+	DefaultRoleSessionName = "osssync"
+)
+
+type assumeRoleProvider struct {
+	source      Provider
+	roleArn     string
+	sessionName string
+	duration    time.Duration
+	endpoint    string
+	client      *http.Client
+}
+
+// AssumeRoleOption configures AssumeRole.
+type AssumeRoleOption func(*assumeRoleProvider)
+
+// WithSessionName names the role session, DefaultRoleSessionName by default.
+func WithSessionName(name string) AssumeRoleOption {
+	return func(p *assumeRoleProvider) {
+		if name != "" {
+			p.sessionName = name
+		}
+	}
+}
+
+// WithDuration sets how long the credentials are valid, between 15 minutes and the maximum session duration of the role.
+func WithDuration(d time.Duration) AssumeRoleOption {
+	return func(p *assumeRoleProvider) {
+		if d > 0 {
+			p.duration = d
+		}
+	}
+}
+
+// WithSTSEndpoint calls STS at endpoint, a URL or a host name served over https.
+func WithSTSEndpoint(endpoint string) AssumeRoleOption {
+	return func(p *assumeRoleProvider) {
+		if endpoint == "" {
+			return
+		}
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		p.endpoint = endpoint
+	}
+}
+
+// AssumeRole provides temporary credentials of the RAM role roleArn, requested from STS with the credentials of source.
+// Wrapped in a Cache they are renewed before they expire.
+func AssumeRole(source Provider, roleArn string, opts ...AssumeRoleOption) Provider {
+	p := &assumeRoleProvider{
+		source:      source,
+		roleArn:     roleArn,
+		sessionName: DefaultRoleSessionName,
+		duration:    DefaultRoleDuration,
+		endpoint:    DefaultSTSEndpoint,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *assumeRoleProvider) Name() string {
+	return "assume role " + p.roleArn
+}
+
+type stsResponse struct {
+	Credentials *struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		AccessKeySecret string    `json:"AccessKeySecret"`
+		SecurityToken   string    `json:"SecurityToken"`
+		Expiration      time.Time `json:"Expiration"`
+	} `json:"Credentials"`
+	Code      string `json:"Code"`
+	Message   string `json:"Message"`
+	RequestID string `json:"RequestId"`
+}
+
+func (p *assumeRoleProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	source, err := p.source.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("source credentials: %w", err)
+	}
+	params := map[string]string{
+		"Action":          "AssumeRole",
+		"Version":         "2015-04-01",
+		"Format":          "JSON",
+		"RoleArn":         p.roleArn,
+		"RoleSessionName": p.sessionName,
+		"DurationSeconds": strconv.Itoa(int(p.duration.Seconds())),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+"/?"+signRPC(http.MethodGet, params, source), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// the url carries the security token of the source credentials
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("sts %s: %w", p.endpoint, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var ret stsResponse
+	if err := json.Unmarshal(body, &ret); err != nil {
+		return nil, fmt.Errorf("sts: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || ret.Credentials == nil {
+		return nil, fmt.Errorf("sts: %s: %s, request id %s", ret.Code, ret.Message, ret.RequestID)
+	}
+	return &Credentials{
+		AccessKeyID:     ret.Credentials.AccessKeyID,
+		AccessKeySecret: ret.Credentials.AccessKeySecret,
+		SecurityToken:   ret.Credentials.SecurityToken,
+		Expiration:      ret.Credentials.Expiration,
+	}, nil
+}
+
+// signRPC adds the common parameters of Alibaba Cloud RPC APIs to params and returns the signed query string,
+// see https://help.aliyun.com/document_detail/315526.html.
+func signRPC(method string, params map[string]string, creds *Credentials) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	params["AccessKeyId"] = creds.AccessKeyID
+	params["SignatureMethod"] = "HMAC-SHA1"
+	params["SignatureVersion"] = "1.0"
+	params["SignatureNonce"] = hex.EncodeToString(nonce)
+	params["Timestamp"] = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	if creds.SecurityToken != "" {
+		params["SecurityToken"] = creds.SecurityToken
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, percentEncode(k)+"="+percentEncode(params[k]))
+	}
+	query := strings.Join(pairs, "&")
+	return query + "&Signature=" + percentEncode(rpcSignature(method, query, creds.AccessKeySecret))
+}
+
+// rpcSignature signs the canonical query string, sorted and percent encoded.
+func rpcSignature(method, query, secret string) string {
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(method + "&" + percentEncode("/") + "&" + percentEncode(query)))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// percentEncode is the RFC 3986 encoding the signature is computed over.
+func percentEncode(s string) string {
+	return strings.NewReplacer("+", "%20", "*", "%2A", "%7E", "~").Replace(url.QueryEscape(s))
+}
@@ -0,0 +1,115 @@
+package credentials
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRPCSignature(t *testing.T) {
+	// the example of https://help.aliyun.com/document_detail/315526.html
+	query := "AccessKeyId=testid&Action=DescribeRegions&Format=XML&SignatureMethod=HMAC-SHA1" +
+		"&SignatureNonce=3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf&SignatureVersion=1.0" +
+		"&Timestamp=2016-02-23T12%3A46%3A24Z&Version=2014-05-26"
+	if got, want := rpcSignature("GET", query, "testsecret"), "OLeaidS1JvxuMvnyHOwuJ+uX5qY="; got != want {
+		t.Fatalf("signature %s, want %s", got, want)
+	}
+}
+
+// verifyRPC checks the signature of a request signed by signRPC with secret.
+func verifyRPC(r *http.Request, secret string) bool {
+	values := r.URL.Query()
+	signature := values.Get("Signature")
+	values.Del("Signature")
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, percentEncode(k)+"="+percentEncode(values.Get(k)))
+	}
+	return rpcSignature(r.Method, strings.Join(pairs, "&"), secret) == signature
+}
+
+func TestAssumeRole(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if !verifyRPC(r, "source-secret") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"Code":"SignatureDoesNotMatch","Message":"bad signature","RequestId":"r1"}`))
+			return
+		}
+		w.Write([]byte(`{"RequestId":"r2","Credentials":{"AccessKeyId":"STS.id","AccessKeySecret":"sts-secret",` +
+			`"SecurityToken":"sts-token","Expiration":"` + expiration.Format(time.RFC3339) + `"}}`))
+	}))
+	defer srv.Close()
+	p := AssumeRole(Static("source-id", "source-secret", "source-token"), "acs:ram::1:role/sync",
+		WithSTSEndpoint(srv.URL), WithSessionName("laptop"), WithDuration(30*time.Minute))
+	creds, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "STS.id" || creds.AccessKeySecret != "sts-secret" || creds.SecurityToken != "sts-token" || !creds.Expiration.Equal(expiration) {
+		t.Fatalf("unexpected credentials %+v", creds)
+	}
+	for k, want := range map[string]string{
+		"Action":          "AssumeRole",
+		"RoleArn":         "acs:ram::1:role/sync",
+		"RoleSessionName": "laptop",
+		"DurationSeconds": "1800",
+		"AccessKeyId":     "source-id",
+		"SecurityToken":   "source-token",
+		"Format":          "JSON",
+	} {
+		if got := query.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestAssumeRoleErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{name: "api error", status: http.StatusForbidden, body: `{"Code":"NoPermission","Message":"not allowed","RequestId":"r3"}`, want: "NoPermission: not allowed, request id r3"},
+		{name: "not json", status: http.StatusBadGateway, body: "<html>", want: "502 Bad Gateway"},
+		{name: "no credentials", status: http.StatusOK, body: `{"RequestId":"r4"}`, want: "request id r4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			_, err := AssumeRole(Static("id", "secret", ""), "arn", WithSTSEndpoint(srv.URL)).Retrieve(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestAssumeRoleHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	_, err := AssumeRole(Static("id", "secret", "very-secret-token"), "arn", WithSTSEndpoint(srv.URL)).Retrieve(context.Background())
+	if err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+	if strings.Contains(err.Error(), "very-secret-token") || strings.Contains(err.Error(), "Signature") {
+		t.Fatalf("error leaks the signed url: %v", err)
+	}
+}
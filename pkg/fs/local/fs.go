@@ -43,3 +43,27 @@ func (f FileInfo) ModTime() time.Time {
 func (f FileInfo) String() string {
 	return fmt.Sprintf("path:%s, modTime:%+v, size:%d, isDir:%+v", f.Path(), f.ModTime(), f.Size(), f.IsDir())
 }
+
+type staticInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (s staticInfo) Name() string       { return s.name }
+func (s staticInfo) Size() int64        { return s.size }
+func (s staticInfo) Mode() fs.FileMode  { return s.mode }
+func (s staticInfo) ModTime() time.Time { return s.modTime }
+func (s staticInfo) IsDir() bool        { return s.mode.IsDir() }
+func (s staticInfo) Sys() any           { return nil }
+
+// NewStaticFileInfo builds a FileInfo from stored attributes, e.g. for a file which no longer exists.
+func NewStaticFileInfo(path string, size int64, mode fs.FileMode, modTime time.Time) *FileInfo {
+	return NewFileInfo(staticInfo{
+		name:    filepath.Base(path),
+		size:    size,
+		mode:    mode,
+		modTime: modTime,
+	}, WithPath(path))
+}
@@ -0,0 +1,48 @@
+package local
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"hash/crc64"
+	"io"
+	"os"
+	"strconv"
+)
+
+// CRC64 returns the crc64 ecma checksum of a file, same as the x-oss-hash-crc64ecma header returned by oss.
+func CRC64(name string) (string, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	return CRC64Reader(fd)
+}
+
+// CRC64Reader returns the crc64 ecma checksum of everything read from r.
+func CRC64Reader(r io.Reader) (string, error) {
+	h := crc64.New(crc64.MakeTable(crc64.ECMA))
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(h.Sum64(), 10), nil
+}
+
+// MD5 returns the hex encoded md5 checksum of a file.
+func MD5(name string) (string, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	return MD5Reader(fd)
+}
+
+// MD5Reader returns the hex encoded md5 checksum of everything read from r.
+func MD5Reader(r io.Reader) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
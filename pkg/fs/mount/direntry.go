@@ -52,6 +52,7 @@ type DirEntry struct {
 	temp     *os.File
 	xattrs   map[string][]byte
 	mnt      string
+	cacheDir string
 	tempFile string
 	tempDir  bool
 }
@@ -66,6 +67,20 @@ func NewDirEntry(ctx context.Context, entry *oss.DirEntry, ossFS *oss.FS, mnt st
 	}
 }
 
+// newDirEntry creates a child entry sharing the mount settings of d.
+func (d *DirEntry) newDirEntry(ctx context.Context, entry *oss.DirEntry) *DirEntry {
+	ret := NewDirEntry(ctx, entry, d.OssFS(), d.Mountpoint())
+	ret.cacheDir = d.cacheDir
+	return ret
+}
+
+// newFile creates a child file sharing the mount settings of d.
+func (d *DirEntry) newFile(ctx context.Context, fi *oss.FileInfo) *DirEntry {
+	ret := NewFile(ctx, fi, d.OssFS(), d.Mountpoint())
+	ret.cacheDir = d.cacheDir
+	return ret
+}
+
 func NewFile(ctx context.Context, fi *oss.FileInfo, ossFS *oss.FS, mnt string) *DirEntry {
 	return &DirEntry{
 		entry: oss.NewDirEntry(fi),
@@ -395,7 +410,7 @@ func (d *DirEntry) Create(ctx context.Context, name string, flags uint32, mode u
 		Key:          filepath.Join(d.RelPath(), name),
 		LastModified: lastModified,
 	})
-	file := NewFile(ctx, fi, d.OssFS(), d.Mountpoint())
+	file := d.newFile(ctx, fi)
 	temp, err := file.CreateTemp()
 	if err != nil {
 		return nil, nil, 0, syscall.EIO
@@ -426,7 +441,7 @@ func (d *DirEntry) Mkdir(ctx context.Context, name string, mode uint32, out *fus
 	path := filepath.Join(d.RelPath(), name)
 	fi := oss.NewFileInfoWithDir(path)
 	entry := oss.NewDirEntry(fi)
-	newDir := NewDirEntry(ctx, entry, d.OssFS(), d.Mountpoint())
+	newDir := d.newDirEntry(ctx, entry)
 
 	child := d.NewPersistentInode(ctx, newDir, fs.StableAttr{Mode: F_DIR_RW})
 	if success := d.AddChild(name, child, false); success {
@@ -564,13 +579,13 @@ func (d *DirEntry) Lookup(ctx context.Context, name string, out *fuse.EntryOut)
 	if child == nil {
 		key := filepath.Join(d.RelPath(), name)
 		if obj, err := d.OssFS().Open(ctx, key); err == nil {
-			file := NewFile(ctx, obj.(*oss.File).Info(), d.OssFS(), d.Mountpoint())
+			file := d.newFile(ctx, obj.(*oss.File).Info())
 			child = d.NewPersistentInode(ctx, file, fs.StableAttr{Mode: F_FILE_RW})
 		} else {
 			iter := d.OssFS().ReadDirFile(key)
 			if list, err := iter.ReadDir(ctx, 1); err == nil && len(list) > 0 {
 				fi := oss.NewFileInfoWithDir(key)
-				dir := NewDirEntry(ctx, oss.NewDirEntry(fi), d.OssFS(), d.Mountpoint())
+				dir := d.newDirEntry(ctx, oss.NewDirEntry(fi))
 				child = d.NewPersistentInode(ctx, dir, fs.StableAttr{Mode: F_DIR_RW})
 			} else {
 				return nil, syscall.ENOENT
@@ -691,7 +706,10 @@ func (d *DirEntry) tempFilename() string {
 }
 
 func (d *DirEntry) CreateTemp() (*os.File, error) {
-	tmpDir := filepath.Join(os.TempDir(), pkg.AppIdentity)
+	tmpDir := d.cacheDir
+	if tmpDir == "" {
+		tmpDir = filepath.Join(os.TempDir(), pkg.AppIdentity)
+	}
 	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
 			return nil, err
@@ -52,9 +52,12 @@ type FS struct {
 	mnt   string
 }
 
-func NewFS(ctx context.Context, fs *oss.FS, mnt string) *FS {
+// NewFS creates the root of a mount, files being written are buffered in cacheDir, os.TempDir() if empty.
+func NewFS(ctx context.Context, fs *oss.FS, mnt string, cacheDir string) *FS {
+	root := NewDirEntry(ctx, oss.NewDirEntry(oss.NewFileInfoWithDir("")), fs, mnt)
+	root.cacheDir = cacheDir
 	return &FS{
-		iFS:   NewDirEntry(ctx, oss.NewDirEntry(oss.NewFileInfoWithDir("")), fs, mnt),
+		iFS:   root,
 		ossFS: fs,
 		mnt:   mnt,
 	}
@@ -84,14 +87,14 @@ func (r *FS) Iter(ctx context.Context, reader *oss.ReadDirFile, p *fs.Inode) {
 			if entry.IsDir() {
 				child := p.GetChild(entry.Name())
 				if child == nil {
-					dir := NewDirEntry(ctx, entry, r.OssFS(), r.Mountpoint())
+					dir := r.iFS.(*DirEntry).newDirEntry(ctx, entry)
 					child = p.NewPersistentInode(ctx, dir, fs.StableAttr{Mode: F_DIR_RW})
 					p.AddChild(entry.Name(), child, true)
 				}
 				p = child
 				r.Iter(ctx, oss.NewReadDirFile(r.ossFS, entry.Path()), p)
 			} else {
-				file := NewDirEntry(ctx, entry, r.OssFS(), r.Mountpoint())
+				file := r.iFS.(*DirEntry).newDirEntry(ctx, entry)
 				// Create the file. The Inode must be persistent,
 				// because its life time is not under control of the
 				// kernel.
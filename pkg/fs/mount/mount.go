@@ -16,55 +16,89 @@ import (
 
 type Mounter struct {
 	ossFS      *oss.FS
-	stopCh     chan struct{}
-	exitCh     chan struct{}
+	srv        *fuse.Server
+	doneCh     chan struct{}
 	mountpoint string
 	name       string
+	cacheDir   string
+	readOnly   bool
+	allowOther bool
+	debug      bool
+	// created is set when the mountpoint was created by Mount and has to be removed after unmount
+	created bool
 }
 
-func NewMounter(ossFS *oss.FS, mountpoint string, name string) *Mounter {
-	return &Mounter{
+func NewMounter(ossFS *oss.FS, mountpoint string, name string, opts ...Option) *Mounter {
+	m := &Mounter{
 		ossFS:      ossFS,
 		mountpoint: mountpoint,
 		name:       name,
-		stopCh:     make(chan struct{}, 1),
-		exitCh:     make(chan struct{}, 1),
+		doneCh:     make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
+// Mount mounts the bucket and returns once the mount is ready, the file system is served in the background until Unmount.
 func (m *Mounter) Mount(ctx context.Context) error {
-	root := NewFS(ctx, m.ossFS, m.mountpoint)
+	if _, err := os.Stat(m.mountpoint); os.IsNotExist(err) {
+		if err := os.MkdirAll(m.mountpoint, 0o755); err != nil {
+			return err
+		}
+		m.created = true
+	}
+	var options []string
+	if m.readOnly {
+		options = append(options, "ro")
+	}
+	root := NewFS(ctx, m.ossFS, m.mountpoint, m.cacheDir)
 	srv, err := mount(m.mountpoint, root, &fs.Options{
 		MountOptions: fuse.MountOptions{
 			DisableXAttrs:        true,
 			DirectMount:          true,
-			DirectMountStrict:    true,
 			SyncRead:             true,
 			FsName:               fmt.Sprintf("ossfs/%s", m.name),
 			Name:                 fmt.Sprintf("ossfs/%s", m.name),
-			AllowOther:           false,
+			AllowOther:           m.allowOther,
 			RememberInodes:       true,
 			IgnoreSecurityLabels: true,
-			Debug:                false,
+			Debug:                m.debug,
+			Options:              options,
 		},
 	})
-	if err != nil && srv == nil {
-		fmt.Println(err)
+	if err != nil {
+		if srv != nil {
+			srv.Unmount()
+		}
+		m.removeMountpoint()
+		close(m.doneCh)
 		return err
 	}
+	m.srv = srv
 	go func() {
-		<-m.stopCh
-		if _, err := os.Stat(m.mountpoint); !os.IsNotExist(err) {
-			srv.Unmount()
-			srv.Wait()
-		}
-		os.RemoveAll(m.mountpoint)
-		m.exitCh <- struct{}{}
+		srv.Wait()
+		m.removeMountpoint()
+		close(m.doneCh)
 	}()
 	return nil
 }
 
-func (m *Mounter) unmount() {
+// Done is closed once the file system is unmounted, also when unmounted by another process.
+func (m *Mounter) Done() <-chan struct{} {
+	return m.doneCh
+}
+
+func (m *Mounter) Mountpoint() string {
+	return m.mountpoint
+}
+
+func (m *Mounter) removeMountpoint() {
+	if m.created {
+		// never RemoveAll, a still mounted directory would be emptied remotely
+		os.Remove(m.mountpoint)
+	}
 }
 
 func mount(dir string, root fs.InodeEmbedder, options *fs.Options) (*fuse.Server, error) {
@@ -93,9 +127,21 @@ func mount(dir string, root fs.InodeEmbedder, options *fs.Options) (*fuse.Server
 	return server, nil
 }
 
-func (m *Mounter) Unmount() {
-	m.stopCh <- struct{}{}
-	<-m.exitCh
+// Unmount unmounts the file system and waits until it stopped serving, it fails while files are in use.
+func (m *Mounter) Unmount() error {
+	if m.srv == nil {
+		return nil
+	}
+	select {
+	case <-m.doneCh:
+		return nil
+	default:
+	}
+	if err := m.srv.Unmount(); err != nil {
+		return err
+	}
+	<-m.doneCh
+	return nil
 }
 
 func (m *Mounter) Open() error {
@@ -0,0 +1,31 @@
+package mount
+
+type Option func(m *Mounter)
+
+// WithReadOnly mounts the bucket read only.
+func WithReadOnly(readOnly bool) Option {
+	return func(m *Mounter) {
+		m.readOnly = readOnly
+	}
+}
+
+// WithAllowOther lets other users access the mount, it needs user_allow_other in /etc/fuse.conf.
+func WithAllowOther(allow bool) Option {
+	return func(m *Mounter) {
+		m.allowOther = allow
+	}
+}
+
+// WithCacheDir sets the directory files being written are buffered in before they are uploaded.
+func WithCacheDir(dir string) Option {
+	return func(m *Mounter) {
+		m.cacheDir = dir
+	}
+}
+
+// WithDebug logs every fuse request.
+func WithDebug(debug bool) Option {
+	return func(m *Mounter) {
+		m.debug = debug
+	}
+}
@@ -0,0 +1,45 @@
+package mount
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Unmount unmounts a fuse mountpoint mounted by another process, lazy detaches it even if files are in use.
+func Unmount(mountpoint string, lazy bool) error {
+	var cmds [][]string
+	if runtime.GOOS == "linux" {
+		args := []string{"-u"}
+		if lazy {
+			args = append(args, "-z")
+		}
+		args = append(args, mountpoint)
+		cmds = append(cmds, append([]string{"fusermount3"}, args...), append([]string{"fusermount"}, args...))
+	}
+	args := []string{mountpoint}
+	if lazy {
+		if runtime.GOOS == "linux" {
+			args = append([]string{"-l"}, args...)
+		} else {
+			args = append([]string{"-f"}, args...)
+		}
+	}
+	cmds = append(cmds, append([]string{"umount"}, args...))
+	var errs []error
+	for _, cmd := range cmds {
+		if _, err := exec.LookPath(cmd[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, errors.New(strings.TrimSpace(string(out))))
+	}
+	if len(errs) == 0 {
+		return errors.New("no fusermount or umount command found")
+	}
+	return errors.Join(errs...)
+}
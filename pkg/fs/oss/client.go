@@ -11,16 +11,21 @@ type Client struct {
 	bucket *oss.Bucket
 }
 
+// NewClient connects to a bucket, signing requests with the credentials of provider.
 func NewClient(
 	bucketName string,
 	endpoint string,
-	accessID string,
-	accessSecret string,
+	provider oss.CredentialsProvider,
 ) (*Client, error) {
-	client, err := oss.New(endpoint, accessID, accessSecret)
+	client, err := oss.New(endpoint, "", "", oss.SetCredentialsProvider(provider))
 	if err != nil {
 		return nil, err
 	}
+	return NewBucketClient(client, bucketName)
+}
+
+// NewBucketClient connects to a bucket with an existing client, so FSes of the same account share its connections and credentials.
+func NewBucketClient(client *oss.Client, bucketName string) (*Client, error) {
 	bucket, err := client.Bucket(bucketName)
 	if err != nil {
 		return nil, err
@@ -45,7 +50,7 @@ func (clt *Client) list(ctx context.Context, name string, cb func([]oss.ObjectPr
 		}
 		list = append(list, res.Objects...)
 		if cb != nil {
-			if err := cb(list); err != nil {
+			if err := cb(res.Objects); err != nil {
 				return list, err
 			}
 		}
@@ -0,0 +1,127 @@
+package oss
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	local "github.com/bububa/osssync/pkg/fs/local"
+)
+
+// TempSuffix marks partially downloaded files, watchers should ignore files containing it.
+const TempSuffix = ".osssync-tmp"
+
+// IsTempFile reports whether name is a partial download written by Download.
+func IsTempFile(name string) bool {
+	return strings.Contains(filepath.Base(name), TempSuffix)
+}
+
+// Download fetches remotePath into its matching path under the local setting folder and returns that path.
+func (f *FS) Download(ctx context.Context, remotePath string) (string, error) {
+	localFile, err := f.LocalPathFromRemotePath(remotePath)
+	if err != nil {
+		return "", err
+	}
+	return localFile, f.DownloadTo(ctx, remotePath, localFile)
+}
+
+// DownloadTo fetches remotePath into localFile.
+// The object is written to a temp file next to localFile, verified against the remote size and crc64,
+// then renamed into place with the remote modification time so it isn't uploaded back.
+func (f *FS) DownloadTo(ctx context.Context, remotePath string, localFile string) error {
+	remotePath = f.PathAddPrefix(remotePath)
+	header, err := f.clt.bucket.GetObjectDetailedMeta(remotePath, oss.WithContext(ctx))
+	if err != nil {
+		if e, ok := err.(oss.ServiceError); ok && e.Code == "NoSuchKey" {
+			return fs.ErrNotExist
+		}
+		return err
+	}
+	info := NewFileInfoWithHeader(remotePath, header)
+	if err := os.MkdirAll(filepath.Dir(localFile), os.ModePerm); err != nil {
+		return err
+	}
+	tmpFile := filepath.Join(filepath.Dir(localFile), "."+filepath.Base(localFile)+TempSuffix)
+	opts := []oss.Option{
+		oss.Progress(f.listener.DownloadListener(remotePath, localFile)),
+		oss.WithContext(ctx),
+	}
+	if info.Size() >= f.multipartThreshold {
+		cpFile := f.downloadCheckpointPath(remotePath, localFile)
+		if err := os.MkdirAll(filepath.Dir(cpFile), 0o700); err != nil {
+			return err
+		}
+		opts = append(opts, oss.Routines(f.routines), oss.Checkpoint(true, cpFile))
+		err = f.clt.bucket.DownloadFile(remotePath, tmpFile, calPartSize(info.Size(), f.partSize), opts...)
+	} else {
+		err = f.clt.bucket.GetObjectToFile(remotePath, tmpFile, opts...)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := verifyDownload(tmpFile, info.Size(), header.Get(oss.HTTPHeaderOssCRC64)); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	if modTime := info.ModTime(); !modTime.IsZero() {
+		if err := os.Chtimes(tmpFile, modTime, modTime); err != nil {
+			os.Remove(tmpFile)
+			return err
+		}
+	}
+	return os.Rename(tmpFile, localFile)
+}
+
+// LocalPathFromRemotePath maps a remote path back to its location under the local setting folder.
+func (f *FS) LocalPathFromRemotePath(remotePath string) (string, error) {
+	if f.local == "" {
+		return "", errors.New("local setting path is empty")
+	}
+	rel := filepath.FromSlash(f.PathRemovePrefix(remotePath))
+	if rel == "." || rel == ".." || filepath.IsAbs(rel) || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid remote path %s, not inside prefix", remotePath)
+	}
+	return filepath.Join(f.local, rel), nil
+}
+
+func verifyDownload(name string, size int64, crc string) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != size {
+		return fmt.Errorf("verify %s failed, size mismatch, expected:%d, got:%d", name, size, fi.Size())
+	}
+	if crc == "" {
+		return nil
+	}
+	if _, err := strconv.ParseUint(crc, 10, 64); err != nil {
+		return nil
+	}
+	got, err := local.CRC64(name)
+	if err != nil {
+		return err
+	}
+	if got != crc {
+		return fmt.Errorf("verify %s failed, crc64 mismatch, expected:%s, got:%s", name, crc, got)
+	}
+	return nil
+}
+
+func (f *FS) downloadCheckpointPath(remotePath string, localFile string) string {
+	enc := md5.New()
+	enc.Write([]byte(f.clt.bucket.BucketName))
+	enc.Write([]byte(remotePath))
+	enc.Write([]byte(localFile))
+	return filepath.Join(f.stateDir, "download", hex.EncodeToString(enc.Sum(nil))+".cp")
+}
@@ -3,8 +3,10 @@ package oss
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -21,10 +23,20 @@ const (
 	MaxParts        = 10000
 	MinParts        = 1000
 	DefaultPartSize = 500 << 10
+	// MinPartSize is the smallest part OSS accepts in a multipart upload, except for the last one
+	MinPartSize     = oss.MinPartSize
+	DefaultRoutines = 3
+	MaxDeleteKeys   = 1000
+	CopyRoutines    = 10
 )
 
 func clearDirPath(dir string) string {
-	return filepath.Clean(filepath.ToSlash(dir)) + "/"
+	dir = filepath.Clean(filepath.ToSlash(dir))
+	if dir == "." || dir == "/" {
+		// the bucket root
+		return ""
+	}
+	return dir + "/"
 }
 
 func cleanRemotePath(name string) string {
@@ -43,17 +55,25 @@ func isHidden(name string) bool {
 }
 
 type FS struct {
-	clt          *Client
-	listener     *MultiProgressListener
-	local        string
-	prefix       string
-	ignoreHidden bool
+	clt                *Client
+	listener           *MultiProgressListener
+	local              string
+	prefix             string
+	stateDir           string
+	multipartThreshold int64
+	partSize           int64
+	routines           int
+	ignoreHidden       bool
 }
 
 func NewFS(clt *Client, opts ...Option) *FS {
 	ret := &FS{
-		clt:      clt,
-		listener: NewMultiProgressListener(),
+		clt:                clt,
+		listener:           NewMultiProgressListener(),
+		stateDir:           filepath.Join(os.TempDir(), "osssync"),
+		multipartThreshold: MinBigFile,
+		partSize:           DefaultPartSize,
+		routines:           DefaultRoutines,
 	}
 	for _, opt := range opts {
 		opt(ret)
@@ -131,6 +151,57 @@ func (f *FS) ReadAt(ctx context.Context, name string, size int64, offset int64)
 	return io.ReadAll(body)
 }
 
+// Meta returns every header of an object, including user metadata.
+func (f *FS) Meta(ctx context.Context, name string) (http.Header, error) {
+	name = f.PathAddPrefix(name)
+	header, err := f.clt.bucket.GetObjectDetailedMeta(name, oss.WithContext(ctx))
+	if err != nil {
+		if e, ok := err.(oss.ServiceError); ok && e.Code == "NoSuchKey" {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return header, nil
+}
+
+// OpenRange streams an object from offset, length <= 0 reads until the end.
+func (f *FS) OpenRange(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, error) {
+	name = f.PathAddPrefix(name)
+	opts := []oss.Option{oss.WithContext(ctx)}
+	if length > 0 {
+		opts = append(opts, oss.Range(offset, offset+length-1))
+	} else if offset > 0 {
+		opts = append(opts, oss.NormalizedRange(fmt.Sprintf("%d-", offset)))
+	}
+	body, err := f.clt.bucket.GetObject(name, opts...)
+	if err != nil {
+		if e, ok := err.(oss.ServiceError); ok && e.Code == "NoSuchKey" {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// Walk calls fn for every object under dir except directory markers, paths passed to fn are relative to the prefix.
+func (f *FS) Walk(ctx context.Context, dir string, fn func(info *FileInfo) error) error {
+	dir = f.PathAddPrefix(dir)
+	_, err := f.clt.list(ctx, dir, func(list []oss.ObjectProperties) error {
+		for _, obj := range list {
+			if strings.HasSuffix(obj.Key, "/") {
+				// directory marker
+				continue
+			}
+			obj.Key = f.PathRemovePrefix(obj.Key)
+			if err := fn(NewFileInfo(&obj)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
 func (f *FS) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
 	file, err := f.Open(ctx, name)
 	if err != nil {
@@ -176,20 +247,30 @@ func (f *FS) UploadFile(ctx context.Context, localFile *local.FileInfo) error {
 		return nil
 	}
 
+	// a downloaded file carries the remote modification time, it is only uploaded back once changed locally
 	if s, err := f.Stat(ctx, remotePath); err == nil {
-		if s.ModTime().After(localFile.ModTime()) {
+		if !localFile.ModTime().After(s.ModTime()) {
 			return nil
 		}
 	}
+	return f.UploadFileTo(ctx, localFile, remotePath)
+}
+
+// UploadFileTo uploads localFile to remotePath unconditionally, localFile may live outside the local setting folder.
+func (f *FS) UploadFileTo(ctx context.Context, localFile *local.FileInfo, remotePath string) error {
+	remotePath = f.PathAddPrefix(remotePath)
 	opts := []oss.Option{
 		oss.WithContext(ctx),
 		oss.ACL(oss.ACLPrivate),
 		oss.Progress(f.listener.UploadListener(localFile.Path(), remotePath)),
 	}
-	if localFile.Size() >= MinBigFile {
-		cpDir := f.uploadCheckoutPointPath(localFile)
-		opts = append(opts, oss.Routines(3), oss.Checkpoint(true, cpDir))
-		return f.clt.bucket.UploadFile(remotePath, localFile.Path(), calPartSize(localFile.Size()), opts...)
+	if localFile.Size() >= f.multipartThreshold {
+		cpFile := f.uploadCheckpointPath(remotePath)
+		if err := os.MkdirAll(filepath.Dir(cpFile), 0o700); err != nil {
+			return err
+		}
+		opts = append(opts, oss.Routines(f.routines), oss.Checkpoint(true, cpFile))
+		return f.clt.bucket.UploadFile(remotePath, localFile.Path(), calPartSize(localFile.Size(), f.partSize), opts...)
 	}
 	return f.clt.bucket.PutObjectFromFile(remotePath, localFile.Path(), opts...)
 }
@@ -250,27 +331,6 @@ func (f *FS) Rename(ctx context.Context, src string, dist string) error {
 	return nil
 }
 
-func (f *FS) RenameDir(ctx context.Context, src string, dist string) error {
-	src = f.PathAddPrefix(src)
-	dist = f.PathAddPrefix(dist)
-	_, err := f.clt.list(ctx, src, func(list []oss.ObjectProperties) error {
-		keys := make([]string, 0, len(list))
-		for _, v := range list {
-			keys = append(keys, v.Key)
-			target := cleanRemotePath(filepath.Join(dist, filepath.Base(v.Key)))
-			if err := f.Copy(ctx, v.Key, target); err != nil {
-				return err
-			}
-		}
-		if _, err := f.Remove(ctx, keys...); err != nil {
-			return err
-		} else {
-		}
-		return nil
-	})
-	return err
-}
-
 func (f *FS) Copy(ctx context.Context, src string, dist string) error {
 	src = f.PathAddPrefix(src)
 	dist = f.PathAddPrefix(dist)
@@ -278,14 +338,6 @@ func (f *FS) Copy(ctx context.Context, src string, dist string) error {
 	return err
 }
 
-func (f *FS) Download(ctx context.Context, remotePath string, localPath string) error {
-	remotePath = f.PathAddPrefix(remotePath)
-	fn := filepath.Base(remotePath)
-	localFile := filepath.Join(localPath, fn)
-	cpDir := f.downloadCheckoutPointPath(localPath, fn)
-	return f.clt.bucket.DownloadFile(remotePath, localFile, DefaultPartSize, oss.Checkpoint(true, cpDir), oss.Progress(f.listener.DownloadListener(remotePath, localFile)), oss.WithContext(ctx))
-}
-
 func (f *FS) RemotePathFromLocalFile(localFile *local.FileInfo) (string, error) {
 	name := cleanLocalPath(localFile.Path())
 	if !strings.HasPrefix(name, f.local) {
@@ -311,16 +363,16 @@ func (f *FS) PathAddPrefix(name string) string {
 	return filepath.Join(f.prefix, name)
 }
 
-func (f *FS) uploadCheckoutPointPath(localFile *local.FileInfo) string {
-	return filepath.Join(filepath.Dir(localFile.Path()), ".osssync-upload", localFile.Name())
+func (f *FS) Events() <-chan ProgressEvent {
+	return f.listener.Events()
 }
 
-func (f *FS) downloadCheckoutPointPath(path string, name string) string {
-	return filepath.Join(filepath.Dir(path), ".osssync-download", name)
+func (f *FS) DroppedEvents() uint64 {
+	return f.listener.Dropped()
 }
 
-func (f *FS) Events() <-chan ProgressEvent {
-	return f.listener.Events()
+func (f *FS) StateDir() string {
+	return f.stateDir
 }
 
 func (f *FS) Root() string {
@@ -335,11 +387,14 @@ func (f *FS) Close() {
 	f.listener.Close()
 }
 
-func calPartSize(size int64) int64 {
-	if size/DefaultPartSize > MaxParts {
+func calPartSize(size int64, partSize int64) int64 {
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	if size/partSize > MaxParts {
 		return size / MinParts
 	}
-	return DefaultPartSize
+	return partSize
 }
 
 func (fs *FS) ReadDirFile(name string) *ReadDirFile {
@@ -359,8 +414,8 @@ func NewReadDirFS(fs *FS) *ReadDirFS {
 
 func (f *ReadDirFS) ReadDir(ctx context.Context, name string) ([]fs.DirEntry, error) {
 	var entries []fs.DirEntry
-	name = f.PathAddPrefix(name)
-	prefix := oss.Prefix(clearDirPath(name))
+	dir := clearDirPath(f.PathAddPrefix(name))
+	prefix := oss.Prefix(dir)
 	listType := oss.ListType(2)
 	continuationToken := oss.ContinuationToken("")
 	startAfter := oss.StartAfter("")
@@ -370,6 +425,10 @@ func (f *ReadDirFS) ReadDir(ctx context.Context, name string) ([]fs.DirEntry, er
 			return entries, err
 		}
 		for _, obj := range res.Objects {
+			if obj.Key == dir {
+				// directory marker of the listed dir itself
+				continue
+			}
 			obj.Key = f.PathRemovePrefix(obj.Key)
 			entry := NewDirEntry(NewFileInfo(&obj))
 			entries = append(entries, entry)
@@ -0,0 +1,581 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"github.com/bububa/osssync/pkg/fs/local"
+)
+
+type testObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// testServer is a path-style OSS bucket keeping objects in memory, enough to list, head, get, put, copy and
+// delete them and to upload them in parts.
+type testServer struct {
+	mu      gosync.Mutex
+	objects map[string]testObject
+	puts    int
+	// copies counts the copies per destination key
+	copies map[string]int
+	// failCopy makes copies to the keys fail, corruptCopy truncates them
+	failCopy    map[string]bool
+	corruptCopy map[string]bool
+	// locked keys are left out of the result of a delete
+	locked map[string]bool
+	// uploads are the multipart uploads in progress by upload ID, aborted the IDs of the aborted ones
+	uploads map[string]*testUpload
+	aborted []string
+	// failPart makes the upload of the part numbers fail once
+	failPart map[int]bool
+}
+
+type testUpload struct {
+	key       string
+	parts     map[int][]byte
+	initiated time.Time
+}
+
+func newTestServer(objects map[string]testObject) *testServer {
+	if objects == nil {
+		objects = make(map[string]testObject)
+	}
+	return &testServer{
+		objects:     objects,
+		copies:      make(map[string]int),
+		failCopy:    make(map[string]bool),
+		corruptCopy: make(map[string]bool),
+		locked:      make(map[string]bool),
+		uploads:     make(map[string]*testUpload),
+		failPart:    make(map[int]bool),
+	}
+}
+
+func testCRC64(data []byte) string {
+	return strconv.FormatUint(crc64.Checksum(data, crc64.MakeTable(crc64.ECMA)), 10)
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	switch {
+	case query.Has("uploads") || query.Has("uploadId"):
+		s.multipart(w, r, key)
+	case r.Method == http.MethodPost && query.Has("delete"):
+		s.delete(w, r)
+	case query.Has("bucketInfo"):
+		// the keys are scoped to object operations
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>bucket info refused</Message></Error>")
+	case r.Method == http.MethodHead && key == "":
+		// the bucket exists
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, query.Get("prefix"))
+	case r.Method == http.MethodPut && r.Header.Get(oss.HTTPHeaderOssCopySource) != "":
+		s.copy(w, r, key)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = testObject{data: data, modTime: time.Now().Truncate(time.Second)}
+		s.puts++
+		w.Header().Set(oss.HTTPHeaderOssCRC64, testCRC64(data))
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		obj, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set(oss.HTTPHeaderOssCRC64, testCRC64(obj.data))
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *testServer) list(w http.ResponseWriter, prefix string) {
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "<ListBucketResult><Prefix>%s</Prefix><KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated>", prefix, len(keys))
+	for _, key := range keys {
+		obj := s.objects[key]
+		fmt.Fprintf(&buf, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>", key, len(obj.data), obj.modTime.UTC().Format(time.RFC3339))
+	}
+	buf.WriteString("</ListBucketResult>")
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, buf.String())
+}
+
+func (s *testServer) copy(w http.ResponseWriter, r *http.Request, key string) {
+	source, _ := url.QueryUnescape(r.Header.Get(oss.HTTPHeaderOssCopySource))
+	_, src, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	obj, ok := s.objects[src]
+	if !ok || s.failCopy[key] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.copies[key]++
+	data := append([]byte{}, obj.data...)
+	if s.corruptCopy[key] && len(data) > 0 {
+		data = data[:len(data)-1]
+	}
+	s.objects[key] = testObject{data: data, modTime: time.Now().Truncate(time.Second)}
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<CopyObjectResult><ETag>"etag"</ETag><LastModified>%s</LastModified></CopyObjectResult>`, time.Now().UTC().Format(time.RFC3339))
+}
+
+func (s *testServer) delete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Objects []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var buf strings.Builder
+	buf.WriteString("<DeleteResult>")
+	for _, obj := range req.Objects {
+		if s.locked[obj.Key] {
+			continue
+		}
+		delete(s.objects, obj.Key)
+		fmt.Fprintf(&buf, "<Deleted><Key>%s</Key></Deleted>", obj.Key)
+	}
+	buf.WriteString("</DeleteResult>")
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, buf.String())
+}
+
+func (s *testServer) multipart(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	w.Header().Set("Content-Type", "application/xml")
+	if r.Method == http.MethodGet {
+		ids := make([]string, 0, len(s.uploads))
+		for id := range s.uploads {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		var buf strings.Builder
+		buf.WriteString("<ListMultipartUploadsResult><Bucket>bucket</Bucket><IsTruncated>false</IsTruncated>")
+		for _, id := range ids {
+			upload := s.uploads[id]
+			fmt.Fprintf(&buf, "<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>%s</Initiated></Upload>", upload.key, id, upload.initiated.UTC().Format(time.RFC3339))
+		}
+		buf.WriteString("</ListMultipartUploadsResult>")
+		io.WriteString(w, buf.String())
+		return
+	}
+	if r.Method == http.MethodPost && query.Has("uploads") {
+		id := fmt.Sprintf("upload-%d", len(s.uploads)+len(s.aborted)+1)
+		s.uploads[id] = &testUpload{key: key, parts: make(map[int][]byte), initiated: time.Now()}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, id)
+		return
+	}
+	id := query.Get("uploadId")
+	upload, ok := s.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<Error><Code>NoSuchUpload</Code><Message>upload not found</Message></Error>")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if s.failPart[number] {
+			delete(s.failPart, number)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>part refused</Message></Error>")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		upload.parts[number] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, number))
+		w.Header().Set(oss.HTTPHeaderOssCRC64, testCRC64(data))
+	case http.MethodPost:
+		numbers := make([]int, 0, len(upload.parts))
+		for number := range upload.parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, number := range numbers {
+			data = append(data, upload.parts[number]...)
+		}
+		s.objects[upload.key] = testObject{data: data, modTime: time.Now().Truncate(time.Second)}
+		delete(s.uploads, id)
+		w.Header().Set(oss.HTTPHeaderOssCRC64, testCRC64(data))
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`, upload.key)
+	case http.MethodDelete:
+		delete(s.uploads, id)
+		s.aborted = append(s.aborted, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// keys returns the keys of the objects, sorted.
+func (s *testServer) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// testFS is an FS with the prefix docs on a bucket served by srv.
+func testFS(t *testing.T, srv *testServer, opts ...Option) *FS {
+	t.Helper()
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	clt, err := oss.New(ts.URL, "id", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := NewBucketClient(clt, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFS(bucket, append([]Option{WithPrefix("docs"), WithLocal(t.TempDir()), WithStateDir(t.TempDir())}, opts...)...)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestDownloadNotUploadedBack(t *testing.T) {
+	srv := newTestServer(map[string]testObject{
+		"docs/a.txt": {data: []byte("remote"), modTime: time.Now().Add(-time.Hour).Truncate(time.Second)},
+	})
+	f := testFS(t, srv)
+	ctx := context.Background()
+	path, err := f.Download(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func() {
+		t.Helper()
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.UploadFile(ctx, local.NewFileInfo(fi, local.WithPath(path))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload()
+	if srv.puts != 0 {
+		t.Fatalf("expected the downloaded file not to be uploaded back, got %d puts", srv.puts)
+	}
+	// a local change made after the download is uploaded
+	if err := os.WriteFile(path, []byte("local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	upload()
+	if srv.puts != 1 || !bytes.Equal(srv.objects["docs/a.txt"].data, []byte("local")) {
+		t.Fatalf("expected the local change to be uploaded, got %d puts", srv.puts)
+	}
+}
+
+func testRenameObjects() map[string]testObject {
+	now := time.Now().Truncate(time.Second)
+	return map[string]testObject{
+		"docs/src/a.txt":     {data: []byte("a"), modTime: now},
+		"docs/src/sub/b.txt": {data: []byte("bb"), modTime: now},
+		// shares the name of src as a prefix without being inside it
+		"docs/srcx/c.txt": {data: []byte("c"), modTime: now},
+	}
+}
+
+// renameJournals returns the journals of directory renames not finished yet.
+func renameJournals(t *testing.T, f *FS) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(f.renameJournalDir(), "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestRenameDir(t *testing.T) {
+	srv := newTestServer(testRenameObjects())
+	f := testFS(t, srv)
+	if err := f.RenameDir(context.Background(), "src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"docs/dst/a.txt", "docs/dst/sub/b.txt", "docs/srcx/c.txt"}
+	if keys := srv.keys(); !slices.Equal(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	if !bytes.Equal(srv.objects["docs/dst/sub/b.txt"].data, []byte("bb")) {
+		t.Fatal("expected the content to move along")
+	}
+	if journals := renameJournals(t, f); len(journals) != 0 {
+		t.Fatalf("expected the journal to be removed, got %v", journals)
+	}
+	if err := f.RenameDir(context.Background(), "dst", "dst/sub"); err == nil {
+		t.Fatal("expected moving a directory into itself to fail")
+	}
+}
+
+func TestRenameDirResume(t *testing.T) {
+	srv := newTestServer(testRenameObjects())
+	srv.failCopy["docs/dst/sub/b.txt"] = true
+	f := testFS(t, srv)
+	if err := f.RenameDir(context.Background(), "src", "dst"); err == nil {
+		t.Fatal("expected the failed copy to fail the rename")
+	}
+	// nothing is deleted before every object was copied
+	if _, ok := srv.objects["docs/src/a.txt"]; !ok {
+		t.Fatal("expected the sources to be kept")
+	}
+	if journals := renameJournals(t, f); len(journals) != 1 {
+		t.Fatalf("expected the journal to be kept, got %v", journals)
+	}
+	srv.failCopy = map[string]bool{}
+	if err := f.ResumeRenameDirs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"docs/dst/a.txt", "docs/dst/sub/b.txt", "docs/srcx/c.txt"}
+	if keys := srv.keys(); !slices.Equal(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	if n := srv.copies["docs/dst/a.txt"]; n != 1 {
+		t.Fatalf("expected the journaled copy not to be repeated, got %d copies", n)
+	}
+	if journals := renameJournals(t, f); len(journals) != 0 {
+		t.Fatalf("expected the journal to be removed, got %v", journals)
+	}
+}
+
+func TestRenameDirResumeAddedObjects(t *testing.T) {
+	srv := newTestServer(testRenameObjects())
+	srv.locked["docs/src/a.txt"] = true
+	f := testFS(t, srv)
+	if err := f.RenameDir(context.Background(), "src", "dst"); err == nil {
+		t.Fatal("expected the locked source to fail the rename")
+	}
+	// an object written under the source after the listing, while the rename was interrupted
+	srv.objects["docs/src/sub/new.txt"] = testObject{data: []byte("new"), modTime: time.Now()}
+	delete(srv.locked, "docs/src/a.txt")
+	if err := f.ResumeRenameDirs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"docs/dst/a.txt", "docs/dst/sub/b.txt", "docs/dst/sub/new.txt", "docs/srcx/c.txt"}
+	if keys := srv.keys(); !slices.Equal(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	if n := srv.copies["docs/dst/a.txt"]; n != 1 {
+		t.Fatalf("expected the journaled copy not to be repeated, got %d copies", n)
+	}
+	if journals := renameJournals(t, f); len(journals) != 0 {
+		t.Fatalf("expected the journal to be removed, got %v", journals)
+	}
+}
+
+func TestRenameDirVerifyMismatch(t *testing.T) {
+	srv := newTestServer(testRenameObjects())
+	srv.corruptCopy["docs/dst/sub/b.txt"] = true
+	f := testFS(t, srv)
+	err := f.RenameDir(context.Background(), "src", "dst")
+	if err == nil || !strings.Contains(err.Error(), "size mismatch") {
+		t.Fatalf("expected the truncated copy to fail verification, got %v", err)
+	}
+	for _, key := range []string{"docs/src/a.txt", "docs/src/sub/b.txt"} {
+		if _, ok := srv.objects[key]; !ok {
+			t.Fatalf("expected %s to be kept", key)
+		}
+	}
+}
+
+func TestRenameDirPartialDelete(t *testing.T) {
+	srv := newTestServer(testRenameObjects())
+	srv.locked["docs/src/a.txt"] = true
+	f := testFS(t, srv)
+	err := f.RenameDir(context.Background(), "src", "dst")
+	if err == nil || !strings.Contains(err.Error(), "docs/src/a.txt") {
+		t.Fatalf("expected the source left behind to be reported, got %v", err)
+	}
+	journals := renameJournals(t, f)
+	if len(journals) != 1 {
+		t.Fatalf("expected the journal to be kept, got %v", journals)
+	}
+	journal, err := readRenameJournal(journals[0])
+	if err != nil || journal.Phase != RenameDeleting {
+		t.Fatalf("expected the journal to be deleting, got %+v %v", journal, err)
+	}
+	delete(srv.locked, "docs/src/a.txt")
+	if err := f.ResumeRenameDirs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"docs/dst/a.txt", "docs/dst/sub/b.txt", "docs/srcx/c.txt"}
+	if keys := srv.keys(); !slices.Equal(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	if n := srv.copies["docs/dst/a.txt"]; n != 1 {
+		t.Fatalf("expected resuming the delete not to copy again, got %d copies", n)
+	}
+}
+
+// testLocalFile writes a file of size bytes under the local folder of f.
+func testLocalFile(t *testing.T, f *FS, name string, size int) (*local.FileInfo, []byte) {
+	t.Helper()
+	data := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+	path := filepath.Join(f.local, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return local.NewFileInfo(fi, local.WithPath(path)), data
+}
+
+func TestResumeUploads(t *testing.T) {
+	srv := newTestServer(nil)
+	srv.failPart[2] = true
+	f := testFS(t, srv, WithMultipart(1, MinPartSize, 1))
+	file, data := testLocalFile(t, f, "big.bin", MinPartSize+MinPartSize/2)
+	ctx := context.Background()
+	if err := f.UploadFile(ctx, file); err == nil {
+		t.Fatal("expected the refused part to fail the upload")
+	}
+	cps, err := f.UploadCheckpoints()
+	if err != nil || len(cps) != 1 || cps[0].ObjectKey != "docs/big.bin" || cps[0].FilePath != file.Path() {
+		t.Fatalf("expected the checkpoint of the interrupted upload, got %+v %v", cps, err)
+	}
+	if err := f.ResumeUploads(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(srv.objects["docs/big.bin"].data, data) {
+		t.Fatal("expected the resumed upload to complete the object")
+	}
+	// the first part was kept from the interrupted upload
+	if len(srv.uploads) != 0 || len(srv.aborted) != 0 {
+		t.Fatalf("expected the upload to be resumed rather than started again, got %d in progress, %v aborted", len(srv.uploads), srv.aborted)
+	}
+	if cps, _ := f.UploadCheckpoints(); len(cps) != 0 {
+		t.Fatalf("expected the checkpoint to be removed, got %+v", cps)
+	}
+}
+
+func TestResumeUploadsDiscard(t *testing.T) {
+	srv := newTestServer(nil)
+	srv.failPart[2] = true
+	f := testFS(t, srv, WithMultipart(1, MinPartSize, 1))
+	file, _ := testLocalFile(t, f, "big.bin", 2*MinPartSize)
+	ctx := context.Background()
+	if err := f.UploadFile(ctx, file); err == nil {
+		t.Fatal("expected the refused part to fail the upload")
+	}
+	// the remote file was replaced by a newer one meanwhile, the local file isn't uploaded over it
+	srv.objects["docs/big.bin"] = testObject{data: []byte("newer"), modTime: time.Now().Add(time.Hour).Truncate(time.Second)}
+	if err := f.ResumeUploads(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.aborted) != 1 || len(srv.uploads) != 0 {
+		t.Fatalf("expected the skipped upload to be aborted, got %v aborted, %d in progress", srv.aborted, len(srv.uploads))
+	}
+	if cps, _ := f.UploadCheckpoints(); len(cps) != 0 {
+		t.Fatalf("expected the checkpoint of the skipped upload to be removed, got %+v", cps)
+	}
+
+	// the checkpoint of a file removed locally is discarded too
+	srv.failPart[2] = true
+	delete(srv.objects, "docs/big.bin")
+	if err := f.UploadFile(ctx, file); err == nil {
+		t.Fatal("expected the refused part to fail the upload")
+	}
+	if err := os.Remove(file.Path()); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.ResumeUploads(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.aborted) != 2 || len(srv.uploads) != 0 {
+		t.Fatalf("expected the upload of the removed file to be aborted, got %v aborted, %d in progress", srv.aborted, len(srv.uploads))
+	}
+	if cps, _ := f.UploadCheckpoints(); len(cps) != 0 {
+		t.Fatalf("expected the checkpoint of the removed file to be removed, got %+v", cps)
+	}
+}
+
+func TestAbortOrphanedUploads(t *testing.T) {
+	srv := newTestServer(nil)
+	srv.failPart[2] = true
+	f := testFS(t, srv, WithMultipart(1, MinPartSize, 1))
+	file, _ := testLocalFile(t, f, "big.bin", 2*MinPartSize)
+	ctx := context.Background()
+	// an upload with a checkpoint, it is resumed rather than aborted
+	if err := f.UploadFile(ctx, file); err == nil {
+		t.Fatal("expected the refused part to fail the upload")
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	srv.uploads["orphaned"] = &testUpload{key: "docs/gone.bin", parts: map[int][]byte{}, initiated: old}
+	srv.uploads["recent"] = &testUpload{key: "docs/new.bin", parts: map[int][]byte{}, initiated: time.Now()}
+	for _, upload := range srv.uploads {
+		if upload.key == "docs/big.bin" {
+			upload.initiated = old
+		}
+	}
+	keys, err := f.AbortOrphanedUploads(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, []string{"docs/gone.bin"}) || !slices.Equal(srv.aborted, []string{"orphaned"}) {
+		t.Fatalf("expected only the old upload without a checkpoint to be aborted, got %v %v", keys, srv.aborted)
+	}
+}
+
+func TestWithMultipartMinPartSize(t *testing.T) {
+	f := NewFS(nil, WithMultipart(0, 1024, 0))
+	if f.partSize != MinPartSize {
+		t.Fatalf("expected the part size to be raised to %d, got %d", MinPartSize, f.partSize)
+	}
+}
+
+func TestProbeObjectScopedKeys(t *testing.T) {
+	f := testFS(t, newTestServer(nil))
+	for _, ret := range f.Probe(context.Background()) {
+		if ret.Err != nil {
+			t.Fatalf("expected %s to pass without bucket permissions, got %v", ret.Step, ret.Err)
+		}
+	}
+}
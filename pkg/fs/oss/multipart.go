@@ -0,0 +1,161 @@
+package oss
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	local "github.com/bububa/osssync/pkg/fs/local"
+)
+
+// UploadCheckpoint is the subset of the sdk multipart checkpoint file needed to resume or clean it up.
+type UploadCheckpoint struct {
+	FilePath  string
+	ObjectKey string
+	UploadID  string
+	path      string
+}
+
+// UploadCheckpoints lists multipart uploads of this FS which were interrupted before completion.
+func (f *FS) UploadCheckpoints() ([]UploadCheckpoint, error) {
+	matches, err := filepath.Glob(filepath.Join(f.uploadCheckpointDir(), "*.cp"))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]UploadCheckpoint, 0, len(matches))
+	for _, fn := range matches {
+		bs, err := os.ReadFile(fn)
+		if err != nil {
+			continue
+		}
+		var cp UploadCheckpoint
+		if err := json.Unmarshal(bs, &cp); err != nil {
+			continue
+		}
+		if !strings.HasPrefix(cp.ObjectKey, f.prefix) || f.uploadCheckpointPath(cp.ObjectKey) != fn {
+			continue
+		}
+		cp.path = fn
+		ret = append(ret, cp)
+	}
+	return ret, nil
+}
+
+// ResumeUploads continues multipart uploads of files under the local setting folder interrupted by a previous run.
+// Checkpoints whose local file disappeared, or which UploadFile skipped since the remote file isn't older,
+// are discarded and their upload aborted.
+func (f *FS) ResumeUploads(ctx context.Context) error {
+	cps, err := f.UploadCheckpoints()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, cp := range cps {
+		fi, err := os.Stat(cp.FilePath)
+		if err != nil {
+			if err := f.discardCheckpoint(ctx, cp); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if !strings.HasPrefix(cleanLocalPath(cp.FilePath), f.local) {
+			// started by a one-off copy, resumed when the copy is run again
+			continue
+		}
+		if err := f.UploadFile(ctx, local.NewFileInfo(fi, local.WithPath(cp.FilePath))); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// a completed upload removes its checkpoint, one left behind was skipped
+		if _, err := os.Stat(cp.path); err == nil {
+			if err := f.discardCheckpoint(ctx, cp); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// discardCheckpoint aborts the upload of cp so its parts aren't kept, then removes the checkpoint.
+func (f *FS) discardCheckpoint(ctx context.Context, cp UploadCheckpoint) error {
+	if err := f.abortUpload(ctx, cp.ObjectKey, cp.UploadID); err != nil {
+		var srvErr oss.ServiceError
+		if !errors.As(err, &srvErr) || srvErr.Code != "NoSuchUpload" {
+			return err
+		}
+	}
+	if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// AbortOrphanedUploads aborts multipart uploads under the prefix which were initiated before olderThan
+// and aren't referenced by any local checkpoint, it returns the aborted object keys.
+func (f *FS) AbortOrphanedUploads(ctx context.Context, olderThan time.Duration) ([]string, error) {
+	cps, err := f.UploadCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]struct{}, len(cps))
+	for _, cp := range cps {
+		inUse[cp.UploadID] = struct{}{}
+	}
+	var (
+		ret            []string
+		keyMarker      string
+		uploadIDMarker string
+		deadline       = time.Now().Add(-olderThan)
+	)
+	for {
+		res, err := f.clt.bucket.ListMultipartUploads(oss.Prefix(f.prefix), oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIDMarker), oss.MaxUploads(MaxKeys), oss.WithContext(ctx))
+		if err != nil {
+			return ret, err
+		}
+		for _, upload := range res.Uploads {
+			if _, ok := inUse[upload.UploadID]; ok || upload.Initiated.After(deadline) {
+				continue
+			}
+			if err := f.abortUpload(ctx, upload.Key, upload.UploadID); err != nil {
+				return ret, err
+			}
+			ret = append(ret, upload.Key)
+		}
+		if !res.IsTruncated {
+			break
+		}
+		keyMarker = res.NextKeyMarker
+		uploadIDMarker = res.NextUploadIDMarker
+	}
+	return ret, nil
+}
+
+func (f *FS) abortUpload(ctx context.Context, key string, uploadID string) error {
+	if uploadID == "" {
+		return nil
+	}
+	return f.clt.bucket.AbortMultipartUpload(oss.InitiateMultipartUploadResult{
+		Bucket:   f.clt.bucket.BucketName,
+		Key:      key,
+		UploadID: uploadID,
+	}, oss.WithContext(ctx))
+}
+
+func (f *FS) uploadCheckpointDir() string {
+	return filepath.Join(f.stateDir, "upload")
+}
+
+func (f *FS) uploadCheckpointPath(remotePath string) string {
+	enc := md5.New()
+	enc.Write([]byte(f.clt.bucket.BucketName))
+	enc.Write([]byte(remotePath))
+	return filepath.Join(f.uploadCheckpointDir(), hex.EncodeToString(enc.Sum(nil))+".cp")
+}
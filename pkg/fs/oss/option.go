@@ -23,3 +23,27 @@ func WithIgnoreHidden(ignore bool) Option {
 		fs.ignoreHidden = ignore
 	}
 }
+
+// WithStateDir sets the directory used to persist journals, it should live outside of the synced tree.
+func WithStateDir(dir string) Option {
+	return func(fs *FS) {
+		fs.stateDir = dir
+	}
+}
+
+// WithMultipart sets the file size from which uploads switch to resumable multipart uploads,
+// the part size and the number of parts uploaded concurrently, zero values keep the defaults.
+// Part sizes below MinPartSize are raised to it.
+func WithMultipart(threshold int64, partSize int64, routines int) Option {
+	return func(fs *FS) {
+		if threshold > 0 {
+			fs.multipartThreshold = threshold
+		}
+		if partSize > 0 {
+			fs.partSize = max(partSize, MinPartSize)
+		}
+		if routines > 0 {
+			fs.routines = routines
+		}
+	}
+}
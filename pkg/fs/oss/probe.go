@@ -0,0 +1,58 @@
+package oss
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+type ProbeStep string
+
+const (
+	ProbeBucket ProbeStep = "bucket"
+	ProbeList   ProbeStep = "list"
+	ProbePut    ProbeStep = "put"
+	ProbeDelete ProbeStep = "delete"
+)
+
+var ErrProbeSkipped = errors.New("skipped, previous step failed")
+
+type ProbeResult struct {
+	Step ProbeStep
+	Err  error
+}
+
+// Probe checks the credentials can reach the bucket, list the prefix and put and delete a probe object under it.
+func (f *FS) Probe(ctx context.Context) []ProbeResult {
+	ret := make([]ProbeResult, 0, 4)
+	err := f.headBucket(ctx)
+	ret = append(ret, ProbeResult{Step: ProbeBucket, Err: err})
+	_, err = f.clt.bucket.ListObjectsV2(oss.Prefix(clearDirPath(f.prefix)), oss.MaxKeys(1), oss.WithContext(ctx))
+	ret = append(ret, ProbeResult{Step: ProbeList, Err: err})
+	bs := make([]byte, 8)
+	rand.Read(bs)
+	key := filepath.ToSlash(filepath.Join(f.prefix, ".osssync-probe-"+hex.EncodeToString(bs)))
+	err = f.clt.bucket.PutObject(key, strings.NewReader("osssync probe"), oss.WithContext(ctx))
+	ret = append(ret, ProbeResult{Step: ProbePut, Err: err})
+	if err != nil {
+		return append(ret, ProbeResult{Step: ProbeDelete, Err: ErrProbeSkipped})
+	}
+	err = f.clt.bucket.DeleteObject(key, oss.WithContext(ctx))
+	return append(ret, ProbeResult{Step: ProbeDelete, Err: err})
+}
+
+// headBucket sends a HEAD request to the bucket. Unlike GetBucketInfo it needs no bucket permission,
+// so keys scoped to object operations pass.
+func (f *FS) headBucket(ctx context.Context) error {
+	resp, err := f.clt.clt.Conn.DoWithContext(ctx, http.MethodHead, f.clt.bucket.BucketName, "", map[string]interface{}{}, nil, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
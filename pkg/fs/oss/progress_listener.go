@@ -4,8 +4,12 @@ import (
 	"fmt"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"github.com/bububa/osssync/pkg/queue"
 )
 
+const ProgressQueueSize = 10000
+
 type Op int
 
 const (
@@ -83,7 +87,7 @@ func (e ProgressEvent) String() string {
 
 // 定义进度条监听器。
 type ProgressListener struct {
-	ch   chan<- ProgressEvent
+	ch   *queue.Ring[ProgressEvent]
 	src  string
 	dist string
 	op   Op
@@ -109,7 +113,7 @@ func WithProgressOp(op Op) listenerOpt {
 	}
 }
 
-func NewProgressListener(ch chan<- ProgressEvent, opts ...listenerOpt) *ProgressListener {
+func NewProgressListener(ch *queue.Ring[ProgressEvent], opts ...listenerOpt) *ProgressListener {
 	ret := &ProgressListener{
 		ch: ch,
 	}
@@ -119,24 +123,23 @@ func NewProgressListener(ch chan<- ProgressEvent, opts ...listenerOpt) *Progress
 	return ret
 }
 
-// 定义进度变更事件处理函数。
+// 定义进度变更事件处理函数。不会阻塞，队列满时丢弃最旧的事件。
 func (listener *ProgressListener) ProgressChanged(event *oss.ProgressEvent) {
-	listener.ch <- ProgressEvent{
+	listener.ch.Push(ProgressEvent{
 		ProgressEvent: *event,
 		Op:            listener.op,
 		Src:           listener.src,
 		Dist:          listener.dist,
-	}
+	})
 }
 
 type MultiProgressListener struct {
-	ch chan ProgressEvent
+	ch *queue.Ring[ProgressEvent]
 }
 
 func NewMultiProgressListener() *MultiProgressListener {
-	ch := make(chan ProgressEvent, 10000)
 	return &MultiProgressListener{
-		ch: ch,
+		ch: queue.NewRing[ProgressEvent](ProgressQueueSize),
 	}
 }
 
@@ -157,9 +160,14 @@ func (listener *MultiProgressListener) RemoveListener(src string) oss.ProgressLi
 }
 
 func (listener *MultiProgressListener) Events() <-chan ProgressEvent {
-	return listener.ch
+	return listener.ch.C()
+}
+
+// Dropped is the number of progress events discarded because nobody drained Events in time.
+func (listener *MultiProgressListener) Dropped() uint64 {
+	return listener.ch.Dropped()
 }
 
 func (listener *MultiProgressListener) Close() {
-	close(listener.ch)
+	listener.ch.Close()
 }
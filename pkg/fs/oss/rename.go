@@ -0,0 +1,293 @@
+package oss
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alitto/pond/v2"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// RenamePhase is the step a directory rename reached before it was interrupted.
+type RenamePhase string
+
+const (
+	RenameCopying  RenamePhase = "copying"
+	RenameDeleting RenamePhase = "deleting"
+)
+
+// RenameEntry is a single object moved by a directory rename.
+type RenameEntry struct {
+	Src    string `json:"src"`
+	Dist   string `json:"dist"`
+	Copied bool   `json:"copied,omitempty"`
+}
+
+// RenameJournal records the progress of a directory rename so it can be resumed.
+type RenameJournal struct {
+	Src     string         `json:"src"`
+	Dist    string         `json:"dist"`
+	Phase   RenamePhase    `json:"phase"`
+	Entries []*RenameEntry `json:"entries"`
+	path    string
+	mu      sync.Mutex
+}
+
+func (j *RenameJournal) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	bs, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+func (j *RenameJournal) markCopied(entry *RenameEntry) error {
+	j.mu.Lock()
+	entry.Copied = true
+	j.mu.Unlock()
+	return j.save()
+}
+
+func (j *RenameJournal) remove() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RenameDir moves every object under src to dist, keeping paths relative to src.
+// Objects are copied in parallel and verified, sources are only deleted after every copy succeeded.
+// Progress is journaled under the state dir, calling RenameDir again with the same arguments resumes an interrupted rename.
+func (f *FS) RenameDir(ctx context.Context, src string, dist string) error {
+	src = clearDirPath(f.PathAddPrefix(src))
+	dist = clearDirPath(f.PathAddPrefix(dist))
+	if src == dist {
+		return nil
+	}
+	if strings.HasPrefix(dist, src) {
+		return fmt.Errorf("can't move %s into its own subdirectory %s", src, dist)
+	}
+	journal, err := f.loadRenameJournal(src, dist)
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		if journal, err = f.newRenameJournal(ctx, src, dist); err != nil {
+			return err
+		}
+	} else if err := f.relistRenameJournal(ctx, journal); err != nil {
+		return err
+	}
+	return f.runRenameJournal(ctx, journal)
+}
+
+// ResumeRenameDirs finishes directory renames interrupted before they completed.
+func (f *FS) ResumeRenameDirs(ctx context.Context) error {
+	matches, err := filepath.Glob(filepath.Join(f.renameJournalDir(), "*.json"))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, fn := range matches {
+		journal, err := readRenameJournal(fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !strings.HasPrefix(journal.Src, f.prefix) || f.renameJournalPath(journal.Src, journal.Dist) != fn {
+			continue
+		}
+		if err := f.relistRenameJournal(ctx, journal); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := f.runRenameJournal(ctx, journal); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FS) newRenameJournal(ctx context.Context, src string, dist string) (*RenameJournal, error) {
+	list, err := f.clt.list(ctx, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	journal := &RenameJournal{
+		Src:     src,
+		Dist:    dist,
+		Phase:   RenameCopying,
+		Entries: make([]*RenameEntry, 0, len(list)),
+		path:    f.renameJournalPath(src, dist),
+	}
+	for _, v := range list {
+		journal.Entries = append(journal.Entries, &RenameEntry{
+			Src:  v.Key,
+			Dist: dist + strings.TrimPrefix(v.Key, src),
+		})
+	}
+	if err := os.MkdirAll(filepath.Dir(journal.path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := journal.save(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// relistRenameJournal lists the source prefix of a resumed rename again and journals the objects added
+// under it since the rename started, so they move along instead of being left behind.
+func (f *FS) relistRenameJournal(ctx context.Context, journal *RenameJournal) error {
+	list, err := f.clt.list(ctx, journal.Src, nil)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]struct{}, len(journal.Entries))
+	for _, entry := range journal.Entries {
+		known[entry.Src] = struct{}{}
+	}
+	var added bool
+	for _, v := range list {
+		if _, ok := known[v.Key]; ok {
+			continue
+		}
+		journal.Entries = append(journal.Entries, &RenameEntry{
+			Src:  v.Key,
+			Dist: journal.Dist + strings.TrimPrefix(v.Key, journal.Src),
+		})
+		added = true
+	}
+	if !added {
+		return nil
+	}
+	// the new objects have to be copied before any source is deleted
+	journal.Phase = RenameCopying
+	return journal.save()
+}
+
+func (f *FS) runRenameJournal(ctx context.Context, journal *RenameJournal) error {
+	if journal.Phase == RenameCopying {
+		pool := pond.NewPool(CopyRoutines, pond.WithContext(ctx))
+		defer pool.StopAndWait()
+		group := pool.NewGroup()
+		for _, entry := range journal.Entries {
+			if entry.Copied {
+				continue
+			}
+			group.SubmitErr(func() error {
+				if err := f.copyAndVerify(ctx, entry); err != nil {
+					return err
+				}
+				return journal.markCopied(entry)
+			})
+		}
+		if err := group.Wait(); err != nil {
+			return err
+		}
+		journal.Phase = RenameDeleting
+		if err := journal.save(); err != nil {
+			return err
+		}
+	}
+	var (
+		keys   = make([]string, 0, MaxDeleteKeys)
+		failed []string
+	)
+	for idx, entry := range journal.Entries {
+		keys = append(keys, entry.Src)
+		if len(keys) < MaxDeleteKeys && idx < len(journal.Entries)-1 {
+			continue
+		}
+		deleted, err := f.Remove(ctx, keys...)
+		if err != nil {
+			return err
+		}
+		// a partial delete isn't an error, the keys missing from the result weren't deleted
+		mp := make(map[string]struct{}, len(deleted))
+		for _, v := range deleted {
+			mp[v] = struct{}{}
+		}
+		for _, v := range keys {
+			if _, ok := mp[f.PathAddPrefix(v)]; !ok {
+				failed = append(failed, v)
+			}
+		}
+		keys = keys[:0]
+	}
+	if len(failed) > 0 {
+		// the journal is kept so the next run deletes them
+		return fmt.Errorf("rename: %d sources not deleted: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return journal.remove()
+}
+
+func (f *FS) copyAndVerify(ctx context.Context, entry *RenameEntry) error {
+	srcHeader, err := f.clt.bucket.GetObjectMeta(entry.Src, oss.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if _, err := f.clt.bucket.CopyObject(entry.Src, entry.Dist, oss.Progress(f.listener.CopyListener(entry.Src, entry.Dist)), oss.WithContext(ctx)); err != nil {
+		return err
+	}
+	distHeader, err := f.clt.bucket.GetObjectMeta(entry.Dist, oss.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if expected, got := srcHeader.Get("Content-Length"), distHeader.Get("Content-Length"); expected != got {
+		return fmt.Errorf("verify %s failed, size mismatch, expected:%s, got:%s", entry.Dist, expected, got)
+	}
+	if expected, got := srcHeader.Get(oss.HTTPHeaderOssCRC64), distHeader.Get(oss.HTTPHeaderOssCRC64); expected != "" && got != "" && expected != got {
+		return fmt.Errorf("verify %s failed, crc64 mismatch, expected:%s, got:%s", entry.Dist, expected, got)
+	}
+	return nil
+}
+
+func (f *FS) loadRenameJournal(src string, dist string) (*RenameJournal, error) {
+	journal, err := readRenameJournal(f.renameJournalPath(src, dist))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return journal, nil
+}
+
+func readRenameJournal(fn string) (*RenameJournal, error) {
+	bs, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	journal := new(RenameJournal)
+	if err := json.Unmarshal(bs, journal); err != nil {
+		return nil, err
+	}
+	journal.path = fn
+	return journal, nil
+}
+
+func (f *FS) renameJournalDir() string {
+	return filepath.Join(f.stateDir, "rename")
+}
+
+func (f *FS) renameJournalPath(src string, dist string) string {
+	enc := md5.New()
+	enc.Write([]byte(f.clt.bucket.BucketName))
+	enc.Write([]byte(src))
+	enc.Write([]byte(dist))
+	return filepath.Join(f.renameJournalDir(), hex.EncodeToString(enc.Sum(nil))+".json")
+}
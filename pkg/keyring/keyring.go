@@ -0,0 +1,34 @@
+// Package keyring keeps secrets in the secret store of the platform: the Secret Service (gnome-keyring,
+// KWallet, KeePassXC) over D-Bus on linux, the login Keychain on macOS and the Credential Manager on windows.
+// A secret is identified by a service and an account name.
+package keyring
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by Get and Delete when there is no secret for the service and account.
+	ErrNotFound = errors.New("secret not found in keyring")
+	// ErrUnsupported is returned when the platform has no secret store osssync can use.
+	ErrUnsupported = errors.New("keyring not supported on this platform")
+)
+
+// Set stores secret for service and account, replacing the previous one.
+func Set(service, account, secret string) error {
+	return set(service, account, secret)
+}
+
+// Get returns the secret of service and account.
+func Get(service, account string) (string, error) {
+	return get(service, account)
+}
+
+// Available reports whether the secret store of the platform can be reached, a linux desktop may run
+// without a Secret Service.
+func Available() bool {
+	return available()
+}
+
+// Delete removes the secret of service and account.
+func Delete(service, account string) error {
+	return del(service, account)
+}
@@ -0,0 +1,60 @@
+//go:build darwin
+
+package keyring
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const securityCmd = "/usr/bin/security"
+
+// errSecItemNotFound is the exit code of security when the item doesn't exist.
+const errSecItemNotFound = 44
+
+func available() bool {
+	_, err := os.Stat(securityCmd)
+	return err == nil
+}
+
+func set(service, account, secret string) error {
+	// go through the interactive mode so the secret never shows up in the process list
+	cmd := exec.Command(securityCmd, "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", quote(service), quote(account), hex.EncodeToString([]byte(secret))))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("security: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func get(service, account string) (string, error) {
+	out, err := exec.Command(securityCmd, "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func del(service, account string) error {
+	if err := exec.Command(securityCmd, "delete-generic-password", "-s", service, "-a", account).Run(); err != nil {
+		return securityError(err)
+	}
+	return nil
+}
+
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("security: %w", err)
+}
+
+// quote escapes a value for the command line read by security -i.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,225 @@
+//go:build linux
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// the Secret Service API, see https://specifications.freedesktop.org/secret-service/
+const (
+	secretServiceName      = "org.freedesktop.secrets"
+	secretServicePath      = "/org/freedesktop/secrets"
+	secretServiceInterface = "org.freedesktop.Secret.Service"
+	collectionInterface    = "org.freedesktop.Secret.Collection"
+	itemInterface          = "org.freedesktop.Secret.Item"
+	sessionInterface       = "org.freedesktop.Secret.Session"
+	promptInterface        = "org.freedesktop.Secret.Prompt"
+	// loginCollection is used when no collection is aliased as default
+	loginCollection = "/org/freedesktop/secrets/collection/login"
+)
+
+// PromptTimeout bounds waiting for the user to answer a prompt, e.g. to unlock the keyring, so loading
+// the config of a daemon started without anyone at the desktop fails rather than hanging.
+var PromptTimeout = 2 * time.Minute
+
+// noPrompt is the object path returned when an operation needs no user interaction.
+const noPrompt = dbus.ObjectPath("/")
+
+// secret is the Secret struct of the API, sent and received as (oayays).
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+type secretService struct {
+	conn    *dbus.Conn
+	obj     dbus.BusObject
+	session dbus.ObjectPath
+}
+
+// openSecretService connects to the session bus and opens a plain session, secrets only travel over the local bus.
+func openSecretService() (*secretService, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+	s := &secretService{
+		conn: conn,
+		obj:  conn.Object(secretServiceName, secretServicePath),
+	}
+	var output dbus.Variant
+	if err := s.obj.Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &s.session); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("secret service: %w", err)
+	}
+	return s, nil
+}
+
+func available() bool {
+	s, err := openSecretService()
+	if err != nil {
+		return false
+	}
+	s.close()
+	return true
+}
+
+func (s *secretService) close() {
+	s.conn.Object(secretServiceName, s.session).Call(sessionInterface+".Close", 0)
+	s.conn.Close()
+}
+
+// collection is the default collection, unlocked.
+func (s *secretService) collection() (dbus.ObjectPath, error) {
+	var path dbus.ObjectPath
+	if err := s.obj.Call(secretServiceInterface+".ReadAlias", 0, "default").Store(&path); err != nil {
+		return "", fmt.Errorf("secret service: %w", err)
+	}
+	if path == noPrompt {
+		path = loginCollection
+	}
+	return path, s.unlock(path)
+}
+
+func (s *secretService) unlock(paths ...dbus.ObjectPath) error {
+	var (
+		unlocked []dbus.ObjectPath
+		prompt   dbus.ObjectPath
+	)
+	if err := s.obj.Call(secretServiceInterface+".Unlock", 0, paths).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("secret service: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+// prompt shows the prompt of an operation, e.g. for the keyring password, and waits for the user.
+func (s *secretService) prompt(path dbus.ObjectPath) error {
+	if path == noPrompt {
+		return nil
+	}
+	if err := s.conn.AddMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(promptInterface), dbus.WithMatchMember("Completed")); err != nil {
+		return fmt.Errorf("secret service: %w", err)
+	}
+	defer s.conn.RemoveMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(promptInterface), dbus.WithMatchMember("Completed"))
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+	if err := s.conn.Object(secretServiceName, path).Call(promptInterface+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("secret service: %w", err)
+	}
+	timeout := time.NewTimer(PromptTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				return errors.New("secret service: connection closed")
+			}
+			if sig.Path != path || sig.Name != promptInterface+".Completed" || len(sig.Body) == 0 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return errors.New("secret service: prompt dismissed")
+			}
+			return nil
+		case <-timeout.C:
+			s.conn.Object(secretServiceName, path).Go(promptInterface+".Dismiss", dbus.FlagNoReplyExpected, nil)
+			return fmt.Errorf("secret service: prompt not answered within %s", PromptTimeout)
+		}
+	}
+}
+
+func attributes(service, account string) map[string]string {
+	return map[string]string{
+		"service":  service,
+		"username": account,
+	}
+}
+
+// search returns the items of service and account, unlocked.
+func (s *secretService) search(service, account string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := s.obj.Call(secretServiceInterface+".SearchItems", 0, attributes(service, account)).Store(&unlocked, &locked); err != nil {
+		return nil, fmt.Errorf("secret service: %w", err)
+	}
+	if len(locked) > 0 {
+		if err := s.unlock(locked...); err != nil {
+			return nil, err
+		}
+	}
+	return append(unlocked, locked...), nil
+}
+
+func set(service, account, value string) error {
+	s, err := openSecretService()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	collection, err := s.collection()
+	if err != nil {
+		return err
+	}
+	props := map[string]dbus.Variant{
+		itemInterface + ".Label":      dbus.MakeVariant(fmt.Sprintf("%s %s", service, account)),
+		itemInterface + ".Attributes": dbus.MakeVariant(attributes(service, account)),
+	}
+	sec := secret{Session: s.session, Value: []byte(value), ContentType: "text/plain; charset=utf8"}
+	var item, prompt dbus.ObjectPath
+	if err := s.conn.Object(secretServiceName, collection).Call(collectionInterface+".CreateItem", 0, props, sec, true).Store(&item, &prompt); err != nil {
+		return fmt.Errorf("secret service: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+func get(service, account string) (string, error) {
+	s, err := openSecretService()
+	if err != nil {
+		return "", err
+	}
+	defer s.close()
+	items, err := s.search(service, account)
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", ErrNotFound
+	}
+	var sec secret
+	if err := s.conn.Object(secretServiceName, items[0]).Call(itemInterface+".GetSecret", 0, s.session).Store(&sec); err != nil {
+		return "", fmt.Errorf("secret service: %w", err)
+	}
+	return string(sec.Value), nil
+}
+
+func del(service, account string) error {
+	s, err := openSecretService()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	items, err := s.search(service, account)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return ErrNotFound
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := s.conn.Object(secretServiceName, item).Call(itemInterface+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("secret service: %w", err)
+		}
+		if err := s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+//go:build linux
+
+package keyring
+
+import (
+	"bufio"
+	"errors"
+	"maps"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeSecretService is a minimal org.freedesktop.secrets keeping items in memory.
+type fakeSecretService struct {
+	conn *dbus.Conn
+	mu   sync.Mutex
+	// locked makes Unlock return a prompt which is never answered
+	locked bool
+	items  map[dbus.ObjectPath]*fakeItem
+	n      int
+}
+
+type fakeItem struct {
+	svc   *fakeSecretService
+	path  dbus.ObjectPath
+	attrs map[string]string
+	value []byte
+}
+
+const (
+	fakeCollection = dbus.ObjectPath("/org/freedesktop/secrets/collection/default")
+	fakeSession    = dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+	fakePrompt     = dbus.ObjectPath("/org/freedesktop/secrets/prompt/1")
+)
+
+func (f *fakeSecretService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	return dbus.MakeVariant(""), fakeSession, nil
+}
+
+func (f *fakeSecretService) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	return fakeCollection, nil
+}
+
+func (f *fakeSecretService) Unlock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.locked {
+		return nil, fakePrompt, nil
+	}
+	return paths, noPrompt, nil
+}
+
+func (f *fakeSecretService) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ret []dbus.ObjectPath
+	for path, item := range f.items {
+		if matches(item.attrs, attrs) {
+			ret = append(ret, path)
+		}
+	}
+	return ret, []dbus.ObjectPath{}, nil
+}
+
+func matches(attrs, query map[string]string) bool {
+	for k, v := range query {
+		if attrs[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeCollectionObj is the default collection.
+type fakeCollectionObj struct {
+	svc *fakeSecretService
+}
+
+func (c fakeCollectionObj) CreateItem(props map[string]dbus.Variant, sec secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	f := c.svc
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attrs, _ := props[itemInterface+".Attributes"].Value().(map[string]string)
+	for path, item := range f.items {
+		if replace && maps.Equal(item.attrs, attrs) {
+			item.value = sec.Value
+			return path, noPrompt, nil
+		}
+	}
+	f.n++
+	path := dbus.ObjectPath(string(fakeCollection) + "/" + strconv.Itoa(f.n))
+	item := &fakeItem{svc: f, path: path, attrs: attrs, value: sec.Value}
+	f.items[path] = item
+	f.conn.Export(item, path, itemInterface)
+	return path, noPrompt, nil
+}
+
+func (i *fakeItem) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	i.svc.mu.Lock()
+	defer i.svc.mu.Unlock()
+	return secret{Session: session, Value: i.value, ContentType: "text/plain"}, nil
+}
+
+func (i *fakeItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.svc.mu.Lock()
+	defer i.svc.mu.Unlock()
+	delete(i.svc.items, i.path)
+	i.svc.conn.Export(nil, i.path, itemInterface)
+	return noPrompt, nil
+}
+
+type fakeSessionObj struct{}
+
+func (fakeSessionObj) Close() *dbus.Error {
+	return nil
+}
+
+// fakePromptObj never completes, like a prompt nobody answers.
+type fakePromptObj struct{}
+
+func (fakePromptObj) Prompt(windowID string) *dbus.Error {
+	return nil
+}
+
+func (fakePromptObj) Dismiss() *dbus.Error {
+	return nil
+}
+
+// startSecretService starts a private session bus serving a fakeSecretService and points the keyring at it.
+func startSecretService(t *testing.T) *fakeSecretService {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("dbus-daemon address: %v", err)
+	}
+	addr = strings.TrimSpace(addr)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	f := &fakeSecretService{conn: conn, items: make(map[dbus.ObjectPath]*fakeItem)}
+	conn.Export(f, secretServicePath, secretServiceInterface)
+	conn.Export(fakeCollectionObj{svc: f}, fakeCollection, collectionInterface)
+	conn.Export(fakeSessionObj{}, fakeSession, sessionInterface)
+	conn.Export(fakePromptObj{}, fakePrompt, promptInterface)
+	if reply, err := conn.RequestName(secretServiceName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("request name: %v %v", reply, err)
+	}
+	return f
+}
+
+func TestSecretService(t *testing.T) {
+	startSecretService(t)
+	if _, err := Get("osssync-test", "docs"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := Set("osssync-test", "docs", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set("osssync-test", "docs", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set("osssync-test", "other", "third"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Get("osssync-test", "docs"); err != nil || got != "second" {
+		t.Fatalf("expected the replaced secret, got %q %v", got, err)
+	}
+	if err := Delete("osssync-test", "docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("osssync-test", "docs"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := Delete("osssync-test", "docs"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if got, err := Get("osssync-test", "other"); err != nil || got != "third" {
+		t.Fatalf("expected the other secret untouched, got %q %v", got, err)
+	}
+}
+
+func TestSecretServicePromptTimeout(t *testing.T) {
+	f := startSecretService(t)
+	f.mu.Lock()
+	f.locked = true
+	f.mu.Unlock()
+	timeout := PromptTimeout
+	PromptTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { PromptTimeout = timeout })
+	done := make(chan error, 1)
+	go func() {
+		done <- Set("osssync-test", "docs", "secret")
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "not answered") {
+			t.Fatalf("expected the prompt to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("unanswered prompt wasn't bounded")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !windows
+
+package keyring
+
+func available() bool {
+	return false
+}
+
+func set(service, account, secret string) error {
+	return ErrUnsupported
+}
+
+func get(service, account string) (string, error) {
+	return "", ErrUnsupported
+}
+
+func del(service, account string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,108 @@
+//go:build windows
+
+package keyring
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+var (
+	advapi32       = windows.NewLazySystemDLL("advapi32.dll")
+	procCredRead   = advapi32.NewProc("CredReadW")
+	procCredWrite  = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// credential is CREDENTIALW of wincred.h.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+func available() bool {
+	return procCredRead.Find() == nil
+}
+
+// target is the name of the generic credential, as shown by the Credential Manager.
+func target(service, account string) (*uint16, error) {
+	return windows.UTF16PtrFromString(service + ":" + account)
+}
+
+func set(service, account, secret string) error {
+	name, err := target(service, account)
+	if err != nil {
+		return err
+	}
+	user, err := windows.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         name,
+		CredentialBlobSize: uint32(len(secret)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(secret) > 0 {
+		blob := []byte(secret)
+		cred.CredentialBlob = &blob[0]
+	}
+	if ret, _, err := procCredWrite.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return err
+	}
+	return nil
+}
+
+func get(service, account string) (string, error) {
+	name, err := target(service, account)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	if ret, _, err := procCredRead.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		return "", credError(err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func del(service, account string) error {
+	name, err := target(service, account)
+	if err != nil {
+		return err
+	}
+	if ret, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0); ret == 0 {
+		return credError(err)
+	}
+	return nil
+}
+
+func credError(err error) error {
+	if errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package lockfile
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockRange returns the byte the lock is taken on. Windows locks are mandatory, so it lies far past the
+// pid text and other processes can still read the pid of the holder.
+func lockRange() *windows.Overlapped {
+	return &windows.Overlapped{Offset: ^uint32(0)}
+}
+
+func lock(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, lockRange())
+}
+
+func lockShared(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, lockRange())
+}
+
+func unlock(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, lockRange())
+}
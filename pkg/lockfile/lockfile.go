@@ -0,0 +1,106 @@
+// Package lockfile implements pid files guarded by an advisory lock, the lock is released by the OS if the process dies.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned by Acquire when another process holds the lock.
+var ErrLocked = errors.New("locked by another process")
+
+type Lock struct {
+	f *os.File
+}
+
+// Acquire locks path, waiting only for a moment, and writes the pid of this process into it.
+// If another process holds the lock the error wraps ErrLocked and names its pid.
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockRetry(f); err != nil {
+		f.Close()
+		if pid, _ := ReadPID(path); pid > 0 {
+			return nil, fmt.Errorf("%w, pid %d", ErrLocked, pid)
+		}
+		return nil, ErrLocked
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// AcquireWait is Acquire waiting up to timeout for another process to release the lock.
+func AcquireWait(path string, timeout time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		l, err := Acquire(path)
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return l, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// lockRetry retries for a moment, Probe holds a shared lock while it checks the file.
+func lockRetry(f *os.File) error {
+	var err error
+	for range 5 {
+		if err = lock(f); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return err
+}
+
+// Probe returns the pid of the process holding the lock on path, 0 if none does. Unlike Acquire it
+// doesn't create, write or remove the file, so it can't disturb a process taking the lock at the same time.
+func Probe(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+	if err := lockShared(f); err == nil {
+		unlock(f)
+		return 0, nil
+	}
+	return ReadPID(path)
+}
+
+// ReadPID returns the pid written into path, whether or not its process is still alive.
+func ReadPID(path string) (int, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(bs)))
+}
+
+// Release empties the pid file and unlocks it. The file is kept: removing it would let a process which
+// opened it before lock the removed file while another one creates and locks a new one.
+func (l *Lock) Release() error {
+	l.f.Truncate(0)
+	unlock(l.f)
+	return l.f.Close()
+}
@@ -0,0 +1,104 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "osssync.pid")
+	if pid, err := Probe(path); err != nil || pid != 0 {
+		t.Fatalf("expected no holder of a missing file, got %d %v", pid, err)
+	}
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every Acquire opens its own descriptor, so the second one conflicts with the first like another process would
+	if _, err := Acquire(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := Probe(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("expected pid %d, got %d %v", os.Getpid(), pid, err)
+	}
+	if pid, err := ReadPID(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("probe changed the pid file: %d %v", pid, err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("release removed the pid file: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Fatal("release replaced the pid file")
+	}
+	if pid, err := Probe(path); err != nil || pid != 0 {
+		t.Fatalf("expected no holder after release, got %d %v", pid, err)
+	}
+	lock, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("expected to lock again after release, got %v", err)
+	}
+	lock.Release()
+}
+
+func TestProbeDoesNotBlockAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osssync.pid")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// a probe holding its shared lock only delays Acquire for a moment
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lockShared(f); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		lock, err := Acquire(path)
+		if err == nil {
+			lock.Release()
+		}
+		done <- err
+	}()
+	unlock(f)
+	f.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("expected Acquire to succeed once the probe is done, got %v", err)
+	}
+}
+
+func TestAcquireWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.lock")
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireWait(path, 100*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked after the timeout, got %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		lock, err := AcquireWait(path, 5*time.Second)
+		if err == nil {
+			lock.Release()
+		}
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	lock.Release()
+	if err := <-done; err != nil {
+		t.Fatalf("expected AcquireWait to succeed once the lock is released, got %v", err)
+	}
+}
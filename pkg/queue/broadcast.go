@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// Broadcast fans values out to every subscriber, a slow subscriber drops its oldest values instead of blocking the others.
+type Broadcast[T any] struct {
+	subs    map[*Ring[T]]struct{}
+	size    int
+	dropped *atomic.Uint64
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// NewBroadcast creates a Broadcast whose subscribers buffer up to size values.
+func NewBroadcast[T any](size int) *Broadcast[T] {
+	return &Broadcast[T]{
+		subs:    make(map[*Ring[T]]struct{}),
+		size:    size,
+		dropped: atomic.NewUint64(0),
+	}
+}
+
+// Subscribe returns a ring receiving every value published from now on, it is closed by Unsubscribe or Close.
+func (b *Broadcast[T]) Subscribe() *Ring[T] {
+	r := NewRing[T](b.size)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		r.Close()
+		return r
+	}
+	b.subs[r] = struct{}{}
+	return r
+}
+
+func (b *Broadcast[T]) Unsubscribe(r *Ring[T]) {
+	b.mu.Lock()
+	delete(b.subs, r)
+	b.mu.Unlock()
+	r.Close()
+}
+
+func (b *Broadcast[T]) Publish(v T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for r := range b.subs {
+		_, dropped := r.push(v)
+		b.dropped.Add(dropped)
+	}
+}
+
+// Dropped is the number of values discarded by all subscribers, also those unsubscribed since.
+func (b *Broadcast[T]) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Subscribers is the number of current subscribers.
+func (b *Broadcast[T]) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+func (b *Broadcast[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for r := range b.subs {
+		r.Close()
+	}
+	b.subs = nil
+}
@@ -0,0 +1,24 @@
+package queue
+
+import "testing"
+
+func TestBroadcastDropped(t *testing.T) {
+	b := NewBroadcast[int](2)
+	slow := b.Subscribe()
+	fast := b.Subscribe()
+	for i := range 5 {
+		b.Publish(i)
+		<-fast.C()
+	}
+	if got := b.Dropped(); got != 3 {
+		t.Fatalf("expected 3 values dropped for the slow subscriber, got %d", got)
+	}
+	// the count survives the subscriber
+	b.Unsubscribe(slow)
+	if got := b.Dropped(); got != 3 {
+		t.Fatalf("expected 3 dropped after unsubscribing, got %d", got)
+	}
+	if v := <-slow.C(); v != 3 {
+		t.Fatalf("expected the oldest values dropped, got %d first", v)
+	}
+}
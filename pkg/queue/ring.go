@@ -0,0 +1,75 @@
+// Package queue implements non blocking queues so producers never wait on a stalled consumer.
+package queue
+
+import (
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// Ring is a bounded channel which drops the oldest value instead of blocking when full.
+type Ring[T any] struct {
+	ch      chan T
+	dropped *atomic.Uint64
+	mu      sync.Mutex
+	closed  bool
+}
+
+func NewRing[T any](size int) *Ring[T] {
+	return &Ring[T]{
+		ch:      make(chan T, size),
+		dropped: atomic.NewUint64(0),
+	}
+}
+
+// Push adds v, dropping the oldest value if the ring is full. It returns false once the ring is closed.
+func (r *Ring[T]) Push(v T) bool {
+	ok, _ := r.push(v)
+	return ok
+}
+
+// push is Push also returning how many values it dropped to make room for v.
+func (r *Ring[T]) push(v T) (bool, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false, 0
+	}
+	var dropped uint64
+	for {
+		select {
+		case r.ch <- v:
+			return true, dropped
+		default:
+		}
+		select {
+		case <-r.ch:
+			r.dropped.Inc()
+			dropped++
+		default:
+		}
+	}
+}
+
+func (r *Ring[T]) C() <-chan T {
+	return r.ch
+}
+
+func (r *Ring[T]) Len() int {
+	return len(r.ch)
+}
+
+// Dropped is the number of values discarded because the consumer didn't keep up.
+func (r *Ring[T]) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+func (r *Ring[T]) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	close(r.ch)
+}
@@ -0,0 +1,59 @@
+package queue
+
+import "testing"
+
+func TestRingWraparound(t *testing.T) {
+	r := NewRing[int](3)
+	// interleave pushes and reads so the buffer wraps around several times without dropping
+	for i := range 10 {
+		r.Push(i)
+		r.Push(i + 100)
+		if v := <-r.C(); v != i {
+			t.Fatalf("expected %d, got %d", i, v)
+		}
+		if v := <-r.C(); v != i+100 {
+			t.Fatalf("expected %d, got %d", i+100, v)
+		}
+	}
+	if got := r.Dropped(); got != 0 {
+		t.Fatalf("expected nothing dropped, got %d", got)
+	}
+}
+
+func TestRingDropOldest(t *testing.T) {
+	r := NewRing[int](3)
+	for i := range 5 {
+		if !r.Push(i) {
+			t.Fatalf("expected push %d to succeed", i)
+		}
+	}
+	if got := r.Dropped(); got != 2 {
+		t.Fatalf("expected 2 dropped, got %d", got)
+	}
+	if l := r.Len(); l != 3 {
+		t.Fatalf("expected 3 values, got %d", l)
+	}
+	for _, want := range []int{2, 3, 4} {
+		if v := <-r.C(); v != want {
+			t.Fatalf("expected %d, got %d", want, v)
+		}
+	}
+}
+
+func TestRingClose(t *testing.T) {
+	r := NewRing[int](2)
+	r.Push(1)
+	r.Close()
+	// closing twice is a no-op
+	r.Close()
+	if r.Push(2) {
+		t.Fatal("expected push after close to fail")
+	}
+	// values pushed before closing are still delivered
+	if v, ok := <-r.C(); !ok || v != 1 {
+		t.Fatalf("expected 1 before the end of the ring, got %d %v", v, ok)
+	}
+	if _, ok := <-r.C(); ok {
+		t.Fatal("expected the channel closed")
+	}
+}
@@ -0,0 +1,263 @@
+// Package scheduler implements a bounded task scheduler shared by several groups.
+// Groups are served in proportion to their weight (stride scheduling), inside a group
+// tasks run by priority first, then smallest size first, then submission order.
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+)
+
+const DefaultLimit = 10
+
+var ErrClosed = errors.New("scheduler closed")
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+	PriorityUrgent
+)
+
+type Task struct {
+	// Group is the key tasks are fairly shared by, usually the setting key
+	Group    string
+	Priority Priority
+	// Size is used to run small tasks first inside the same priority
+	Size int64
+	Run  func(ctx context.Context) error
+}
+
+type GroupStats struct {
+	Pending int
+	Running int
+}
+
+type job struct {
+	Task
+	ctx  context.Context
+	done chan error
+	seq  uint64
+}
+
+type jobHeap []*job
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].Priority != h[j].Priority {
+		return h[i].Priority > h[j].Priority
+	}
+	if h[i].Size != h[j].Size {
+		return h[i].Size < h[j].Size
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x any) { *h = append(*h, x.(*job)) }
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+type group struct {
+	jobs    jobHeap
+	weight  int
+	pass    float64
+	running int
+}
+
+func (g *group) stride() float64 {
+	if g.weight <= 0 {
+		return 1
+	}
+	return 1 / float64(g.weight)
+}
+
+type Scheduler struct {
+	mu      sync.Mutex
+	groups  map[string]*group
+	weights map[string]int
+	limit   int
+	running int
+	seq     uint64
+	pass    float64
+	closed  bool
+}
+
+func New(limit int) *Scheduler {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Scheduler{
+		groups:  make(map[string]*group),
+		weights: make(map[string]int),
+		limit:   limit,
+	}
+}
+
+// SetLimit changes the maximum number of tasks running at the same time.
+func (s *Scheduler) SetLimit(limit int) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	s.mu.Lock()
+	s.limit = limit
+	s.dispatch()
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// SetWeight sets the share of the group, a group with weight 2 runs twice as many tasks as a group with weight 1.
+func (s *Scheduler) SetWeight(name string, weight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weights[name] = weight
+	if g, ok := s.groups[name]; ok {
+		g.weight = weight
+	}
+}
+
+// Submit queues a task, the returned channel receives the task result.
+func (s *Scheduler) Submit(ctx context.Context, task Task) <-chan error {
+	done := make(chan error, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		done <- ErrClosed
+		return done
+	}
+	g, ok := s.groups[task.Group]
+	if !ok {
+		g = &group{weight: s.weights[task.Group]}
+		s.groups[task.Group] = g
+	}
+	if len(g.jobs) == 0 && g.running == 0 && g.pass < s.pass {
+		g.pass = s.pass
+	}
+	s.seq++
+	heap.Push(&g.jobs, &job{Task: task, ctx: ctx, done: done, seq: s.seq})
+	s.dispatch()
+	return done
+}
+
+// dispatch starts queued tasks until the limit is reached, s.mu must be held.
+func (s *Scheduler) dispatch() {
+	for s.running < s.limit {
+		name, g := s.next()
+		if g == nil {
+			return
+		}
+		j := heap.Pop(&g.jobs).(*job)
+		s.pass = g.pass
+		g.pass += g.stride()
+		g.running++
+		s.running++
+		go s.run(name, g, j)
+	}
+}
+
+func (s *Scheduler) next() (string, *group) {
+	var (
+		name string
+		ret  *group
+	)
+	for k, g := range s.groups {
+		if len(g.jobs) == 0 {
+			continue
+		}
+		if ret == nil || g.pass < ret.pass || (g.pass == ret.pass && k < name) {
+			name = k
+			ret = g
+		}
+	}
+	return name, ret
+}
+
+func (s *Scheduler) run(name string, g *group, j *job) {
+	var err error
+	if err = j.ctx.Err(); err == nil {
+		err = j.Run(j.ctx)
+	}
+	j.done <- err
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g.running--
+	s.running--
+	if len(g.jobs) == 0 && g.running == 0 {
+		delete(s.groups, name)
+	}
+	s.dispatch()
+}
+
+// Stats returns pending and running task counts by group.
+func (s *Scheduler) Stats() map[string]GroupStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make(map[string]GroupStats, len(s.groups))
+	for k, g := range s.groups {
+		ret[k] = GroupStats{Pending: len(g.jobs), Running: g.running}
+	}
+	return ret
+}
+
+// Close rejects new tasks and fails the queued ones, running tasks aren't interrupted.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, g := range s.groups {
+		for _, j := range g.jobs {
+			j.done <- ErrClosed
+		}
+		g.jobs = nil
+	}
+}
+
+// Batch waits for a set of tasks submitted together.
+type Batch struct {
+	s     *Scheduler
+	ctx   context.Context
+	mu    sync.Mutex
+	dones []<-chan error
+}
+
+func (s *Scheduler) NewBatch(ctx context.Context) *Batch {
+	return &Batch{s: s, ctx: ctx}
+}
+
+func (b *Batch) Submit(task Task) {
+	done := b.s.Submit(b.ctx, task)
+	b.mu.Lock()
+	b.dones = append(b.dones, done)
+	b.mu.Unlock()
+}
+
+// Wait blocks until every submitted task finished and returns their joined errors.
+func (b *Batch) Wait() error {
+	b.mu.Lock()
+	dones := b.dones
+	b.dones = nil
+	b.mu.Unlock()
+	errs := make([]error, 0, len(dones))
+	for _, done := range dones {
+		errs = append(errs, <-done)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityOrder(t *testing.T) {
+	s := New(1)
+	defer s.Close()
+	ctx := context.Background()
+	block := make(chan struct{})
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+	batch := s.NewBatch(ctx)
+	batch.Submit(Task{Group: "a", Run: func(context.Context) error {
+		<-block
+		return nil
+	}})
+	batch.Submit(Task{Group: "a", Size: 100, Run: record("big")})
+	batch.Submit(Task{Group: "a", Size: 1, Run: record("small")})
+	batch.Submit(Task{Group: "a", Priority: PriorityHigh, Size: 1000, Run: record("delete")})
+	batch.Submit(Task{Group: "a", Priority: PriorityUrgent, Size: 1000, Run: record("user")})
+	close(block)
+	if err := batch.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"user", "delete", "small", "big"}
+	for idx, name := range expected {
+		if order[idx] != name {
+			t.Fatalf("expected %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestWeightedShare(t *testing.T) {
+	s := New(1)
+	defer s.Close()
+	s.SetWeight("heavy", 3)
+	s.SetWeight("light", 1)
+	ctx := context.Background()
+	block := make(chan struct{})
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	batch := s.NewBatch(ctx)
+	batch.Submit(Task{Group: "blocker", Run: func(context.Context) error {
+		<-block
+		return nil
+	}})
+	for i := 0; i < 8; i++ {
+		for _, name := range []string{"heavy", "light"} {
+			batch.Submit(Task{Group: name, Run: func(context.Context) error {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				return nil
+			}})
+		}
+	}
+	close(block)
+	if err := batch.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	var heavy int
+	for _, name := range order[:8] {
+		if name == "heavy" {
+			heavy++
+		}
+	}
+	if heavy != 6 {
+		t.Fatalf("expected heavy group to get 6 of the first 8 slots, got %d: %v", heavy, order)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	s := New(2)
+	defer s.Close()
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+	started := make(chan struct{}, 20)
+	release := make(chan struct{})
+	batch := s.NewBatch(context.Background())
+	for i := 0; i < 20; i++ {
+		batch.Submit(Task{Group: "a", Run: func(context.Context) error {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			started <- struct{}{}
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		}})
+	}
+	// hold the first tasks until both slots are taken and no third task starts
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 tasks to run at the same time, %d started", i)
+		}
+	}
+	select {
+	case <-started:
+		t.Fatal("a third task started while 2 were running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := batch.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if peak != 2 {
+		t.Fatalf("expected 2 running tasks at peak, got %d", peak)
+	}
+}
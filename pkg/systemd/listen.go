@@ -0,0 +1,48 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed by socket activation by their FileDescriptorName, nil if there are none.
+// The environment variables are unset so child processes don't take them over.
+func Listeners() (map[string]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	ret := make(map[string]net.Listener, n)
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		// FileListener dups the descriptor
+		f.Close()
+		if err != nil {
+			for _, ln := range ret {
+				ln.Close()
+			}
+			return nil, err
+		}
+		ret[name] = ln
+	}
+	return ret, nil
+}
@@ -0,0 +1,65 @@
+// Package systemd implements the parts of the sd_notify and socket activation protocols a daemon needs, without cgo.
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Ready tells the service manager startup finished.
+	Ready = "READY=1"
+	// Stopping tells the service manager the daemon is shutting down.
+	Stopping = "STOPPING=1"
+	// Watchdog keeps the watchdog of the service manager from restarting the daemon.
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status is the state line shown by systemctl status.
+func Status(text string) string {
+	return "STATUS=" + text
+}
+
+// Notify sends states, one per line, to the service manager.
+// It returns false without error when the process isn't run by systemd with notify support.
+func Notify(states ...string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if socket[0] == '@' {
+		// abstract socket
+		addr.Name = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	var msg []byte
+	for i, state := range states {
+		if i > 0 {
+			msg = append(msg, '\n')
+		}
+		msg = append(msg, state...)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval is how often the service manager expects Watchdog, 0 if the watchdog is disabled.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
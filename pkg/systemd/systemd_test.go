@@ -0,0 +1,156 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if ok, err := Notify(Ready); ok || err != nil {
+		t.Fatalf("expected no notification outside systemd, got %v %v", ok, err)
+	}
+	sockets := []string{filepath.Join(t.TempDir(), "notify.sock")}
+	if runtime.GOOS == "linux" {
+		sockets = append(sockets, fmt.Sprintf("@osssync-test-%d", os.Getpid()))
+	}
+	for _, socket := range sockets {
+		name := socket
+		if name[0] == '@' {
+			name = "\x00" + name[1:]
+		}
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		t.Setenv("NOTIFY_SOCKET", socket)
+		if ok, err := Notify(Ready, Status("3 settings, 0 queued")); !ok || err != nil {
+			t.Fatalf("%s: expected a notification, got %v %v", socket, ok, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 256)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(buf[:n]), "READY=1\nSTATUS=3 settings, 0 queued"; got != want {
+			t.Fatalf("%s: got %q, want %q", socket, got, want)
+		}
+	}
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := Notify(Ready); err == nil {
+		t.Fatal("expected an error without a listening socket")
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{usec: "", want: 0},
+		{usec: "abc", want: 0},
+		{usec: "0", want: 0},
+		{usec: "30000000", want: 30 * time.Second},
+		{usec: "30000000", pid: pid, want: 30 * time.Second},
+		{usec: "30000000", pid: "1", want: 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if got := WatchdogInterval(); got != tt.want {
+			t.Errorf("WATCHDOG_USEC=%s WATCHDOG_PID=%s: got %s, want %s", tt.usec, tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestListenersOtherProcess(t *testing.T) {
+	tests := []struct {
+		pid string
+		fds string
+	}{
+		{pid: "", fds: "1"},
+		{pid: "1", fds: "1"},
+		{pid: strconv.Itoa(os.Getpid()), fds: "0"},
+		{pid: strconv.Itoa(os.Getpid()), fds: "x"},
+	}
+	for _, tt := range tests {
+		t.Setenv("LISTEN_PID", tt.pid)
+		t.Setenv("LISTEN_FDS", tt.fds)
+		t.Setenv("LISTEN_FDNAMES", "control")
+		ret, err := Listeners()
+		if ret != nil || err != nil {
+			t.Fatalf("LISTEN_PID=%s LISTEN_FDS=%s: expected no listeners, got %v %v", tt.pid, tt.fds, ret, err)
+		}
+		for _, k := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			if _, ok := os.LookupEnv(k); ok {
+				t.Fatalf("%s not unset", k)
+			}
+		}
+	}
+}
+
+// TestListeners passes sockets to a child process the way systemd does, the child reports what Listeners found.
+func TestListeners(t *testing.T) {
+	if os.Getenv("SYSTEMD_TEST_CHILD") == "1" {
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		ret, err := Listeners()
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		lines := make([]string, 0, len(ret))
+		for name, ln := range ret {
+			lines = append(lines, name+"="+ln.Addr().String())
+		}
+		sort.Strings(lines)
+		fmt.Println(strings.Join(lines, " "), os.Getenv("LISTEN_FDS") == "")
+		os.Exit(0)
+	}
+	dir := t.TempDir()
+	var (
+		files []*os.File
+		want  []string
+	)
+	for _, name := range []string{"control", ""} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.sock", len(files)))
+		ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		f, err := ln.File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		files = append(files, f)
+		if name == "" {
+			name = "unknown"
+		}
+		want = append(want, name+"="+path)
+	}
+	sort.Strings(want)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestListeners$")
+	cmd.Env = append(os.Environ(), "SYSTEMD_TEST_CHILD=1", "LISTEN_FDS=2", "LISTEN_FDNAMES=control:")
+	cmd.ExtraFiles = files
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != strings.Join(want, " ")+" true" {
+		t.Fatalf("child found %q, want %q", got, strings.Join(want, " "))
+	}
+}
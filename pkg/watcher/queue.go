@@ -0,0 +1,410 @@
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/bububa/osssync/pkg/fs/local"
+)
+
+// DefaultQueueSize is the number of distinct paths kept in memory before spilling to disk.
+const DefaultQueueSize = 10000
+
+// Queue buffers events coalesced by path, it never blocks the producer. The latest event for a path wins,
+// except that a pending rename keeps its source, see merge.
+// When more than size distinct paths are pending, extra events are spilled to a file on disk
+// and read back in chunks as the memory queue drains. Every event gets a sequence number, a spilled
+// event is only read back if no newer event for its path was pushed since.
+type Queue struct {
+	mu        sync.Mutex
+	events    map[string]*Event
+	spillPath string
+	offset    int64
+	size      int
+	// spilled is the number of lines of the spill file not read back yet, superseded ones included
+	spilled int
+	// spilledSeqs maps the paths with a pending spilled event to the sequence number of the latest one
+	spilledSeqs map[string]uint64
+	// spilledOris maps the paths whose latest spilled event is a rename to its source
+	spilledOris map[string]*local.FileInfo
+	// spilledPeak is the largest size spilledSeqs reached since it was last reallocated, see compactSpilled
+	spilledPeak int
+	seq         uint64
+	// spilledTotal counts events ever written to disk
+	spilledTotal uint64
+}
+
+// NewQueue creates a queue spilling to spillPath, events left in spillPath by a previous run are picked up again.
+func NewQueue(size int, spillPath string) *Queue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	q := &Queue{
+		events:      make(map[string]*Event, size),
+		spillPath:   spillPath,
+		size:        size,
+		spilledSeqs: make(map[string]uint64),
+		spilledOris: make(map[string]*local.FileInfo),
+	}
+	if spillPath != "" {
+		q.loadSpilled()
+	}
+	return q
+}
+
+// loadSpilled indexes the spill file left by a previous run.
+func (q *Queue) loadSpilled() {
+	fd, err := os.Open(q.spillPath)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		q.spilled++
+		var item spilledEvent
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			continue
+		}
+		if item.Seq >= q.spilledSeqs[item.Path] {
+			q.spilledSeqs[item.Path] = item.Seq
+			if item.Ori != "" {
+				q.spilledOris[item.Path] = local.NewStaticFileInfo(item.Ori, item.Size, item.Mode, item.ModTime)
+			} else {
+				delete(q.spilledOris, item.Path)
+			}
+		}
+		q.seq = max(q.seq, item.Seq)
+	}
+	q.spilledPeak = len(q.spilledSeqs)
+}
+
+// Push coalesces ev with a pending event for the same path, see merge.
+func (q *Queue) Push(ev *Event) {
+	if ev == nil || ev.File == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	key := ev.File.Path()
+	ev = q.merge(key, ev)
+	if _, ok := q.events[key]; ok || len(q.events) < q.size || q.spillPath == "" {
+		q.store(key, ev)
+		return
+	}
+	if err := q.spill(ev, q.seq); err != nil {
+		// keep the event rather than losing it
+		q.store(key, ev)
+	}
+}
+
+// merge returns the event replacing the pending one for the path, q.mu must be held. The latest event wins,
+// but a file renamed and then written or removed still has its rename source to remove: ev keeps the source
+// and gets the rename op on top of its own.
+func (q *Queue) merge(key string, ev *Event) *Event {
+	if ev.Ori != nil {
+		return ev
+	}
+	var ori *local.FileInfo
+	if prev, ok := q.events[key]; ok {
+		if prev.Op&fsnotify.Rename == fsnotify.Rename {
+			ori = prev.Ori
+		}
+	} else {
+		ori = q.spilledOris[key]
+	}
+	if ori == nil {
+		return ev
+	}
+	merged := *ev
+	merged.Ori = ori
+	merged.Op |= fsnotify.Rename
+	return &merged
+}
+
+// store keeps ev in memory, superseding a spilled event for the same path, q.mu must be held.
+func (q *Queue) store(key string, ev *Event) {
+	q.events[key] = ev
+	delete(q.spilledSeqs, key)
+	delete(q.spilledOris, key)
+}
+
+// Retry queues a failed event again unless a newer event for the same path is pending.
+func (q *Queue) Retry(ev *Event) {
+	if ev == nil || ev.File == nil {
+		return
+	}
+	q.mu.Lock()
+	_, ok := q.events[ev.File.Path()]
+	if !ok {
+		_, ok = q.spilledSeqs[ev.File.Path()]
+	}
+	q.mu.Unlock()
+	if !ok {
+		q.Push(ev)
+	}
+}
+
+// Drain removes and returns the pending events, refilling memory from the spill file if any.
+func (q *Queue) Drain() []*Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ret := make([]*Event, 0, len(q.events))
+	for _, ev := range q.events {
+		ret = append(ret, ev)
+	}
+	q.events = make(map[string]*Event, q.size)
+	if q.spilled > 0 {
+		q.unspill()
+	}
+	return ret
+}
+
+// Len is the number of pending events, including spilled ones.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events) + len(q.spilledSeqs)
+}
+
+// Spilled is the total number of events which had to be written to disk.
+func (q *Queue) Spilled() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.spilledTotal
+}
+
+type spilledEvent struct {
+	SettingKey string      `json:"setting_key,omitempty"`
+	HandlerKey string      `json:"handler_key,omitempty"`
+	Path       string      `json:"path"`
+	Ori        string      `json:"ori,omitempty"`
+	Size       int64       `json:"size,omitempty"`
+	Mode       fs.FileMode `json:"mode,omitempty"`
+	ModTime    time.Time   `json:"mod_time"`
+	Op         fsnotify.Op `json:"op"`
+	Manual     bool        `json:"manual,omitempty"`
+	Attempts   int         `json:"attempts,omitempty"`
+	Seq        uint64      `json:"seq"`
+}
+
+func marshalEvent(ev *Event, seq uint64) ([]byte, error) {
+	item := spilledEvent{
+		Seq:        seq,
+		SettingKey: ev.SettingKey,
+		HandlerKey: ev.HandlerKey,
+		Path:       ev.File.Path(),
+		Size:       ev.File.Size(),
+		Mode:       ev.File.Mode(),
+		ModTime:    ev.File.ModTime(),
+		Op:         ev.Op,
+		Manual:     ev.Manual,
+		Attempts:   ev.Attempts,
+	}
+	if ev.Ori != nil {
+		item.Ori = ev.Ori.Path()
+	}
+	bs, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	return append(bs, '\n'), nil
+}
+
+func (q *Queue) spill(ev *Event, seq uint64) error {
+	if err := os.MkdirAll(filepath.Dir(q.spillPath), 0o700); err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(q.spillPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	bs, err := marshalEvent(ev, seq)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(bs); err != nil {
+		return err
+	}
+	q.spilledSeqs[ev.File.Path()] = seq
+	if ev.Ori != nil {
+		q.spilledOris[ev.File.Path()] = ev.Ori
+	} else {
+		delete(q.spilledOris, ev.File.Path())
+	}
+	q.spilled++
+	q.spilledTotal++
+	q.spilledPeak = max(q.spilledPeak, len(q.spilledSeqs))
+	return nil
+}
+
+// Persist moves the events in memory to the spill file, ahead of the spilled events not read back yet,
+// so a queue created with the same spill path after a restart picks all pending events up again.
+func (q *Queue) Persist() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.spillPath == "" || len(q.events) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(q.spillPath), 0o700); err != nil {
+		return err
+	}
+	tmp := q.spillPath + ".tmp"
+	fd, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fd)
+	// the events in memory are newer than any spilled event for their path
+	seqs := make(map[string]uint64, len(q.events))
+	oris := make(map[string]*local.FileInfo)
+	for key, ev := range q.events {
+		q.seq++
+		bs, err := marshalEvent(ev, q.seq)
+		if err != nil {
+			continue
+		}
+		w.Write(bs)
+		seqs[key] = q.seq
+		if ev.Ori != nil {
+			oris[key] = ev.Ori
+		}
+	}
+	if q.spilled > 0 {
+		if err := copySpilled(w, q.spillPath, q.offset); err != nil {
+			fd.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, q.spillPath); err != nil {
+		return err
+	}
+	q.spilled += len(seqs)
+	for key, seq := range seqs {
+		q.spilledSeqs[key] = seq
+		delete(q.spilledOris, key)
+	}
+	for key, ori := range oris {
+		q.spilledOris[key] = ori
+	}
+	q.spilledPeak = max(q.spilledPeak, len(q.spilledSeqs))
+	q.offset = 0
+	q.events = make(map[string]*Event, q.size)
+	return nil
+}
+
+// copySpilled copies the spill file from offset on to w.
+func copySpilled(w io.Writer, spillPath string, offset int64) error {
+	src, err := os.Open(spillPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// unspill reads up to q.size spilled events back into memory, q.mu must be held.
+func (q *Queue) unspill() {
+	fd, err := os.Open(q.spillPath)
+	if err != nil {
+		q.spilled = 0
+		q.offset = 0
+		return
+	}
+	defer fd.Close()
+	if _, err := fd.Seek(q.offset, 0); err != nil {
+		return
+	}
+	reader := bufio.NewReader(fd)
+	for len(q.events) < q.size {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		q.offset += int64(len(line))
+		q.spilled--
+		var item spilledEvent
+		if err := json.Unmarshal(line, &item); err != nil {
+			continue
+		}
+		if seq, ok := q.spilledSeqs[item.Path]; !ok || seq != item.Seq {
+			// superseded by a newer event, spilled later or pushed to memory since
+			continue
+		}
+		ev := &Event{
+			SettingKey: item.SettingKey,
+			HandlerKey: item.HandlerKey,
+			File:       spilledFile(item),
+			Op:         item.Op,
+			Manual:     item.Manual,
+			Attempts:   item.Attempts,
+		}
+		if item.Ori != "" {
+			ev.Ori = local.NewStaticFileInfo(item.Ori, item.Size, item.Mode, item.ModTime)
+		}
+		q.store(item.Path, ev)
+	}
+	if q.spilled <= 0 {
+		q.spilled = 0
+		q.offset = 0
+		q.spilledSeqs = make(map[string]uint64)
+		q.spilledOris = make(map[string]*local.FileInfo)
+		q.spilledPeak = 0
+		os.Remove(q.spillPath)
+		return
+	}
+	q.compactSpilled()
+}
+
+// compactSpilled reallocates the spilled indexes once most of their entries were read back,
+// deleting from a map never releases its buckets so a burst of spilled paths would stay allocated.
+// q.mu must be held.
+func (q *Queue) compactSpilled() {
+	if q.spilledPeak <= q.size || len(q.spilledSeqs) > q.spilledPeak/4 {
+		return
+	}
+	// maps.Clone keeps the bucket array of its source, copy into a map sized for what is left
+	seqs := make(map[string]uint64, len(q.spilledSeqs))
+	maps.Copy(seqs, q.spilledSeqs)
+	oris := make(map[string]*local.FileInfo, len(q.spilledOris))
+	maps.Copy(oris, q.spilledOris)
+	q.spilledSeqs, q.spilledOris = seqs, oris
+	q.spilledPeak = len(q.spilledSeqs)
+}
+
+// spilledFile is the file of a spilled event, stat again since it may have changed after it was spilled.
+func spilledFile(item spilledEvent) *local.FileInfo {
+	if fi, err := os.Stat(item.Path); err == nil {
+		return local.NewFileInfo(fi, local.WithPath(item.Path))
+	}
+	return local.NewStaticFileInfo(item.Path, item.Size, item.Mode, item.ModTime)
+}
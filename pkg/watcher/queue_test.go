@@ -0,0 +1,263 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/bububa/osssync/pkg/fs/local"
+)
+
+func newTestEvent(path string, op fsnotify.Op) *Event {
+	return &Event{
+		File: local.NewStaticFileInfo(path, 1, 0o644, time.Now()),
+		Op:   op,
+	}
+}
+
+func TestQueueCoalesceAndSpill(t *testing.T) {
+	spillPath := filepath.Join(t.TempDir(), "queue.jsonl")
+	q := NewQueue(2, spillPath)
+	q.Push(newTestEvent("/a", fsnotify.Create))
+	q.Push(newTestEvent("/a", fsnotify.Write))
+	q.Push(newTestEvent("/b", fsnotify.Create))
+	q.Push(newTestEvent("/c", fsnotify.Create))
+	q.Push(newTestEvent("/d", fsnotify.Remove))
+	if l := q.Len(); l != 4 {
+		t.Fatalf("expected 4 queued events, got %d", l)
+	}
+	if n := q.Spilled(); n != 2 {
+		t.Fatalf("expected 2 spilled events, got %d", n)
+	}
+	first := q.Drain()
+	if len(first) != 2 {
+		t.Fatalf("expected 2 events in memory, got %d", len(first))
+	}
+	for _, ev := range first {
+		if ev.File.Path() == "/a" && ev.Op != fsnotify.Write {
+			t.Fatalf("expected latest op for /a, got %s", ev.Op)
+		}
+	}
+
+	second := q.Drain()
+	if len(second) != 2 {
+		t.Fatalf("expected 2 events reloaded from disk, got %d", len(second))
+	}
+	if l := q.Len(); l != 0 {
+		t.Fatalf("expected empty queue, got %d", l)
+	}
+}
+
+func TestQueueResumeSpill(t *testing.T) {
+	spillPath := filepath.Join(t.TempDir(), "queue.jsonl")
+	q := NewQueue(1, spillPath)
+	q.Push(newTestEvent("/a", fsnotify.Create))
+	q.Push(newTestEvent("/b", fsnotify.Remove))
+
+	// a new queue picks up what a previous run left on disk
+	q = NewQueue(1, spillPath)
+	events := q.Drain()
+	if len(events) != 0 {
+		t.Fatalf("expected nothing in memory, got %d", len(events))
+	}
+	events = q.Drain()
+	if len(events) != 1 || events[0].File.Path() != "/b" || events[0].Op != fsnotify.Remove {
+		t.Fatalf("expected spilled remove of /b, got %+v", events)
+	}
+}
+
+func TestQueueRetryKeepsNewerEvent(t *testing.T) {
+	q := NewQueue(10, "")
+	failed := newTestEvent("/a", fsnotify.Write)
+	failed.Attempts = 1
+	q.Push(newTestEvent("/a", fsnotify.Remove))
+	q.Retry(failed)
+	q.Retry(newTestEvent("/b", fsnotify.Create))
+	events := q.Drain()
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	for _, ev := range events {
+		if ev.File.Path() == "/a" && ev.Op != fsnotify.Remove {
+			t.Fatalf("expected retry not to replace the newer event, got %s", ev.Op)
+		}
+	}
+}
+
+func TestQueuePersist(t *testing.T) {
+	spillPath := filepath.Join(t.TempDir(), "queue.jsonl")
+	q := NewQueue(2, spillPath)
+	q.Push(newTestEvent("/a", fsnotify.Create))
+	q.Push(newTestEvent("/b", fsnotify.Create))
+	q.Push(newTestEvent("/c", fsnotify.Create))
+	q.Push(newTestEvent("/d", fsnotify.Remove))
+	// returns /a and /b, reads /c and /d back into memory
+	q.Drain()
+	q.Push(newTestEvent("/e", fsnotify.Write))
+	q.Push(newTestEvent("/f", fsnotify.Create))
+	if err := q.Persist(); err != nil {
+		t.Fatal(err)
+	}
+	if l := q.Len(); l != 4 {
+		t.Fatalf("expected 4 queued events after persist, got %d", l)
+	}
+	restarted := NewQueue(10, spillPath)
+	if l := restarted.Len(); l != 4 {
+		t.Fatalf("expected 4 events picked up after restart, got %d", l)
+	}
+	restarted.Drain()
+	paths := make(map[string]fsnotify.Op)
+	for _, ev := range restarted.Drain() {
+		paths[ev.File.Path()] = ev.Op
+	}
+	if len(paths) != 4 || paths["/d"] != fsnotify.Remove || paths["/e"] != fsnotify.Write {
+		t.Fatalf("unexpected events after restart: %v", paths)
+	}
+	if l := restarted.Len(); l != 0 {
+		t.Fatalf("expected no events left, got %d", l)
+	}
+}
+
+func TestQueueSpilledEventSuperseded(t *testing.T) {
+	spillPath := filepath.Join(t.TempDir(), "queue.jsonl")
+	q := NewQueue(1, spillPath)
+	q.Push(newTestEvent("/a", fsnotify.Create))
+	q.Push(newTestEvent("/x", fsnotify.Remove))
+	q.Push(newTestEvent("/y", fsnotify.Create))
+	// returns /a and reads the spilled remove of /x back, /y stays on disk
+	q.Drain()
+	q.Push(newTestEvent("/y", fsnotify.Remove))
+	var ops []fsnotify.Op
+	for range 3 {
+		for _, ev := range q.Drain() {
+			if ev.File.Path() == "/y" {
+				ops = append(ops, ev.Op)
+			}
+		}
+	}
+	if len(ops) != 1 || ops[0] != fsnotify.Remove {
+		t.Fatalf("expected only the newer remove of /y, got %v", ops)
+	}
+
+	// memory is free while the remove of /x is still on disk after persisting or a restart,
+	// a create pushed then supersedes it
+	spillPath = filepath.Join(t.TempDir(), "queue.jsonl")
+	q = NewQueue(1, spillPath)
+	q.Push(newTestEvent("/a", fsnotify.Create))
+	q.Push(newTestEvent("/x", fsnotify.Remove))
+	if err := q.Persist(); err != nil {
+		t.Fatal(err)
+	}
+	q = NewQueue(1, spillPath)
+	q.Push(newTestEvent("/x", fsnotify.Create))
+	var created bool
+	for range 3 {
+		for _, ev := range q.Drain() {
+			if ev.File.Path() != "/x" {
+				continue
+			}
+			if ev.Op == fsnotify.Remove {
+				t.Fatal("spilled remove of /x returned after a newer create")
+			}
+			created = true
+		}
+	}
+	if !created {
+		t.Fatal("expected the create of /x")
+	}
+	if l := q.Len(); l != 0 {
+		t.Fatalf("expected no events left, got %d", l)
+	}
+}
+
+func TestQueueRenameThenWrite(t *testing.T) {
+	renamed := func() *Event {
+		ev := newTestEvent("/b", fsnotify.Rename)
+		ev.Ori = local.NewStaticFileInfo("/a", 1, 0o644, time.Now())
+		return ev
+	}
+	q := NewQueue(10, "")
+	q.Push(renamed())
+	q.Push(newTestEvent("/b", fsnotify.Write))
+	events := q.Drain()
+	if len(events) != 1 || events[0].Op != fsnotify.Rename|fsnotify.Write || events[0].Ori == nil || events[0].Ori.Path() != "/a" {
+		t.Fatalf("expected the write to keep the rename source, got %+v", events)
+	}
+
+	// a rename spilled to disk keeps its source too
+	spillPath := filepath.Join(t.TempDir(), "queue.jsonl")
+	q = NewQueue(1, spillPath)
+	q.Push(newTestEvent("/x", fsnotify.Create))
+	q.Push(renamed())
+	if err := q.Persist(); err != nil {
+		t.Fatal(err)
+	}
+	q = NewQueue(1, spillPath)
+	q.Push(newTestEvent("/b", fsnotify.Remove))
+	var got []*Event
+	for range 3 {
+		for _, ev := range q.Drain() {
+			if ev.File.Path() == "/b" {
+				got = append(got, ev)
+			}
+		}
+	}
+	if len(got) != 1 || got[0].Op != fsnotify.Rename|fsnotify.Remove || got[0].Ori == nil || got[0].Ori.Path() != "/a" {
+		t.Fatalf("expected the remove to keep the spilled rename source, got %+v", got)
+	}
+}
+
+func TestQueueSpilledFileRestat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	q := NewQueue(1, filepath.Join(dir, "queue.jsonl"))
+	q.Push(newTestEvent("/x", fsnotify.Create))
+	q.Push(newTestEvent(path, fsnotify.Write))
+	// the file changes while its event waits on disk
+	if err := os.WriteFile(path, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	q.Drain()
+	events := q.Drain()
+	if len(events) != 1 || events[0].File.Size() != int64(len("changed")) {
+		t.Fatalf("expected the spilled event to carry the current size, got %+v", events)
+	}
+}
+
+func TestQueueCompactsSpilledIndex(t *testing.T) {
+	spillPath := filepath.Join(t.TempDir(), "queue.jsonl")
+	q := NewQueue(2, spillPath)
+	for i := range 20 {
+		q.Push(newTestEvent(fmt.Sprintf("/%d", i), fsnotify.Create))
+	}
+	if q.spilledPeak != 18 {
+		t.Fatalf("expected 18 spilled paths, got %d", q.spilledPeak)
+	}
+	var drained int
+	for range 7 {
+		drained += len(q.Drain())
+	}
+	// 4 paths are left on disk, under a quarter of the peak so the indexes were reallocated
+	if l := len(q.spilledSeqs); l != 4 {
+		t.Fatalf("expected 4 spilled paths left, got %d", l)
+	}
+	if q.spilledPeak != len(q.spilledSeqs) {
+		t.Fatalf("expected the spilled index to be compacted, peak %d for %d paths", q.spilledPeak, len(q.spilledSeqs))
+	}
+	for q.Len() > 0 {
+		drained += len(q.Drain())
+	}
+	if drained != 20 {
+		t.Fatalf("expected 20 drained events, got %d", drained)
+	}
+	if q.spilledPeak != 0 || len(q.spilledSeqs) != 0 {
+		t.Fatalf("expected an empty spilled index, peak %d for %d paths", q.spilledPeak, len(q.spilledSeqs))
+	}
+}
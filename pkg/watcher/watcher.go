@@ -19,6 +19,10 @@ type Event struct {
 	Ori        *local.FileInfo
 	HandlerKey string
 	Op         fsnotify.Op
+	// Manual is set for events triggered by Notify rather than by the file system
+	Manual bool
+	// Attempts is the number of times handling the event failed
+	Attempts int
 }
 
 // Watcher wraps fsnotify.Watcher. When fsnotify adds recursive watches, you should be able to switch your code to use fsnotify.Watcher
@@ -120,6 +124,7 @@ func (m *Watcher) sync(cache map[string]*local.FileInfo, handlerKey string) {
 				Op:         fsnotify.Create,
 				File:       fi,
 				HandlerKey: handlerKey,
+				Manual:     true,
 			}
 			return true
 		}